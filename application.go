@@ -3,16 +3,41 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 
+	"simio-api/config"
 	"simio-api/resource"
+	"simio-api/service"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	simioResource := resource.BuildSimioResource()
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	simioService := service.BuildSimioService()
+	simioResource := resource.NewSimioResource(simioService)
+	jobResource := resource.NewJobResource(service.BuildJobService(simioService))
+	eventsResource := resource.BuildEventsResource(simioService)
+	migrationResource := resource.NewMigrationResource(service.NewIDMigrator(simioService))
+	adminToken := config.String("SIMIO_ADMIN_TOKEN", "")
 	router := mux.NewRouter()
 	router.HandleFunc("/simian", simioResource.CheckSimian).Methods("POST")
+	router.HandleFunc("/simian", simioResource.ListSimians).Methods("GET")
+	router.HandleFunc("/simian/batch", simioResource.CheckSimianBatch).Methods("POST")
+	router.HandleFunc("/simian/stream", simioResource.CheckSimianStream).Methods("POST")
+	router.HandleFunc("/simian/{id}", simioResource.GetSimian).Methods("GET")
+	router.HandleFunc("/simian/{id}", simioResource.DeleteSimian).Methods("DELETE")
+	router.HandleFunc("/motifs/search", simioResource.SearchMotifs).Methods("POST")
+	router.HandleFunc("/jobs", jobResource.SubmitJob).Methods("POST")
+	router.HandleFunc("/jobs/{id}", jobResource.GetJob).Methods("GET")
+	router.HandleFunc("/jobs/{id}", jobResource.CancelJob).Methods("DELETE")
 	router.HandleFunc("/stats", simioResource.GetSimiansProportion).Methods("GET")
+	router.HandleFunc("/stats/recount", resource.RequireAdminToken(adminToken, simioResource.RecountStats)).Methods("POST")
+	router.HandleFunc("/events", eventsResource.StreamEvents).Methods("GET")
+	router.HandleFunc("/admin/migrate-ids", resource.RequireAdminToken(adminToken, migrationResource.StartMigration)).Methods("POST")
+	router.HandleFunc("/admin/migrate-ids", resource.RequireAdminToken(adminToken, migrationResource.GetMigration)).Methods("GET")
 	log.Fatal(http.ListenAndServe(":5000", router))
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"simio-api/config"
+	"simio-api/resource"
+	"simio-api/service"
+)
+
+// runCommand runs the admin command named by the first argument and returns
+// the process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate-ids":
+		return migrateIDs(config.String("SIMIO_API_URL", "http://localhost:5000"), config.String("SIMIO_ADMIN_TOKEN", ""))
+	case "recount":
+		return recount(config.String("SIMIO_API_URL", "http://localhost:5000"), config.String("SIMIO_ADMIN_TOKEN", ""))
+	case "verify":
+		return verify(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %s. Available commands: migrate-ids, recount, verify\n", args[0])
+		return 2
+	}
+}
+
+// migrationPollInterval is how often migrate-ids asks the API whether its
+// migration has finished.
+var migrationPollInterval = time.Second
+
+// migrateIDs asks the API running at apiURL to move the stored entities to the
+// IDs of its SIMIO_HASH, and waits for it. The API keeps serving the entities,
+// under either ID, while they are moved. A migration stopped halfway is fine,
+// since the API still finds entities under their legacy IDs.
+func migrateIDs(apiURL string, token string) int {
+	resp, err := callAdmin(http.MethodPost, apiURL, "/admin/migrate-ids", token)
+
+	for err == nil {
+		var migration service.IDMigration
+		statusCode := resp.StatusCode
+		err = json.NewDecoder(resp.Body).Decode(&migration)
+		resp.Body.Close()
+
+		if statusCode != http.StatusOK && statusCode != http.StatusAccepted && statusCode != http.StatusConflict {
+			fmt.Fprintf(os.Stderr, "The API answered the migration with status %d\n", statusCode)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid migration response. Details: %s\n", err)
+			return 1
+		}
+		if statusCode == http.StatusConflict {
+			fmt.Println("A migration is already running, waiting for it")
+		}
+
+		if !migration.Running {
+			if migration.Error != "" {
+				fmt.Fprintf(os.Stderr, "Migration stopped after %d entities. Details: %s\n", migration.Migrated, migration.Error)
+				return 1
+			}
+			fmt.Printf("%d entities migrated\n", migration.Migrated)
+			return 0
+		}
+
+		time.Sleep(migrationPollInterval)
+		resp, err = callAdmin(http.MethodGet, apiURL, "/admin/migrate-ids", token)
+	}
+
+	fmt.Fprintf(os.Stderr, "Error on calling the API. Details: %s\n", err)
+	return 1
+}
+
+// recount asks the API running at apiURL to check its stats counters against a
+// count of every stored entity, and to fix them. It fails when they differed.
+// The counters live in the API process, so a count made by this process would
+// only check its own, freshly loaded, ones.
+func recount(apiURL string, token string) int {
+	resp, err := callAdmin(http.MethodPost, apiURL, "/stats/recount", token)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error on calling the API. Details: %s\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "The API answered the recount with status %d\n", resp.StatusCode)
+		return 1
+	}
+
+	var recounted resource.RecountResponse
+	if err := json.NewDecoder(resp.Body).Decode(&recounted); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid recount response. Details: %s\n", err)
+		return 1
+	}
+	counters, counted := recounted.Counters, recounted.Recount
+
+	fmt.Printf("Counters: %d simians, %d humans\n", counters.CountMutantDNA, counters.CountHumanDNA)
+	fmt.Printf("Recount:  %d simians, %d humans\n", counted.CountMutantDNA, counted.CountHumanDNA)
+
+	if counters != counted {
+		fmt.Fprintln(os.Stderr, "Counters did not match the stored entities and have been fixed")
+		return 1
+	}
+	return 0
+}
+
+// callAdmin calls the admin endpoint at path of the API running at apiURL,
+// sending the admin token.
+func callAdmin(method string, apiURL string, path string, token string) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(apiURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return http.DefaultClient.Do(req)
+}
+
+// verify checks every file of the data directory and prints what is wrong with
+// them. With --repair it fixes or quarantines them. It fails when any problem
+// is left. Run it with the API stopped, since it reads the files directly.
+func verify(args []string) int {
+	repair := false
+	for _, arg := range args {
+		if arg != "--repair" {
+			fmt.Fprintf(os.Stderr, "Unknown option %s. Usage: verify [--repair]\n", arg)
+			return 2
+		}
+		repair = true
+	}
+
+	report, err := service.BuildFileVerifier().Verify(repair)
+
+	for _, issue := range report.Issues {
+		fmt.Printf("%s: %s\n", issue.Path, strings.Join(issue.Problems, ". "))
+		if issue.Action != "" {
+			fmt.Printf("  %s\n", issue.Action)
+		}
+		if issue.RepairErr != nil {
+			fmt.Printf("  not repaired: %s\n", issue.RepairErr)
+		}
+	}
+	fmt.Printf("%d files checked, %d with problems, %d left unresolved\n", report.Checked, len(report.Issues), report.Unresolved())
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Verification stopped. Details: %s\n", err)
+		return 1
+	}
+	if report.Unresolved() > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecount(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		statusCode       int
+		respBody         string
+		expectedExitCode int
+	}
+
+	cases := []Case{
+		Case{
+			statusCode:       http.StatusOK,
+			respBody:         `{"counters": {"count_mutant_dna": 1, "count_human_dna": 1, "ratio": 1}, "recount": {"count_mutant_dna": 1, "count_human_dna": 1, "ratio": 1}}`,
+			expectedExitCode: 0,
+		},
+		Case{
+			statusCode:       http.StatusOK,
+			respBody:         `{"counters": {"count_mutant_dna": 6, "count_human_dna": 1, "ratio": 6}, "recount": {"count_mutant_dna": 1, "count_human_dna": 1, "ratio": 1}}`,
+			expectedExitCode: 1,
+		},
+		Case{
+			statusCode:       http.StatusUnauthorized,
+			respBody:         `Unauthorized - Invalid admin token`,
+			expectedExitCode: 1,
+		},
+		Case{
+			statusCode:       http.StatusNotFound,
+			respBody:         `404 page not found`,
+			expectedExitCode: 1,
+		},
+	}
+
+	for _, c := range cases {
+		var path, method, authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			path, method, authorization = req.URL.Path, req.Method, req.Header.Get("Authorization")
+			rw.WriteHeader(c.statusCode)
+			rw.Write([]byte(c.respBody))
+		}))
+
+		assert.Equal(c.expectedExitCode, recount(server.URL+"/", "secret"))
+		assert.Equal("/stats/recount", path)
+		assert.Equal(http.MethodPost, method)
+		assert.Equal("Bearer secret", authorization)
+
+		server.Close()
+	}
+}
+
+func TestMigrateIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	migrationPollInterval = time.Millisecond
+
+	type Case struct {
+		responses        []string
+		statusCode       int
+		expectedExitCode int
+		expectedCalls    []string
+	}
+
+	cases := []Case{
+		Case{
+			responses:        []string{`{"running": true, "migrated": 0}`, `{"running": true, "migrated": 0}`, `{"running": false, "migrated": 2}`},
+			statusCode:       http.StatusAccepted,
+			expectedExitCode: 0,
+			expectedCalls:    []string{"POST", "GET", "GET"},
+		},
+		Case{
+			responses:        []string{`{"running": true, "migrated": 0}`, `{"running": false, "migrated": 1, "error": "UNEXPECTED_ERROR_ON_SAVE"}`},
+			statusCode:       http.StatusConflict,
+			expectedExitCode: 1,
+			expectedCalls:    []string{"POST", "GET"},
+		},
+		Case{
+			responses:        []string{`Unauthorized - Invalid admin token`},
+			statusCode:       http.StatusUnauthorized,
+			expectedExitCode: 1,
+			expectedCalls:    []string{"POST"},
+		},
+	}
+
+	for _, c := range cases {
+		var calls []string
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			assert.Equal("/admin/migrate-ids", req.URL.Path)
+			assert.Equal("Bearer secret", req.Header.Get("Authorization"))
+
+			statusCode := http.StatusOK
+			if len(calls) == 0 {
+				statusCode = c.statusCode
+			}
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(c.responses[len(calls)]))
+			calls = append(calls, req.Method)
+		}))
+
+		assert.Equal(c.expectedExitCode, migrateIDs(server.URL, "secret"))
+		assert.Equal(c.expectedCalls, calls)
+
+		server.Close()
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SIMIO_TEST_STRING", "value")
+	defer os.Unsetenv("SIMIO_TEST_STRING")
+
+	assert.Equal("value", String("SIMIO_TEST_STRING", "default"))
+	assert.Equal("default", String("SIMIO_TEST_MISSING", "default"))
+}
+
+func TestInt(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		value          string
+		expectedResult int
+	}
+
+	cases := []Case{
+		Case{value: "10", expectedResult: 10},
+		Case{value: "", expectedResult: 4},
+		Case{value: "ten", expectedResult: 4},
+	}
+
+	for _, currentCase := range cases {
+		os.Setenv("SIMIO_TEST_INT", currentCase.value)
+		assert.Equal(currentCase.expectedResult, Int("SIMIO_TEST_INT", 4))
+	}
+	os.Unsetenv("SIMIO_TEST_INT")
+}
+
+func TestBool(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SIMIO_TEST_BOOL", "true")
+	assert.True(Bool("SIMIO_TEST_BOOL", false))
+
+	os.Setenv("SIMIO_TEST_BOOL", "maybe")
+	assert.False(Bool("SIMIO_TEST_BOOL", false))
+
+	os.Unsetenv("SIMIO_TEST_BOOL")
+}
+
+func TestDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SIMIO_TEST_DURATION", "250ms")
+	assert.Equal(250*time.Millisecond, Duration("SIMIO_TEST_DURATION", time.Second))
+
+	os.Setenv("SIMIO_TEST_DURATION", "soon")
+	assert.Equal(time.Second, Duration("SIMIO_TEST_DURATION", time.Second))
+
+	os.Unsetenv("SIMIO_TEST_DURATION")
+}
@@ -0,0 +1,409 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	simiosBucket  = []byte("simios")
+	aliasesBucket = []byte("aliases")
+	metaBucket    = []byte("meta")
+	countsKey     = []byte("counts")
+	// importedKey marks a store the file storage has been imported into.
+	importedKey = []byte("files-imported")
+)
+
+// BoltDAO keeps every entity in a single bbolt file, so a large database
+// neither takes millions of inodes nor a walk over them to start. The
+// counters are stored along with the entities, in the same transactions.
+//
+// bbolt locks its file, so only one process can open it at a time.
+type BoltDAO struct {
+	simians int64
+	humans  int64
+	db      *bolt.DB
+}
+
+func (bd *BoltDAO) Save(entity SimioEntity) (bool, error) {
+	inserted := false
+	err := bd.update(func(tx *bolt.Tx, counts *Counts) error {
+		if tx.Bucket(simiosBucket).Get([]byte(entity.ID)) != nil {
+			log.Printf("The DNA %s has been already saved", entity.ID)
+			return nil
+		}
+		inserted = true
+		return putEntity(tx, entity, counts)
+	})
+
+	if err != nil {
+		log.Printf("Error on saving entity in bolt. Details: %s", err)
+		return false, fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return inserted, nil
+}
+
+// SaveAll saves the entities in a single transaction, so either all of them
+// are saved or none is.
+func (bd *BoltDAO) SaveAll(entities []SimioEntity) ([]SimioEntity, error) {
+	var inserted []SimioEntity
+	err := bd.update(func(tx *bolt.Tx, counts *Counts) error {
+		for _, entity := range entities {
+			if tx.Bucket(simiosBucket).Get([]byte(entity.ID)) != nil {
+				continue
+			}
+			if err := putEntity(tx, entity, counts); err != nil {
+				return err
+			}
+			inserted = append(inserted, entity)
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Error on saving entities in bolt. Details: %s", err)
+		return nil, fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return inserted, nil
+}
+
+func (bd *BoltDAO) Get(id string) (SimioEntity, bool) {
+	var entity SimioEntity
+	found := false
+
+	bd.db.View(func(tx *bolt.Tx) error {
+		entity, found = getEntity(tx, id)
+		return nil
+	})
+	return entity, found
+}
+
+func (bd *BoltDAO) Replace(previousID string, entity SimioEntity) error {
+	entity.PreviousID = previousID
+
+	err := bd.update(func(tx *bolt.Tx, counts *Counts) error {
+		previous, found := readEntity(tx, previousID)
+		if !found {
+			return nil
+		}
+
+		if tx.Bucket(simiosBucket).Get([]byte(entity.ID)) == nil {
+			if err := putEntity(tx, entity, counts); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Bucket(aliasesBucket).Put([]byte(previousID), []byte(entity.ID)); err != nil {
+			return err
+		}
+
+		return deleteEntity(tx, previous, counts)
+	})
+
+	if err != nil {
+		log.Printf("Error on replacing entity %s in bolt. Details: %s", previousID, err)
+		return fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return nil
+}
+
+func (bd *BoltDAO) Delete(id string) (bool, error) {
+	deleted := false
+
+	err := bd.update(func(tx *bolt.Tx, counts *Counts) error {
+		entity, found := getEntity(tx, id)
+		if !found {
+			return nil
+		}
+
+		if err := deleteEntity(tx, entity, counts); err != nil {
+			return err
+		}
+
+		var aliases [][]byte
+		tx.Bucket(aliasesBucket).ForEach(func(previousID []byte, newID []byte) error {
+			if string(newID) == entity.ID {
+				aliases = append(aliases, previousID)
+			}
+			return nil
+		})
+		for _, previousID := range aliases {
+			if err := tx.Bucket(aliasesBucket).Delete(previousID); err != nil {
+				return err
+			}
+		}
+
+		deleted = true
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Error on removing entity %s from bolt. Details: %s", id, err)
+		return false, fmt.Errorf("UNEXPECTED_ERROR_ON_DELETE")
+	}
+	return deleted, nil
+}
+
+func (bd *BoltDAO) List(query ListQuery) ListPage {
+	var entities []SimioEntity
+
+	bd.forEach(func(entity SimioEntity) {
+		if query.matches(entity) {
+			entities = append(entities, entity)
+		}
+	})
+	return query.page(entities)
+}
+
+func (bd *BoltDAO) Snapshot() []SimioEntity {
+	entities := []SimioEntity{}
+
+	bd.forEach(func(entity SimioEntity) {
+		entities = append(entities, entity)
+	})
+	return entities
+}
+
+func (bd *BoltDAO) Counts() Counts {
+	return Counts{
+		Simians: int(atomic.LoadInt64(&bd.simians)),
+		Humans:  int(atomic.LoadInt64(&bd.humans)),
+	}
+}
+
+func (bd *BoltDAO) Recount() (Counts, Counts) {
+	previous := bd.Counts()
+	var counted Counts
+
+	err := bd.update(func(tx *bolt.Tx, counts *Counts) error {
+		*counts = Counts{}
+		return tx.Bucket(simiosBucket).ForEach(func(id []byte, value []byte) error {
+			var entity SimioEntity
+			if err := json.Unmarshal(value, &entity); err != nil {
+				return err
+			}
+			counts.add(entity, 1)
+			counted = *counts
+			return nil
+		})
+	})
+
+	if err != nil {
+		log.Printf("Error on recounting entities in bolt. Details: %s", err)
+	}
+	return previous, counted
+}
+
+// ImportFiles copies the entities of the file storage in dir into the store,
+// so switching a deployment to bolt keeps what it had stored. It runs only on
+// a store that is empty and was never imported into, and returns how many
+// entities it imported. The files are left as they are.
+func (bd *BoltDAO) ImportFiles(dir string) (int, error) {
+	pending := false
+	bd.db.View(func(tx *bolt.Tx) error {
+		first, _ := tx.Bucket(simiosBucket).Cursor().First()
+		pending = first == nil && tx.Bucket(metaBucket).Get(importedKey) == nil
+		return nil
+	})
+
+	if !pending {
+		return 0, nil
+	}
+
+	data, _, err := LoadAll(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	err = bd.update(func(tx *bolt.Tx, counts *Counts) error {
+		for id, entity := range data {
+			if err := putEntity(tx, entity, counts); err != nil {
+				return err
+			}
+			if _, stillStored := data[entity.PreviousID]; entity.PreviousID != "" && !stillStored {
+				if err := tx.Bucket(aliasesBucket).Put([]byte(entity.PreviousID), []byte(id)); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Bucket(metaBucket).Put(importedKey, []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+
+	if err != nil {
+		log.Printf("Error on importing files in bolt. Details: %s", err)
+		return 0, fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return len(data), nil
+}
+
+func (bd *BoltDAO) Close() error {
+	return bd.db.Close()
+}
+
+// update runs fn in a write transaction along with the counters, which are
+// saved with the changes fn makes.
+func (bd *BoltDAO) update(fn func(tx *bolt.Tx, counts *Counts) error) error {
+	err := bd.db.Update(func(tx *bolt.Tx) error {
+		counts := readCounts(tx)
+
+		if err := fn(tx, &counts); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(counts)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(metaBucket).Put(countsKey, value); err != nil {
+			return err
+		}
+
+		bd.storeCounts(counts)
+		return nil
+	})
+
+	if err != nil {
+		// The counters may have been stored before the commit failed.
+		bd.db.View(func(tx *bolt.Tx) error {
+			bd.storeCounts(readCounts(tx))
+			return nil
+		})
+	}
+	return err
+}
+
+func (bd *BoltDAO) storeCounts(counts Counts) {
+	atomic.StoreInt64(&bd.simians, int64(counts.Simians))
+	atomic.StoreInt64(&bd.humans, int64(counts.Humans))
+}
+
+func (bd *BoltDAO) forEach(fn func(entity SimioEntity)) {
+	err := bd.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(simiosBucket).ForEach(func(id []byte, value []byte) error {
+			var entity SimioEntity
+			if err := json.Unmarshal(value, &entity); err != nil {
+				log.Printf("Error on loading entity %s from bolt. Details: %s", id, err)
+				return nil
+			}
+			fn(entity)
+			return nil
+		})
+	})
+
+	if err != nil {
+		log.Printf("Error on reading entities from bolt. Details: %s", err)
+	}
+}
+
+func (counts *Counts) add(entity SimioEntity, delta int) {
+	if entity.IsSimian {
+		counts.Simians += delta
+	} else {
+		counts.Humans += delta
+	}
+}
+
+func putEntity(tx *bolt.Tx, entity SimioEntity, counts *Counts) error {
+	value, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(simiosBucket).Put([]byte(entity.ID), value); err != nil {
+		return err
+	}
+	counts.add(entity, 1)
+	return nil
+}
+
+func deleteEntity(tx *bolt.Tx, entity SimioEntity, counts *Counts) error {
+	if err := tx.Bucket(simiosBucket).Delete([]byte(entity.ID)); err != nil {
+		return err
+	}
+	counts.add(entity, -1)
+	return nil
+}
+
+// getEntity finds the entity by its ID, or by the ID it had before a
+// migration.
+func getEntity(tx *bolt.Tx, id string) (SimioEntity, bool) {
+	entity, found := readEntity(tx, id)
+	if !found {
+		if newID := tx.Bucket(aliasesBucket).Get([]byte(id)); newID != nil {
+			entity, found = readEntity(tx, string(newID))
+		}
+	}
+	return entity, found
+}
+
+func readEntity(tx *bolt.Tx, id string) (SimioEntity, bool) {
+	var entity SimioEntity
+
+	value := tx.Bucket(simiosBucket).Get([]byte(id))
+	if value == nil {
+		return entity, false
+	}
+
+	if err := json.Unmarshal(value, &entity); err != nil {
+		log.Printf("Error on loading entity %s from bolt. Details: %s", id, err)
+		return entity, false
+	}
+	return entity, true
+}
+
+func readCounts(tx *bolt.Tx) Counts {
+	var counts Counts
+
+	if value := tx.Bucket(metaBucket).Get(countsKey); value != nil {
+		json.Unmarshal(value, &counts)
+	}
+	return counts
+}
+
+func getBoltPath() string {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		log.Printf("%s", err)
+	}
+
+	return currentDir + "/database/data/simios.db"
+}
+
+func NewBoltDAO(path string) (*BoltDAO, error) {
+	createDirIfNotExist(filepath.Dir(path))
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	boltDAO := &BoltDAO{db: db}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{simiosBucket, aliasesBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+
+		boltDAO.storeCounts(readCounts(tx))
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	counts := boltDAO.Counts()
+	log.Printf("Bolt store %s opened. simians = %v, humans = %v", path, counts.Simians, counts.Humans)
+
+	return boltDAO, nil
+}
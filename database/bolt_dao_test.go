@@ -0,0 +1,46 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoltImportFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+	dir, _ := ioutil.TempDir("", "simio-bolt")
+	defer os.RemoveAll(dir)
+
+	saveEntityOnFile(getDefaultDirectory(), "111", SimioEntity{ID: "111", DNA: "CCCC|AGTC", IsSimian: true})
+	saveEntityOnFile(getDefaultDirectory(), "sha256_222", SimioEntity{ID: "sha256:222", DNA: "CCCC|AGTC", PreviousID: "222"})
+
+	boltDAO, err := NewBoltDAO(dir + "/simios.db")
+	assert.Nil(err)
+
+	imported, err := boltDAO.ImportFiles(getDefaultDirectory())
+	assert.Nil(err)
+	assert.Equal(2, imported)
+	assert.Equal(Counts{Simians: 1, Humans: 1}, boltDAO.Counts())
+
+	entity, found := boltDAO.Get("222")
+	assert.True(found)
+	assert.Equal("sha256:222", entity.ID)
+
+	// The store is imported into once, even if it is emptied later.
+	boltDAO.Delete("111")
+	boltDAO.Delete("sha256:222")
+	boltDAO.Close()
+
+	boltDAO, err = NewBoltDAO(dir + "/simios.db")
+	assert.Nil(err)
+	defer boltDAO.Close()
+
+	imported, err = boltDAO.ImportFiles(getDefaultDirectory())
+	assert.Nil(err)
+	assert.Equal(0, imported)
+	assert.Empty(boltDAO.Snapshot())
+}
@@ -0,0 +1,368 @@
+package database
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// daoBackend is a storage the conformance suite runs against. open is called
+// again on the same storage to check what was persisted.
+type daoBackend struct {
+	name    string
+	open    func(t *testing.T) DAO
+	cleanup func()
+}
+
+func fileBackend() daoBackend {
+	dir, _ := ioutil.TempDir("", "simio-file")
+
+	return daoBackend{
+		name: string(StorageFile),
+		open: func(t *testing.T) DAO {
+			return NewSimioDAO(dir + "/simios/")
+		},
+		cleanup: func() {
+			os.RemoveAll(dir)
+		},
+	}
+}
+
+func boltBackend() daoBackend {
+	dir, _ := ioutil.TempDir("", "simio-bolt")
+
+	return daoBackend{
+		name: string(StorageBolt),
+		open: func(t *testing.T) DAO {
+			boltDAO, err := NewBoltDAO(dir + "/simios.db")
+			if err != nil {
+				t.Fatalf("Error on opening bolt store. Details: %s", err)
+			}
+			return boltDAO
+		},
+		cleanup: func() {
+			os.RemoveAll(dir)
+		},
+	}
+}
+
+func logBackend() daoBackend {
+	dir, _ := ioutil.TempDir("", "simio-log")
+
+	return daoBackend{
+		name: string(StorageLog),
+		open: func(t *testing.T) DAO {
+			// Small segments, so the suite goes through several of them.
+			logDAO, err := NewLogDAO(dir+"/", LogSettings{SegmentSize: 512})
+			if err != nil {
+				t.Fatalf("Error on opening log. Details: %s", err)
+			}
+			return logDAO
+		},
+		cleanup: func() {
+			os.RemoveAll(dir)
+		},
+	}
+}
+
+func closeDAO(dao DAO) {
+	if closer, ok := dao.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// reopen compacts the DAO, when it is a backend that compacts, to check the
+// compacted data is the same, and opens it again.
+func reopen(t *testing.T, backend daoBackend, dao DAO) DAO {
+	if compacter, ok := dao.(interface{ Compact() error }); ok {
+		if err := compacter.Compact(); err != nil {
+			t.Fatalf("Error on compacting. Details: %s", err)
+		}
+	}
+	closeDAO(dao)
+	return backend.open(t)
+}
+
+var conformanceStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func conformanceEntity(id string, isSimian bool, second int) SimioEntity {
+	return SimioEntity{
+		ID:        id,
+		DNA:       "CCCC|AGTC",
+		IsSimian:  isSimian,
+		Rules:     "v2;size=4;min=1;overlap=disjoint",
+		Alphabet:  "dna",
+		CreatedAt: conformanceStart.Add(time.Duration(second) * time.Second),
+	}
+}
+
+func TestDAOConformance(t *testing.T) {
+	type Case struct {
+		name string
+		test func(t *testing.T, backend daoBackend)
+	}
+
+	cases := []Case{
+		Case{name: "SaveAndGet", test: testConformanceSaveAndGet},
+		Case{name: "SaveAll", test: testConformanceSaveAll},
+		Case{name: "Replace", test: testConformanceReplace},
+		Case{name: "ReplaceDeleted", test: testConformanceReplaceDeleted},
+		Case{name: "Delete", test: testConformanceDelete},
+		Case{name: "List", test: testConformanceList},
+		Case{name: "Counts", test: testConformanceCounts},
+		Case{name: "RecountDrift", test: testConformanceRecountDrift},
+	}
+
+	for _, backend := range []daoBackend{fileBackend(), boltBackend(), logBackend()} {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			for _, c := range cases {
+				t.Run(c.name, func(t *testing.T) {
+					defer backend.cleanup()
+					c.test(t, backend)
+				})
+			}
+		})
+	}
+}
+
+func testConformanceSaveAndGet(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	entity := conformanceEntity("sha256:111", true, 0)
+	inserted, err := dao.Save(entity)
+	assert.Nil(err)
+	assert.True(inserted)
+
+	duplicate := entity
+	duplicate.IsSimian = false
+	inserted, err = dao.Save(duplicate)
+	assert.Nil(err)
+	assert.False(inserted)
+
+	found, hasEntity := dao.Get(entity.ID)
+	assert.True(hasEntity)
+	assert.Equal(entity, found)
+
+	_, hasEntity = dao.Get("222")
+	assert.False(hasEntity)
+
+	dao = reopen(t, backend, dao)
+
+	found, hasEntity = dao.Get(entity.ID)
+	assert.True(hasEntity)
+	assert.Equal(entity, found)
+	assert.Equal([]SimioEntity{entity}, dao.Snapshot())
+}
+
+func testConformanceSaveAll(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	existing := conformanceEntity("111", true, 0)
+	assert.True(dao.Save(existing))
+
+	changed := existing
+	changed.IsSimian = false
+	inserted, err := dao.SaveAll([]SimioEntity{changed, conformanceEntity("222", false, 1), conformanceEntity("333", true, 2)})
+	assert.Nil(err)
+	assert.Equal([]string{"222", "333"}, entityIDs(inserted))
+
+	inserted, err = dao.SaveAll(nil)
+	assert.Nil(err)
+	assert.Empty(inserted)
+
+	found, _ := dao.Get("111")
+	assert.True(found.IsSimian)
+	assert.Equal(3, len(dao.Snapshot()))
+
+	dao = reopen(t, backend, dao)
+	assert.Equal(3, len(dao.Snapshot()))
+}
+
+func testConformanceReplace(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	legacy := conformanceEntity("111", true, 0)
+	assert.True(dao.Save(legacy))
+
+	migrated := legacy
+	migrated.ID = "sha256:111"
+	assert.Nil(dao.Replace(legacy.ID, migrated))
+
+	expected := migrated
+	expected.PreviousID = legacy.ID
+
+	for reopened := 0; reopened < 2; reopened++ {
+		found, hasEntity := dao.Get(legacy.ID)
+		assert.True(hasEntity)
+		assert.Equal(expected, found)
+
+		found, hasEntity = dao.Get(migrated.ID)
+		assert.True(hasEntity)
+		assert.Equal(expected, found)
+
+		assert.Equal([]SimioEntity{expected}, dao.Snapshot())
+		assert.Equal(Counts{Simians: 1}, dao.Counts())
+
+		dao = reopen(t, backend, dao)
+	}
+}
+
+func testConformanceReplaceDeleted(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	legacy := conformanceEntity("111", true, 0)
+	assert.True(dao.Save(legacy))
+	deleted, err := dao.Delete(legacy.ID)
+	assert.True(deleted)
+	assert.Nil(err)
+
+	migrated := legacy
+	migrated.ID = "sha256:111"
+	assert.Nil(dao.Replace(legacy.ID, migrated))
+
+	for reopened := 0; reopened < 2; reopened++ {
+		_, hasEntity := dao.Get(legacy.ID)
+		assert.False(hasEntity)
+		_, hasEntity = dao.Get(migrated.ID)
+		assert.False(hasEntity)
+
+		assert.Equal(0, len(dao.Snapshot()))
+		assert.Equal(Counts{}, dao.Counts())
+
+		dao = reopen(t, backend, dao)
+	}
+}
+
+func testConformanceDelete(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	_, err := dao.SaveAll([]SimioEntity{conformanceEntity("111", true, 0), conformanceEntity("222", false, 1)})
+	assert.Nil(err)
+	assert.Nil(dao.Replace("111", conformanceEntity("sha256:111", true, 0)))
+
+	deleted, err := dao.Delete("111")
+	assert.Nil(err)
+	assert.True(deleted)
+
+	deleted, err = dao.Delete("sha256:111")
+	assert.Nil(err)
+	assert.False(deleted)
+
+	_, hasEntity := dao.Get("111")
+	assert.False(hasEntity)
+
+	dao = reopen(t, backend, dao)
+
+	_, hasEntity = dao.Get("111")
+	assert.False(hasEntity)
+	_, hasEntity = dao.Get("sha256:111")
+	assert.False(hasEntity)
+	assert.Equal([]SimioEntity{conformanceEntity("222", false, 1)}, dao.Snapshot())
+}
+
+func testConformanceList(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	_, err := dao.SaveAll([]SimioEntity{
+		conformanceEntity("aaa", true, 2),
+		conformanceEntity("bbb", false, 0),
+		conformanceEntity("ccc", true, 0),
+		conformanceEntity("ddd", false, 1),
+	})
+	assert.Nil(err)
+
+	page := dao.List(ListQuery{Limit: 3})
+	assert.Equal([]string{"bbb", "ccc", "ddd"}, entityIDs(page.Entities))
+	assert.True(page.HasMore)
+
+	last := page.Entities[len(page.Entities)-1]
+	page = dao.List(ListQuery{Limit: 3, AfterCreatedAt: last.CreatedAt, AfterID: last.ID})
+	assert.Equal([]string{"aaa"}, entityIDs(page.Entities))
+	assert.False(page.HasMore)
+
+	simian := true
+	page = dao.List(ListQuery{IsSimian: &simian, Descending: true})
+	assert.Equal([]string{"aaa", "ccc"}, entityIDs(page.Entities))
+}
+
+func testConformanceCounts(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	assert.Equal(Counts{}, dao.Counts())
+
+	assert.True(dao.Save(conformanceEntity("111", true, 0)))
+	_, err := dao.SaveAll([]SimioEntity{conformanceEntity("111", true, 0), conformanceEntity("222", false, 1), conformanceEntity("333", false, 2)})
+	assert.Nil(err)
+	assert.Nil(dao.Replace("222", conformanceEntity("sha256:222", false, 1)))
+	dao.Delete("333")
+
+	assert.Equal(Counts{Simians: 1, Humans: 1}, dao.Counts())
+
+	dao = reopen(t, backend, dao)
+	assert.Equal(Counts{Simians: 1, Humans: 1}, dao.Counts())
+
+	previous, counted := dao.Recount()
+	assert.Equal(previous, counted)
+	assert.Equal(Counts{Simians: 1, Humans: 1}, counted)
+}
+
+// driftCounts moves the DAO counters away from the stored entities, as a bug
+// in keeping them would.
+func driftCounts(dao DAO, simians int64) {
+	switch counted := dao.(type) {
+	case *SimioDAO:
+		atomic.AddInt64(&counted.simians, simians)
+	case *BoltDAO:
+		atomic.AddInt64(&counted.simians, simians)
+	case *LogDAO:
+		atomic.AddInt64(&counted.simians, simians)
+	}
+}
+
+func testConformanceRecountDrift(t *testing.T, backend daoBackend) {
+	assert := assert.New(t)
+
+	dao := backend.open(t)
+	defer func() { closeDAO(dao) }()
+
+	_, err := dao.SaveAll([]SimioEntity{conformanceEntity("111", true, 0), conformanceEntity("222", false, 1)})
+	assert.Nil(err)
+
+	driftCounts(dao, 5)
+	assert.Equal(Counts{Simians: 6, Humans: 1}, dao.Counts())
+
+	previous, counted := dao.Recount()
+	assert.Equal(Counts{Simians: 6, Humans: 1}, previous)
+	assert.Equal(Counts{Simians: 1, Humans: 1}, counted)
+	assert.Equal(counted, dao.Counts())
+
+	dao = reopen(t, backend, dao)
+	assert.Equal(counted, dao.Counts())
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// DeadLetter is a webhook delivery that failed on every attempt.
+type DeadLetter struct {
+	ID        string
+	URL       string
+	Payload   json.RawMessage
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
+
+type DeadLetterDAO interface {
+	Save(deadLetter DeadLetter) error
+}
+
+type FileDeadLetterDAO struct {
+	dir string
+}
+
+func (dd *FileDeadLetterDAO) Save(deadLetter DeadLetter) error {
+	createDirIfNotExist(dd.dir)
+
+	err := save(dd.dir+deadLetter.ID, deadLetter)
+
+	if err != nil {
+		log.Printf("Error on saving dead letter in file. Details: %s", err)
+		return fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return nil
+}
+
+func getDeadLettersDirectory() string {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		log.Printf("%s", err)
+	}
+
+	return currentDir + "/database/data/webhooks/dead/"
+}
+
+func BuildDeadLetterDAO() DeadLetterDAO {
+	return NewFileDeadLetterDAO(getDeadLettersDirectory())
+}
+
+func NewFileDeadLetterDAO(dir string) DeadLetterDAO {
+	return &FileDeadLetterDAO{
+		dir: dir,
+	}
+}
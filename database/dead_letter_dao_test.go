@@ -0,0 +1,32 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterDAO(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	deadLetter := DeadLetter{
+		ID:        "abc",
+		URL:       "http://localhost:9999/hook",
+		Payload:   json.RawMessage(`{"event":"job.finished"}`),
+		Attempts:  5,
+		LastError: "connection refused",
+		FailedAt:  time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	assert.Nil(BuildDeadLetterDAO().Save(deadLetter))
+
+	var saved DeadLetter
+	assert.Nil(load(getDeadLettersDirectory()+"abc", &saved))
+	assert.Equal(deadLetter.URL, saved.URL)
+	assert.Equal(5, saved.Attempts)
+	assert.JSONEq(`{"event":"job.finished"}`, string(saved.Payload))
+}
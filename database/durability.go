@@ -0,0 +1,214 @@
+package database
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"simio-api/config"
+	"sync"
+	"time"
+)
+
+// Durability is how much a file write is synced to disk before returning.
+type Durability string
+
+const (
+	// DurabilityNone leaves syncing to the OS. A crash never leaves a
+	// half-written file, but may lose the last writes.
+	DurabilityNone Durability = "none"
+	// DurabilityAlways syncs every write, and its directory.
+	DurabilityAlways Durability = "always"
+	// DurabilityGroup commits the writes of each interval together. Every file
+	// is still synced, but each directory is synced once per interval. Writers
+	// wait for their group, so nothing returned is lost.
+	DurabilityGroup Durability = "group"
+)
+
+const defaultGroupInterval = 10 * time.Millisecond
+
+var writer = buildFileWriter()
+
+type fileWrite struct {
+	path  string
+	value interface{}
+}
+
+// pendingWrite is a temporary file waiting for the group sync to be renamed
+// to its path.
+type pendingWrite struct {
+	file *os.File
+	path string
+	done chan error
+}
+
+// fileWriter writes each file to a temporary one in the same directory, then
+// renames it over the path, so readers and crashes see either the old or the
+// new file, never part of it.
+type fileWriter struct {
+	durability Durability
+	interval   time.Duration
+	lock       sync.Mutex
+	pending    []pendingWrite
+	start      sync.Once
+}
+
+// write writes the files in order. It returns how many were written before
+// an error.
+func (fw *fileWriter) write(writes ...fileWrite) (int, error) {
+	if fw.durability == DurabilityGroup {
+		return fw.writeGroup(writes)
+	}
+
+	dirs := make(map[string]bool)
+	for written, w := range writes {
+		file, err := writeTemp(w)
+		if err != nil {
+			return written, err
+		}
+
+		if err := fw.commit(file, w.path); err != nil {
+			return written, err
+		}
+		dirs[filepath.Dir(w.path)] = true
+	}
+
+	return len(writes), fw.syncDirs(dirs)
+}
+
+func (fw *fileWriter) writeGroup(writes []fileWrite) (int, error) {
+	fw.start.Do(func() {
+		go fw.syncGroups()
+	})
+
+	var pending []pendingWrite
+	var err error
+	for _, w := range writes {
+		var file *os.File
+		if file, err = writeTemp(w); err != nil {
+			break
+		}
+		pending = append(pending, pendingWrite{file: file, path: w.path, done: make(chan error, 1)})
+	}
+
+	fw.lock.Lock()
+	fw.pending = append(fw.pending, pending...)
+	fw.lock.Unlock()
+
+	for written, p := range pending {
+		if groupErr := <-p.done; groupErr != nil {
+			return written, groupErr
+		}
+	}
+	return len(pending), err
+}
+
+// syncGroups syncs and renames the pending writes on each interval, then
+// syncs the directories they went to once.
+func (fw *fileWriter) syncGroups() {
+	ticker := time.NewTicker(fw.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		fw.lock.Lock()
+		pending := fw.pending
+		fw.pending = nil
+		fw.lock.Unlock()
+
+		if len(pending) == 0 {
+			continue
+		}
+
+		errs := make([]error, len(pending))
+		dirs := make(map[string]bool)
+		for i, p := range pending {
+			if errs[i] = fw.commit(p.file, p.path); errs[i] == nil {
+				dirs[filepath.Dir(p.path)] = true
+			}
+		}
+
+		dirErr := fw.syncDirs(dirs)
+		for i, p := range pending {
+			if errs[i] == nil {
+				errs[i] = dirErr
+			}
+			p.done <- errs[i]
+		}
+	}
+}
+
+// commit syncs the temporary file, unless durability is none, and renames it
+// to its path.
+func (fw *fileWriter) commit(file *os.File, path string) error {
+	var err error
+	if fw.durability != DurabilityNone {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (fw *fileWriter) syncDirs(dirs map[string]bool) error {
+	if fw.durability == DurabilityNone {
+		return nil
+	}
+
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTemp(w fileWrite) (*os.File, error) {
+	file, err := ioutil.TempFile(filepath.Dir(w.path), filepath.Base(w.path)+".*"+tempSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := marshal(w.value)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+func buildFileWriter() *fileWriter {
+	return newFileWriter(
+		Durability(config.String("SIMIO_FSYNC", string(DurabilityAlways))),
+		config.Duration("SIMIO_FSYNC_INTERVAL", defaultGroupInterval),
+	)
+}
+
+func newFileWriter(durability Durability, interval time.Duration) *fileWriter {
+	if durability != DurabilityNone && durability != DurabilityAlways && durability != DurabilityGroup {
+		log.Printf("Unknown durability %s. Using %s", durability, DurabilityAlways)
+		durability = DurabilityAlways
+	}
+	if interval <= 0 {
+		interval = defaultGroupInterval
+	}
+
+	return &fileWriter{
+		durability: durability,
+		interval:   interval,
+	}
+}
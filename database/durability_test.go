@@ -0,0 +1,135 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		durability Durability
+	}
+
+	cases := []Case{
+		Case{durability: DurabilityNone},
+		Case{durability: DurabilityAlways},
+		Case{durability: DurabilityGroup},
+		Case{durability: "unknown"},
+	}
+
+	for _, c := range cases {
+		dir, _ := ioutil.TempDir("", "simio-writer")
+		fileWriter := newFileWriter(c.durability, time.Millisecond)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				written, err := fileWriter.write(
+					fileWrite{path: fmt.Sprintf("%s/%d-a", dir, i), value: SimioEntity{ID: fmt.Sprint(i)}},
+					fileWrite{path: fmt.Sprintf("%s/%d-b", dir, i), value: SimioEntity{ID: fmt.Sprint(i)}},
+				)
+				assert.Equal(2, written)
+				assert.Nil(err)
+			}(i)
+		}
+		wg.Wait()
+
+		files, _ := ioutil.ReadDir(dir)
+		assert.Equal(20, len(files), "durability %s", c.durability)
+
+		var entity SimioEntity
+		assert.Nil(load(dir+"/3-b", &entity))
+		assert.Equal("3", entity.ID)
+
+		written, err := fileWriter.write(
+			fileWrite{path: dir + "/ok", value: SimioEntity{ID: "ok"}},
+			fileWrite{path: dir + "/missing/fail", value: SimioEntity{ID: "fail"}},
+		)
+		assert.Equal(1, written)
+		assert.NotNil(err)
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLoadAllQuarantine(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	dir := getDefaultDirectory()
+	saveEntityOnFile(getDefaultDirectory(), "111", SimioEntity{ID: "111", IsSimian: true})
+	ioutil.WriteFile(dir+"222", []byte(`{"ID": "222", "DNA": "CC`), 0644)
+	ioutil.WriteFile(dir+"333", []byte(`{}`), 0644)
+	ioutil.WriteFile(dir+"444.123"+tempSuffix, []byte(`{"ID": "444"}`), 0644)
+	os.MkdirAll(dir+"nested", 0755)
+
+	data, counts, err := LoadAll(dir)
+
+	assert.Nil(err)
+	assert.Equal(1, len(data))
+	assert.Equal(Counts{Simians: 1}, counts)
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(2, len(files))
+
+	quarantined, _ := ioutil.ReadDir(getQuarantineDirectory(dir))
+	assert.Equal(2, len(quarantined))
+}
+
+func TestGroupSavesWaitTogether(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	interval := 100 * time.Millisecond
+	previous := writer
+	writer = newFileWriter(DurabilityGroup, interval)
+	defer func() {
+		writer = previous
+	}()
+
+	simioDAO := NewSimioDAO(getDefaultDirectory())
+	saves := 20
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				assert.True(simioDAO.Save(SimioEntity{ID: fmt.Sprint(i)}))
+			} else {
+				inserted, err := simioDAO.SaveAll([]SimioEntity{SimioEntity{ID: fmt.Sprint(i)}})
+				assert.Nil(err)
+				assert.Equal(1, len(inserted))
+			}
+		}(i)
+	}
+
+	// Readers do not wait for the saves to be synced.
+	time.Sleep(interval / 10)
+	readStart := time.Now()
+	simioDAO.Get("0")
+	simioDAO.Snapshot()
+	assert.True(time.Since(readStart) < interval/2, "reads waited for the saves")
+
+	wg.Wait()
+
+	// Saves holding the lock while they wait would take an interval each.
+	elapsed := time.Since(start)
+	assert.True(elapsed < 3*interval, "%d saves took %s", saves, elapsed)
+	assert.Equal(saves, len(simioDAO.Snapshot()))
+	assert.Equal(Counts{Humans: saves}, simioDAO.Counts())
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEntityStored is returned when rewriting an entity to the file its ID maps
+// to, and that file holds it already.
+var ErrEntityStored = fmt.Errorf("Entity is already stored under its ID")
+
+// EntityFile is a file found in the data directory. Err says why it does not
+// hold a valid entity.
+type EntityFile struct {
+	Path   string
+	Entity SimioEntity
+	Err    error
+	dir    string
+}
+
+// InPlace tells whether the file is where its entity's ID maps to, in the
+// shard directories or, before the layout migration moved it, in the data
+// directory itself.
+func (ef EntityFile) InPlace() bool {
+	filename := fileNameFor(ef.Entity.ID)
+	path := filepath.Clean(ef.Path)
+
+	return path == filepath.Clean(entityPath(ef.dir, filename)) || path == filepath.Clean(ef.dir+filename)
+}
+
+// DataDirectory is where the file storage keeps the entities.
+func DataDirectory() string {
+	return getDefaultDirectory()
+}
+
+// WalkEntityFiles calls fn with every file in dir and its shard directories.
+// Files are decoded strictly: unknown fields, trailing data and a missing ID
+// or DNA are errors.
+func WalkEntityFiles(dir string, fn func(file EntityFile)) error {
+	root := filepath.Clean(dir)
+	dir = root + "/"
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, tempSuffix) {
+			fn(EntityFile{Path: path, Err: fmt.Errorf("Temporary file left by an interrupted write"), dir: dir})
+			return nil
+		}
+
+		entity, err := decodeEntityFile(path)
+		fn(EntityFile{Path: path, Entity: entity, Err: err, dir: dir})
+		return nil
+	})
+}
+
+func decodeEntityFile(path string) (SimioEntity, error) {
+	var entity SimioEntity
+
+	f, err := os.Open(path)
+	if err != nil {
+		return entity, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&entity); err != nil {
+		return entity, fmt.Errorf("Invalid entity JSON. Details: %s", err)
+	}
+	if decoder.More() {
+		return entity, fmt.Errorf("Invalid entity JSON. Data after the entity")
+	}
+
+	if entity.ID == "" {
+		return entity, fmt.Errorf("Entity has no ID")
+	}
+	if entity.DNA == "" {
+		return entity, fmt.Errorf("Entity has no DNA")
+	}
+	return entity, nil
+}
+
+// RewriteEntityFile saves entity under the file its ID maps to in dir, and
+// removes path when it is another file. It returns ErrEntityStored if the
+// entity is stored in another file already, in either layout.
+func RewriteEntityFile(dir string, path string, entity SimioEntity) error {
+	dir = filepath.Clean(dir) + "/"
+	filename := fileNameFor(entity.ID)
+
+	target, found := findEntityFile(dir, filename)
+	if !found {
+		target = entityPath(dir, filename)
+	} else if filepath.Clean(target) != filepath.Clean(path) {
+		return ErrEntityStored
+	}
+
+	if err := createShardDir(target); err != nil {
+		return err
+	}
+	if err := save(target, entity); err != nil {
+		return err
+	}
+
+	if filepath.Clean(target) != filepath.Clean(path) {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+// QuarantineFile moves a file out of dir as loading does with corrupt files.
+func QuarantineFile(dir string, path string, reason error) error {
+	return quarantine(dir, path, reason)
+}
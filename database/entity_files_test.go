@@ -0,0 +1,96 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalkEntityFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		content     string
+		expectedErr string
+	}
+
+	cases := []Case{
+		Case{content: `{"ID": "111", "DNA": "CCCC|AGTC", "IsSimian": true}`},
+		Case{content: `{"ID": "111", "DNA": "CCCC|AGTC", "Extra": 1}`, expectedErr: "Invalid entity JSON. Details: json: unknown field \"Extra\""},
+		Case{content: `{"ID": "111", "DNA": "CCCC|AGTC"} {}`, expectedErr: "Invalid entity JSON. Data after the entity"},
+		Case{content: `{"ID": "111", "IsSimian": "yes"}`, expectedErr: "Invalid entity JSON. Details: json: cannot unmarshal string into Go struct field SimioEntity.IsSimian of type bool"},
+		Case{content: `{"DNA": "CCCC|AGTC"}`, expectedErr: "Entity has no ID"},
+		Case{content: `{"ID": "111"}`, expectedErr: "Entity has no DNA"},
+	}
+
+	for _, c := range cases {
+		dir, _ := ioutil.TempDir("", "simio-walk")
+		ioutil.WriteFile(dir+"/111", []byte(c.content), 0644)
+
+		var files []EntityFile
+		assert.Nil(WalkEntityFiles(dir+"/", func(file EntityFile) {
+			files = append(files, file)
+		}))
+
+		assert.Equal(1, len(files))
+		assert.Equal(dir+"/111", files[0].Path)
+		if c.expectedErr == "" {
+			assert.Nil(files[0].Err)
+			assert.Equal(SimioEntity{ID: "111", DNA: "CCCC|AGTC", IsSimian: true}, files[0].Entity)
+			assert.True(files[0].InPlace())
+		} else {
+			assert.Equal(c.expectedErr, files[0].Err.Error())
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRewriteEntityFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "simio-rewrite")
+	defer os.RemoveAll(dir)
+
+	entity := SimioEntity{ID: "sha256:111", DNA: "CCCC|AGTC"}
+	ioutil.WriteFile(dir+"/misnamed", []byte(`{}`), 0644)
+	ioutil.WriteFile(dir+"/copy", []byte(`{}`), 0644)
+
+	assert.Nil(RewriteEntityFile(dir, dir+"/misnamed", entity))
+	assert.Equal(ErrEntityStored, RewriteEntityFile(dir, dir+"/copy", entity))
+
+	entity.IsSimian = true
+	assert.Nil(RewriteEntityFile(dir, dir+"/sha256_111", entity))
+
+	var saved SimioEntity
+	assert.Nil(load(dir+"/sha256_111", &saved))
+	assert.Equal(entity, saved)
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(2, len(files))
+}
+
+func TestEntityFileInPlace(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		path     string
+		expected bool
+	}
+
+	cases := []Case{
+		Case{path: "data/ab/cd/sha256_abcdef", expected: true},
+		Case{path: "data/sha256_abcdef", expected: true},
+		Case{path: "data/ab/sha256_abcdef", expected: false},
+		Case{path: "data/ab/cd/abcdef", expected: false},
+	}
+
+	withShardDepth(2, func() {
+		for _, c := range cases {
+			file := EntityFile{Path: c.path, Entity: SimioEntity{ID: "sha256:abcdef"}, dir: "data/"}
+			assert.Equal(c.expected, file.InPlace(), c.path)
+		}
+	})
+}
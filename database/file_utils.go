@@ -8,17 +8,26 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 )
 
+// tempSuffix ends the name of the files being written, before they are
+// renamed to their path.
+const tempSuffix = ".tmp"
+
 var lock sync.Mutex
 
-func saveEntityOnFile(filename string, object interface{}) error {
-	createDirIfNotExist(getDefaultDirectory())
+func saveEntityOnFile(dir string, filename string, object interface{}) error {
+	createDirIfNotExist(dir)
 
-	filePath := getDefaultDirectory() + filename
+	filePath := entityPath(dir, filename)
 
-	err := save(filePath, object)
+	err := createShardDir(filePath)
+	if err == nil {
+		err = save(filePath, object)
+	}
 
 	if err != nil {
 		log.Printf("Error on saving entity in file. Details: %s", err)
@@ -29,6 +38,38 @@ func saveEntityOnFile(filename string, object interface{}) error {
 	return nil
 }
 
+// saveEntitiesOnFiles writes a file per entity in dir and syncs them as the
+// durability setting says, so the whole batch is on disk when it returns. It
+// reports how many entities were saved before any error.
+func saveEntitiesOnFiles(dir string, entities []SimioEntity) (int, error) {
+	createDirIfNotExist(dir)
+
+	writes := make([]fileWrite, len(entities))
+	for i, entity := range entities {
+		writes[i] = fileWrite{path: entityPath(dir, fileNameFor(entity.ID)), value: entity}
+	}
+
+	var err error
+	for _, w := range writes {
+		if err = createShardDir(w.path); err != nil {
+			break
+		}
+	}
+
+	saved := 0
+	if err == nil {
+		saved, err = writer.write(writes...)
+	}
+
+	if err != nil {
+		log.Printf("Error on saving entity in file. Details: %s", err)
+		return saved, fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	log.Printf("Batch of %d entities has been saved successfully", len(entities))
+
+	return len(entities), nil
+}
+
 func createDefaultDirectory() {
 	createDirIfNotExist(getDefaultDirectory())
 }
@@ -51,57 +92,102 @@ func getDefaultDirectory() string {
 	return currentDir + "/database/data/simios/"
 }
 
-func LoadAll(dir string) (map[string]SimioEntity, error) {
+// LoadAll reads every entity saved in dir, in its shard directories or not,
+// and counts the simian and human ones. Files that are not a valid entity are
+// moved to the quarantine directory next to dir, and temporary files a crash
+// left are removed.
+func LoadAll(dir string) (map[string]SimioEntity, Counts, error) {
 	var files []string
 
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(path, tempSuffix) {
+			log.Printf("Removing %s, left by an interrupted write", path)
+			os.Remove(path)
+			return nil
+		}
+
 		files = append(files, path)
 		return nil
 	})
 
 	if err != nil {
 		log.Printf("Error on loading entity in file. Details: %s", err)
-		return nil, fmt.Errorf("UNEXPECTED_ERROR_ON_LOAD")
+		return nil, Counts{}, fmt.Errorf("UNEXPECTED_ERROR_ON_LOAD")
 	}
 
-	if len(files) > 1 {
+	if len(files) > 0 {
 
-		simios := make([]SimioEntity, len(files)-1)
+		data := make(map[string]SimioEntity)
 
-		for current := 1; current < len(files); current++ {
-			load(files[current], &simios[current-1])
-		}
+		for _, file := range files {
+			var simio SimioEntity
 
-		data := make(map[string]SimioEntity)
+			if err := load(file, &simio); err != nil || simio.ID == "" {
+				quarantine(dir, file, err)
+				continue
+			}
+
+			// Files saved before entities had a creation time use the
+			// file's modification time instead.
+			if info, err := os.Stat(file); err == nil && simio.CreatedAt.IsZero() {
+				simio.CreatedAt = info.ModTime().UTC()
+			}
 
-		for _, simio := range simios {
 			data[simio.ID] = simio
 		}
 
-		log.Printf("Files Loaded successfully. DB Size = %v", len(data))
+		counts := countEntities(data)
+
+		log.Printf("Files Loaded successfully. DB Size = %v, simians = %v, humans = %v", len(data), counts.Simians, counts.Humans)
 
-		return data, nil
+		return data, counts, nil
 	}
 
 	log.Printf("No files found to be loaded")
 
-	return nil, nil
+	return nil, Counts{}, nil
 }
 
-func save(path string, v interface{}) error {
-	lock.Lock()
-	defer lock.Unlock()
-	f, err := os.Create(path)
+// quarantine moves a corrupt file out of the data directory, keeping it for
+// inspection.
+func quarantine(dir string, path string, reason error) error {
+	if reason == nil {
+		reason = fmt.Errorf("Entity has no ID")
+	}
+
+	quarantineDir := getQuarantineDirectory(dir)
+	createDirIfNotExist(quarantineDir)
+
+	target := fmt.Sprintf("%s%s.%d", quarantineDir, filepath.Base(path), time.Now().UnixNano())
+	log.Printf("Quarantining %s to %s. Details: %s", path, target, reason)
+
+	err := os.Rename(path, target)
 	if err != nil {
-		return err
+		log.Printf("Error on quarantining %s. Details: %s", path, err)
 	}
-	defer f.Close()
-	r, err := marshal(v)
+	return err
+}
+
+func getQuarantineDirectory(dir string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(dir)), "quarantine") + "/"
+}
+
+func save(path string, v interface{}) error {
+	_, err := writer.write(fileWrite{path: path, value: v})
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(f, r)
-	return err
+	defer d.Close()
+	return d.Sync()
 }
 
 func load(path string, v interface{}) error {
@@ -127,10 +213,15 @@ var unmarshal = func(r io.Reader, v interface{}) error {
 	return json.NewDecoder(r).Decode(v)
 }
 
+// fileNameFor keeps the algorithm prefix of an ID, like "sha256:", out of
+// its file name, since ':' is not allowed in every file system.
+func fileNameFor(id string) string {
+	return strings.Replace(id, ":", "_", 1)
+}
+
+// checkFileExist tells whether the file is in the data directory, in either
+// layout.
 func checkFileExist(filename string) bool {
-	filePath := getDefaultDirectory() + filename
-	if _, err := os.Stat(filePath); err == nil {
-		return true
-	}
-	return false
+	_, found := findEntityFile(getDefaultDirectory(), filename)
+	return found
 }
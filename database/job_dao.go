@@ -0,0 +1,288 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobEntity is an asynchronous classification job. Its request and results
+// are kept as the JSON the service gives, so this package does not depend on
+// the service types.
+type JobEntity struct {
+	ID        string
+	Status    string
+	Request   json.RawMessage
+	Results   json.RawMessage
+	Error     string
+	Done      int
+	Total     int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type JobDAO interface {
+	// Create stores a new job with its request, which never changes after.
+	Create(job JobEntity) error
+	// Update appends results, a JSON array, to the ones the job has, and saves
+	// its status and progress. The job's Request and Results are not saved.
+	Update(job JobEntity, results json.RawMessage) error
+	GetAll() []JobEntity
+}
+
+// jobState is the part of a job that changes as it runs. ResultsSize is how
+// much of the results file the state accounts for: anything after it was
+// left by an append the state was never saved for.
+type jobState struct {
+	ID          string
+	Status      string
+	Error       string
+	Done        int
+	Total       int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ResultsSize int64
+}
+
+const (
+	jobRequestFile = "request"
+	jobStateFile   = "state"
+	jobResultsFile = "results"
+)
+
+// FileJobDAO keeps each job in a directory: its request, written once, its
+// state, rewritten on each update, and its results, appended a line per
+// update, so an update writes only what changed.
+type FileJobDAO struct {
+	dir   string
+	jobs  []JobEntity
+	lock  sync.Mutex
+	sizes map[string]int64
+}
+
+func (jd *FileJobDAO) Create(job JobEntity) error {
+	jobDir := jd.jobDir(job.ID)
+	createDirIfNotExist(jobDir)
+
+	err := save(jobDir+jobRequestFile, job.Request)
+	if err == nil {
+		err = save(jobDir+jobStateFile, newJobState(job, 0))
+	}
+
+	if err != nil {
+		log.Printf("Error on saving job in file. Details: %s", err)
+		return fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+
+	jd.lock.Lock()
+	jd.sizes[job.ID] = 0
+	jd.lock.Unlock()
+	return nil
+}
+
+// Update must not be called concurrently for the same job.
+func (jd *FileJobDAO) Update(job JobEntity, results json.RawMessage) error {
+	jd.lock.Lock()
+	size := jd.sizes[job.ID]
+	jd.lock.Unlock()
+
+	var err error
+	if len(results) > 0 {
+		size, err = appendResults(jd.jobDir(job.ID)+jobResultsFile, size, results)
+	}
+	if err == nil {
+		err = save(jd.jobDir(job.ID)+jobStateFile, newJobState(job, size))
+	}
+
+	if err != nil {
+		log.Printf("Error on saving job in file. Details: %s", err)
+		return fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+
+	jd.lock.Lock()
+	jd.sizes[job.ID] = size
+	jd.lock.Unlock()
+	return nil
+}
+
+// GetAll returns the jobs found on disk when the DAO was built.
+func (jd *FileJobDAO) GetAll() []JobEntity {
+	return jd.jobs
+}
+
+func (jd *FileJobDAO) jobDir(id string) string {
+	return jd.dir + id + "/"
+}
+
+func newJobState(job JobEntity, resultsSize int64) jobState {
+	return jobState{
+		ID:          job.ID,
+		Status:      job.Status,
+		Error:       job.Error,
+		Done:        job.Done,
+		Total:       job.Total,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+		ResultsSize: resultsSize,
+	}
+}
+
+// appendResults writes results as a line at offset size of the file, which
+// drops whatever a failed append left after it, and returns the new size.
+func appendResults(path string, size int64, results json.RawMessage) (int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return size, err
+	}
+	defer file.Close()
+
+	line := append(append([]byte{}, results...), '\n')
+
+	if err := file.Truncate(size); err != nil {
+		return size, err
+	}
+	if _, err := file.WriteAt(line, size); err != nil {
+		return size, err
+	}
+	if writer.durability != DurabilityNone {
+		if err := file.Sync(); err != nil {
+			return size, err
+		}
+		if size == 0 {
+			if err := syncDir(filepath.Dir(path)); err != nil {
+				return size, err
+			}
+		}
+	}
+	return size + int64(len(line)), nil
+}
+
+func getJobsDirectory() string {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		log.Printf("%s", err)
+	}
+
+	return currentDir + "/database/data/jobs/"
+}
+
+func (jd *FileJobDAO) loadJobs() {
+	files, err := ioutil.ReadDir(jd.dir)
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error on loading jobs. Details: %s", err)
+		}
+		return
+	}
+
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+
+		job, err := jd.loadJob(jd.jobDir(file.Name()))
+		if err != nil {
+			log.Printf("Ignoring invalid job %s. Details: %s", file.Name(), err)
+			continue
+		}
+		jd.jobs = append(jd.jobs, job)
+	}
+}
+
+func (jd *FileJobDAO) loadJob(jobDir string) (JobEntity, error) {
+	removeTempFiles(jobDir)
+
+	var state jobState
+	if err := load(jobDir+jobStateFile, &state); err != nil {
+		return JobEntity{}, err
+	}
+	if state.ID == "" {
+		return JobEntity{}, fmt.Errorf("Job has no ID")
+	}
+
+	request, err := ioutil.ReadFile(jobDir + jobRequestFile)
+	if err != nil {
+		return JobEntity{}, err
+	}
+
+	results, err := loadResults(jobDir+jobResultsFile, state.ResultsSize)
+	if err != nil {
+		return JobEntity{}, err
+	}
+
+	jd.sizes[state.ID] = state.ResultsSize
+
+	return JobEntity{
+		ID:        state.ID,
+		Status:    state.Status,
+		Request:   request,
+		Results:   results,
+		Error:     state.Error,
+		Done:      state.Done,
+		Total:     state.Total,
+		CreatedAt: state.CreatedAt,
+		UpdatedAt: state.UpdatedAt,
+	}, nil
+}
+
+// loadResults joins the result lines the state accounts for in a single JSON
+// array, and cuts off the rest of the file.
+func loadResults(path string, size int64) (json.RawMessage, error) {
+	if size == 0 {
+		os.Remove(path)
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < size {
+		return nil, fmt.Errorf("Results file is shorter than its saved size")
+	}
+	if int64(len(data)) > size {
+		if err := os.Truncate(path, size); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []json.RawMessage
+	for _, line := range bytes.Split(bytes.TrimSpace(data[:size]), []byte("\n")) {
+		var chunk []json.RawMessage
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, err
+		}
+		results = append(results, chunk...)
+	}
+	return json.Marshal(results)
+}
+
+func removeTempFiles(dir string) {
+	files, _ := ioutil.ReadDir(dir)
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), tempSuffix) {
+			os.Remove(filepath.Join(dir, file.Name()))
+		}
+	}
+}
+
+func BuildJobDAO() JobDAO {
+	return NewFileJobDAO(getJobsDirectory())
+}
+
+func NewFileJobDAO(dir string) JobDAO {
+	jobDAO := &FileJobDAO{
+		dir:   dir,
+		sizes: make(map[string]int64),
+	}
+	jobDAO.loadJobs()
+	return jobDAO
+}
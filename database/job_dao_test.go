@@ -0,0 +1,73 @@
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobDAO(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	jobDAO := BuildJobDAO()
+	assert.Empty(jobDAO.GetAll())
+
+	job := JobEntity{
+		ID:        "abc",
+		Status:    "queued",
+		Request:   json.RawMessage(`{"Items":[]}`),
+		Total:     3,
+		CreatedAt: time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	assert.Nil(jobDAO.Create(job))
+
+	job.Request = nil
+	job.Status = "running"
+	job.Done = 2
+	assert.Nil(jobDAO.Update(job, json.RawMessage(`[{"index":0},{"index":1}]`)))
+
+	job.Status = "done"
+	job.Done = 3
+	assert.Nil(jobDAO.Update(job, json.RawMessage(`[{"index":2}]`)))
+
+	jobs := BuildJobDAO().GetAll()
+	assert.Equal(1, len(jobs))
+	assert.Equal("done", jobs[0].Status)
+	assert.Equal(3, jobs[0].Done)
+	assert.True(job.CreatedAt.Equal(jobs[0].CreatedAt))
+	assert.JSONEq(`{"Items":[]}`, string(jobs[0].Request))
+	assert.JSONEq(`[{"index":0},{"index":1},{"index":2}]`, string(jobs[0].Results))
+}
+
+func TestJobDAOUnsavedResults(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	jobDAO := BuildJobDAO()
+	job := JobEntity{ID: "abc", Status: "running", Request: json.RawMessage(`{}`), Total: 3}
+	assert.Nil(jobDAO.Create(job))
+	assert.Nil(jobDAO.Update(job, json.RawMessage(`[{"index":0}]`)))
+
+	// A crash after appending results, but before saving the state, leaves
+	// results the state does not account for.
+	resultsPath := getJobsDirectory() + "abc/" + jobResultsFile
+	file, _ := os.OpenFile(resultsPath, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`[{"index":1}]` + "\n" + `[{"ind`)
+	file.Close()
+
+	jobDAO = BuildJobDAO()
+	jobs := jobDAO.GetAll()
+	assert.Equal(1, len(jobs))
+	assert.JSONEq(`[{"index":0}]`, string(jobs[0].Results))
+
+	assert.Nil(jobDAO.Update(job, json.RawMessage(`[{"index":1}]`)))
+	jobs = BuildJobDAO().GetAll()
+	assert.JSONEq(`[{"index":0},{"index":1}]`, string(jobs[0].Results))
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"simio-api/config"
+	"strings"
+)
+
+// maxShardDepth bounds SIMIO_SHARD_DEPTH. Each level fans out to 256
+// directories, so 4 levels are more than any store needs.
+const maxShardDepth = 4
+
+// migrateBatchSize is how many names of the data directory the layout
+// migration reads at a time.
+const migrateBatchSize = 1000
+
+// shardDepth is how many levels of directories the entity files are spread
+// in. Each level is named by the next two characters of the ID's hash, so
+// with 2 the file of "sha256:abcdef..." is "ab/cd/sha256_abcdef...". Zero
+// keeps every file in the data directory itself.
+var shardDepth = buildShardDepth()
+
+func buildShardDepth() int {
+	depth := config.Int("SIMIO_SHARD_DEPTH", 0)
+	if depth < 0 || depth > maxShardDepth {
+		log.Printf("Invalid shard depth %d. It has to be between 0 and %d. Using 0", depth, maxShardDepth)
+		return 0
+	}
+	return depth
+}
+
+// shardDirs returns the shard directories a file name goes in, like "ab/cd/".
+// Hashes too short for every level stop at the levels they fill.
+func shardDirs(filename string, depth int) string {
+	hash := filename[strings.Index(filename, "_")+1:]
+
+	var dirs string
+	for level := 0; level < depth && len(hash) >= 2*(level+1); level++ {
+		dirs += hash[2*level:2*level+2] + "/"
+	}
+	return dirs
+}
+
+// entityPath is where the file named filename is written in dir.
+func entityPath(dir string, filename string) string {
+	return dir + shardDirs(filename, shardDepth) + filename
+}
+
+// findEntityFile returns where the file named filename is in dir. Files the
+// layout migration has not moved yet are still in dir itself.
+func findEntityFile(dir string, filename string) (string, bool) {
+	paths := []string{entityPath(dir, filename)}
+	if shardDepth > 0 {
+		paths = append(paths, dir+filename)
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// removeEntityFile removes the file named filename from dir, in either layout.
+// The flat one goes first: the migration only moves files from it, so once
+// it is gone the sharded one cannot show up anymore.
+func removeEntityFile(dir string, filename string) error {
+	paths := []string{entityPath(dir, filename)}
+	if shardDepth > 0 {
+		paths = []string{dir + filename, paths[0]}
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// createShardDir creates the directory of path and, unless durability is
+// none, syncs the directories it was added to, so the files synced into it
+// are not lost with it on a crash.
+func createShardDir(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if writer.durability == DurabilityNone {
+		return nil
+	}
+
+	for level := 0; level < shardDepth; level++ {
+		dir = filepath.Dir(dir)
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateLayout moves the files left in the data directory into their shard
+// directories. It holds the lock for each file only, so the DAO keeps serving
+// while it runs, and lookups find the files in either place meanwhile.
+func (sDB *SimioDAO) MigrateLayout() (int, error) {
+	if shardDepth == 0 {
+		return 0, nil
+	}
+
+	dir := sDB.dir
+	d, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+
+	moved := 0
+	for {
+		names, err := d.Readdirnames(migrateBatchSize)
+
+		for _, name := range names {
+			done, moveErr := sDB.moveToShard(dir, name)
+			if moveErr != nil {
+				return moved, moveErr
+			}
+			if done {
+				moved++
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return moved, err
+		}
+	}
+
+	if writer.durability != DurabilityNone {
+		err = syncDir(dir)
+	}
+	return moved, err
+}
+
+// moveToShard moves the file name of dir to its shard directory, unless it is
+// a shard directory itself or a temporary file.
+func (sDB *SimioDAO) moveToShard(dir string, name string) (bool, error) {
+	target := entityPath(dir, name)
+	if strings.HasSuffix(name, tempSuffix) || target == dir+name {
+		return false, nil
+	}
+
+	sDB.lock.Lock()
+	defer sDB.lock.Unlock()
+
+	info, err := os.Lstat(dir + name)
+	if os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		log.Printf("Leaving %s in place, since %s exists already", dir+name, target)
+		return false, nil
+	}
+
+	if err := createShardDir(target); err != nil {
+		return false, fmt.Errorf("Error on creating the shard directory of %s. Details: %s", name, err)
+	}
+
+	if err := os.Rename(dir+name, target); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if writer.durability != DurabilityNone {
+		err = syncDir(filepath.Dir(target))
+	}
+	return err == nil, err
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withShardDepth runs fn with the files sharded depth levels deep.
+func withShardDepth(depth int, fn func()) {
+	previous := shardDepth
+	shardDepth = depth
+	defer func() {
+		shardDepth = previous
+	}()
+	fn()
+}
+
+func TestEntityPath(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		depth        int
+		filename     string
+		expectedPath string
+	}
+
+	cases := []Case{
+		Case{depth: 0, filename: "abcdef", expectedPath: "data/abcdef"},
+		Case{depth: 1, filename: "abcdef", expectedPath: "data/ab/abcdef"},
+		Case{depth: 2, filename: "abcdef", expectedPath: "data/ab/cd/abcdef"},
+		Case{depth: 2, filename: "sha256_abcdef", expectedPath: "data/ab/cd/sha256_abcdef"},
+		Case{depth: 3, filename: "111", expectedPath: "data/11/111"},
+	}
+
+	for _, c := range cases {
+		withShardDepth(c.depth, func() {
+			assert.Equal(c.expectedPath, entityPath("data/", c.filename))
+		})
+	}
+}
+
+func TestMigrateLayout(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+	dir := getDefaultDirectory()
+
+	flatDAO := NewSimioDAO(dir)
+	for i := 0; i < 20; i++ {
+		assert.True(flatDAO.Save(SimioEntity{ID: fmt.Sprintf("%04x", i*4099), IsSimian: i%2 == 0}))
+	}
+	assert.True(flatDAO.Save(SimioEntity{ID: "sha256:abcdef"}))
+
+	withShardDepth(2, func() {
+		simioDAO := NewSimioDAO(dir).(*SimioDAO)
+		assert.Equal(Counts{Simians: 10, Humans: 11}, simioDAO.Counts())
+
+		// Both layouts are understood while the migration has not run.
+		assert.True(checkFileExist("0000"))
+		assert.True(simioDAO.Save(SimioEntity{ID: "ffff"}))
+		assert.True(checkFileExist("ffff"))
+		deleted, err := simioDAO.Delete("1003")
+		assert.True(deleted)
+		assert.Nil(err)
+		assert.False(checkFileExist("1003"))
+
+		moved, err := simioDAO.MigrateLayout()
+		assert.Nil(err)
+		assert.Equal(20, moved)
+
+		_, err = os.Stat(dir + "ab/cd/sha256_abcdef")
+		assert.Nil(err)
+		_, err = os.Stat(dir + "20/06/2006")
+		assert.Nil(err)
+
+		files, _ := ioutil.ReadDir(dir)
+		for _, file := range files {
+			assert.True(file.IsDir(), file.Name())
+		}
+
+		moved, err = simioDAO.MigrateLayout()
+		assert.Nil(err)
+		assert.Equal(0, moved)
+
+		reloaded := NewSimioDAO(dir)
+		assert.Equal(21, len(reloaded.Snapshot()))
+		assert.Equal(simioDAO.Counts(), reloaded.Counts())
+	})
+}
+
+func TestMigrateLayoutWhileServing(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+	dir := getDefaultDirectory()
+	size := stressSize()
+
+	flatDAO := NewSimioDAO(dir)
+	for i := 0; i < size; i++ {
+		assert.True(flatDAO.Save(SimioEntity{ID: fmt.Sprintf("%08x", i)}))
+	}
+
+	withShardDepth(1, func() {
+		simioDAO := NewSimioDAO(dir).(*SimioDAO)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < size; i += 2 {
+				deleted, err := simioDAO.Delete(fmt.Sprintf("%08x", i))
+				assert.True(deleted)
+				assert.Nil(err)
+				assert.True(simioDAO.Save(SimioEntity{ID: fmt.Sprintf("%08x", size+i)}))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := simioDAO.MigrateLayout()
+			assert.Nil(err)
+		}()
+		wg.Wait()
+
+		_, err := simioDAO.MigrateLayout()
+		assert.Nil(err)
+
+		reloaded := NewSimioDAO(dir)
+		assert.Equal(size, len(reloaded.Snapshot()))
+		for i := 0; i < size; i++ {
+			_, found := reloaded.Get(fmt.Sprintf("%08x", i))
+			assert.Equal(i%2 == 1, found)
+		}
+	})
+}
@@ -0,0 +1,703 @@
+package database
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultLogSegmentSize     = 64 << 20
+	defaultLogCompactInterval = 10 * time.Minute
+)
+
+var segmentName = regexp.MustCompile(`^(\d{10})\.log$`)
+
+type LogSettings struct {
+	// SegmentSize is the size a segment is sealed at, and a new one started.
+	SegmentSize int64
+	// CompactInterval is how often sealed segments are merged. Zero disables
+	// the background compactor.
+	CompactInterval time.Duration
+}
+
+type logSegment struct {
+	id   int
+	file *os.File
+	size int64
+	// compacted tells the segment starts with a base record.
+	compacted bool
+}
+
+// logEntry is where the last record of an entity is, along with what listing
+// needs, so only the entities of a page are read from disk.
+type logEntry struct {
+	segment   int
+	offset    int64
+	size      int
+	isSimian  bool
+	createdAt time.Time
+}
+
+// LogDAO appends every change as a CRC-checked record to segment files, and
+// keeps an index of where each entity's record is. Starting replays the
+// segments, and a compactor merges the sealed ones, dropping the records no
+// entity points to anymore.
+type LogDAO struct {
+	simians  int64
+	humans   int64
+	lock     sync.RWMutex
+	dir      string
+	settings LogSettings
+	segments map[int]*logSegment
+	active   *logSegment
+	index    map[string]logEntry
+	aliases  map[string]string
+	// compactLock keeps a single compaction at a time.
+	compactLock sync.Mutex
+	stop        chan struct{}
+	stopped     sync.WaitGroup
+}
+
+func (ld *LogDAO) Save(entity SimioEntity) (bool, error) {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	if _, hasEntity := ld.index[entity.ID]; hasEntity {
+		log.Printf("The DNA %s has been already saved", entity.ID)
+		return false, nil
+	}
+
+	err := ld.append(logRecord{Op: logOpPut, Entity: &entity})
+
+	if err != nil {
+		log.Printf("Error on appending entity to log. Details: %s", err)
+		return false, fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return true, nil
+}
+
+func (ld *LogDAO) SaveAll(entities []SimioEntity) ([]SimioEntity, error) {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	var records []logRecord
+	var inserted []SimioEntity
+	for i := range entities {
+		if _, hasEntity := ld.index[entities[i].ID]; !hasEntity {
+			records = append(records, logRecord{Op: logOpPut, Entity: &entities[i]})
+			inserted = append(inserted, entities[i])
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	err := ld.append(records...)
+
+	if err != nil {
+		log.Printf("Error on appending entities to log. Details: %s", err)
+		return nil, fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return inserted, nil
+}
+
+func (ld *LogDAO) Get(id string) (SimioEntity, bool) {
+	ld.lock.RLock()
+	defer ld.lock.RUnlock()
+
+	entry, found := ld.find(id)
+	if !found {
+		return SimioEntity{}, false
+	}
+
+	entity, err := ld.read(entry)
+	if err != nil {
+		log.Printf("Error on reading entity %s from log. Details: %s", id, err)
+		return SimioEntity{}, false
+	}
+	return entity, true
+}
+
+func (ld *LogDAO) Replace(previousID string, entity SimioEntity) error {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	if _, stored := ld.index[previousID]; !stored {
+		return nil
+	}
+
+	entity.PreviousID = previousID
+
+	err := ld.append(logRecord{Op: logOpReplace, Entity: &entity, PreviousID: previousID})
+
+	if err != nil {
+		log.Printf("Error on appending replacement of %s to log. Details: %s", previousID, err)
+		return fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")
+	}
+	return nil
+}
+
+func (ld *LogDAO) Delete(id string) (bool, error) {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	if _, found := ld.find(id); !found {
+		return false, nil
+	}
+
+	if _, stored := ld.index[id]; !stored {
+		id = ld.aliases[id]
+	}
+
+	err := ld.append(logRecord{Op: logOpDelete, ID: id})
+
+	if err != nil {
+		log.Printf("Error on appending deletion of %s to log. Details: %s", id, err)
+		return false, fmt.Errorf("UNEXPECTED_ERROR_ON_DELETE")
+	}
+	return true, nil
+}
+
+func (ld *LogDAO) List(query ListQuery) ListPage {
+	ld.lock.RLock()
+	defer ld.lock.RUnlock()
+
+	var entities []SimioEntity
+	for id, entry := range ld.index {
+		entity := SimioEntity{ID: id, IsSimian: entry.isSimian, CreatedAt: entry.createdAt}
+		if query.matches(entity) {
+			entities = append(entities, entity)
+		}
+	}
+
+	page := query.page(entities)
+	for i, entity := range page.Entities {
+		if stored, err := ld.read(ld.index[entity.ID]); err == nil {
+			page.Entities[i] = stored
+		} else {
+			log.Printf("Error on reading entity %s from log. Details: %s", entity.ID, err)
+		}
+	}
+	return page
+}
+
+func (ld *LogDAO) Snapshot() []SimioEntity {
+	ld.lock.RLock()
+	defer ld.lock.RUnlock()
+
+	entities := make([]SimioEntity, 0, len(ld.index))
+	for id, entry := range ld.index {
+		entity, err := ld.read(entry)
+		if err != nil {
+			log.Printf("Error on reading entity %s from log. Details: %s", id, err)
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+func (ld *LogDAO) Counts() Counts {
+	return Counts{
+		Simians: int(atomic.LoadInt64(&ld.simians)),
+		Humans:  int(atomic.LoadInt64(&ld.humans)),
+	}
+}
+
+func (ld *LogDAO) Recount() (Counts, Counts) {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	var counted Counts
+	for _, entry := range ld.index {
+		counted.add(SimioEntity{IsSimian: entry.isSimian}, 1)
+	}
+
+	previous := ld.Counts()
+	atomic.StoreInt64(&ld.simians, int64(counted.Simians))
+	atomic.StoreInt64(&ld.humans, int64(counted.Humans))
+
+	return previous, counted
+}
+
+// Compact merges the sealed segments into the newest of them, keeping only
+// the records the index points to. Writes go on meanwhile, to the active
+// segment.
+func (ld *LogDAO) Compact() error {
+	ld.compactLock.Lock()
+	defer ld.compactLock.Unlock()
+
+	ld.lock.RLock()
+	var sealed []int
+	sealedSegments := make(map[int]*logSegment)
+	for id, segment := range ld.segments {
+		if id != ld.active.id {
+			sealed = append(sealed, id)
+			sealedSegments[id] = segment
+		}
+	}
+	sort.Ints(sealed)
+
+	if len(sealed) == 0 || (len(sealed) == 1 && ld.segments[sealed[0]].compacted) {
+		ld.lock.RUnlock()
+		return nil
+	}
+
+	target := sealed[len(sealed)-1]
+	live := make(map[string]logEntry)
+	for id, entry := range ld.index {
+		if entry.segment <= target {
+			live[id] = entry
+		}
+	}
+	aliases := make(map[string]string, len(ld.aliases))
+	for previousID, id := range ld.aliases {
+		aliases[previousID] = id
+	}
+	ld.lock.RUnlock()
+
+	// The sealed segments are not written anymore, and only compaction
+	// removes them, so they can be read without the lock.
+	compacted, moved, err := ld.writeCompacted(target, sealedSegments, live, aliases)
+	if err != nil {
+		return err
+	}
+
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	if err := os.Rename(compacted.file.Name(), ld.segmentPath(target)); err != nil {
+		compacted.file.Close()
+		os.Remove(compacted.file.Name())
+		return err
+	}
+	if err := syncDir(ld.dir); err != nil {
+		log.Printf("Error on syncing log directory. Details: %s", err)
+	}
+
+	for id, entry := range moved {
+		if current, stored := ld.index[id]; stored && current.segment == live[id].segment && current.offset == live[id].offset {
+			ld.index[id] = entry
+		}
+	}
+
+	for _, id := range sealed {
+		ld.segments[id].file.Close()
+		delete(ld.segments, id)
+		if id != target {
+			os.Remove(ld.segmentPath(id))
+		}
+	}
+	ld.segments[target] = compacted
+
+	log.Printf("Log segments %d to %d compacted. %d entities kept", sealed[0], target, len(moved))
+	return nil
+}
+
+func (ld *LogDAO) Close() error {
+	if ld.stop != nil {
+		close(ld.stop)
+		ld.stopped.Wait()
+	}
+
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	var err error
+	for _, segment := range ld.segments {
+		if closeErr := segment.file.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (ld *LogDAO) writeCompacted(target int, sealed map[int]*logSegment, live map[string]logEntry, aliases map[string]string) (*logSegment, map[string]logEntry, error) {
+	file, err := os.OpenFile(ld.segmentPath(target)+".compact", os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	compacted := &logSegment{id: target, file: file, compacted: true}
+	writer := bufio.NewWriter(file)
+
+	write := func(record logRecord) (int64, int, error) {
+		buf, err := encodeRecord(record)
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err := writer.Write(buf); err != nil {
+			return 0, 0, err
+		}
+		offset := compacted.size
+		compacted.size += int64(len(buf))
+		return offset, len(buf), nil
+	}
+
+	fail := func(err error) (*logSegment, map[string]logEntry, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, nil, err
+	}
+
+	if _, _, err := write(logRecord{Op: logOpBase}); err != nil {
+		return fail(err)
+	}
+
+	for previousID, id := range aliases {
+		if _, _, err := write(logRecord{Op: logOpAlias, ID: id, PreviousID: previousID}); err != nil {
+			return fail(err)
+		}
+	}
+
+	moved := make(map[string]logEntry, len(live))
+	for id, entry := range live {
+		entity, err := readSegmentEntry(sealed[entry.segment], entry)
+		if err != nil {
+			return fail(err)
+		}
+
+		offset, size, err := write(logRecord{Op: logOpPut, Entity: &entity})
+		if err != nil {
+			return fail(err)
+		}
+
+		entry.segment, entry.offset, entry.size = target, offset, size
+		moved[id] = entry
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := file.Sync(); err != nil {
+		return fail(err)
+	}
+	return compacted, moved, nil
+}
+
+// append writes the records to the active segment, syncs it once and applies
+// them to the index. Records written before a failure are kept.
+func (ld *LogDAO) append(records ...logRecord) error {
+	var err error
+	written := 0
+
+	for _, record := range records {
+		var buf []byte
+		if buf, err = encodeRecord(record); err != nil {
+			break
+		}
+
+		offset := ld.active.size
+		if _, err = ld.active.file.WriteAt(buf, offset); err != nil {
+			break
+		}
+
+		ld.active.size += int64(len(buf))
+		ld.apply(record, logEntry{segment: ld.active.id, offset: offset, size: len(buf)})
+		written++
+	}
+
+	if written > 0 {
+		if syncErr := ld.active.file.Sync(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}
+
+	if ld.active.size >= ld.settings.SegmentSize {
+		if rollErr := ld.roll(); rollErr != nil {
+			log.Printf("Error on starting a new log segment. Details: %s", rollErr)
+		}
+	}
+	return err
+}
+
+// apply updates the index with a record found at entry, both when it is
+// written and when the log is replayed.
+func (ld *LogDAO) apply(record logRecord, entry logEntry) {
+	switch record.Op {
+	case logOpPut:
+		ld.put(record.Entity, entry)
+	case logOpReplace:
+		if _, hasEntity := ld.index[record.Entity.ID]; !hasEntity {
+			ld.put(record.Entity, entry)
+		}
+		ld.aliases[record.PreviousID] = record.Entity.ID
+		ld.remove(record.PreviousID)
+	case logOpAlias:
+		ld.aliases[record.PreviousID] = record.ID
+	case logOpDelete:
+		ld.remove(record.ID)
+		for previousID, id := range ld.aliases {
+			if id == record.ID {
+				delete(ld.aliases, previousID)
+			}
+		}
+	}
+}
+
+func (ld *LogDAO) put(entity *SimioEntity, entry logEntry) {
+	if previous, hasEntity := ld.index[entity.ID]; hasEntity {
+		ld.count(previous, -1)
+	}
+
+	entry.isSimian = entity.IsSimian
+	entry.createdAt = entity.CreatedAt
+	ld.index[entity.ID] = entry
+	ld.count(entry, 1)
+}
+
+func (ld *LogDAO) remove(id string) {
+	if entry, hasEntity := ld.index[id]; hasEntity {
+		delete(ld.index, id)
+		ld.count(entry, -1)
+	}
+}
+
+func (ld *LogDAO) count(entry logEntry, delta int64) {
+	if entry.isSimian {
+		atomic.AddInt64(&ld.simians, delta)
+	} else {
+		atomic.AddInt64(&ld.humans, delta)
+	}
+}
+
+func (ld *LogDAO) find(id string) (logEntry, bool) {
+	entry, found := ld.index[id]
+	if !found {
+		if newID, hasAlias := ld.aliases[id]; hasAlias {
+			entry, found = ld.index[newID]
+		}
+	}
+	return entry, found
+}
+
+func (ld *LogDAO) read(entry logEntry) (SimioEntity, error) {
+	return readSegmentEntry(ld.segments[entry.segment], entry)
+}
+
+func readSegmentEntry(segment *logSegment, entry logEntry) (SimioEntity, error) {
+	if segment == nil {
+		return SimioEntity{}, fmt.Errorf("Segment %d not found", entry.segment)
+	}
+
+	buf := make([]byte, entry.size)
+	if _, err := segment.file.ReadAt(buf, entry.offset); err != nil {
+		return SimioEntity{}, err
+	}
+
+	record, err := decodeRecord(buf)
+	if err != nil {
+		return SimioEntity{}, err
+	}
+	if record.Entity == nil {
+		return SimioEntity{}, errTornRecord
+	}
+	return *record.Entity, nil
+}
+
+func (ld *LogDAO) roll() error {
+	return ld.createSegment(ld.active.id + 1)
+}
+
+// createSegment starts a new active segment.
+func (ld *LogDAO) createSegment(id int) error {
+	file, err := os.OpenFile(ld.segmentPath(id), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(ld.dir); err != nil {
+		log.Printf("Error on syncing log directory. Details: %s", err)
+	}
+
+	ld.active = &logSegment{id: id, file: file}
+	ld.segments[id] = ld.active
+	return nil
+}
+
+// replay reads a segment into the index. At a torn or corrupt record it stops:
+// the last segment is truncated there, since that is where a crash leaves
+// half-written records, so new ones are appended after the good ones.
+func (ld *LogDAO) replay(segment *logSegment, last bool) error {
+	info, err := segment.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(segment.file, 0, info.Size()))
+	var offset int64
+
+	for {
+		record, size, err := readRecord(reader, info.Size()-offset)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if !last {
+				log.Printf("Log segment %d is corrupt at offset %d. Skipping the rest of it", segment.id, offset)
+				break
+			}
+
+			log.Printf("Log segment %d has a torn tail at offset %d. Truncating it", segment.id, offset)
+			if err := segment.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+
+		if offset == 0 && record.Op == logOpBase {
+			segment.compacted = true
+		}
+		ld.apply(record, logEntry{segment: segment.id, offset: offset, size: size})
+		offset += int64(size)
+	}
+
+	segment.size = offset
+	return nil
+}
+
+func (ld *LogDAO) compactor() {
+	defer ld.stopped.Done()
+
+	ticker := time.NewTicker(ld.settings.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ld.Compact(); err != nil {
+				log.Printf("Error on compacting log. Details: %s", err)
+			}
+		case <-ld.stop:
+			return
+		}
+	}
+}
+
+func (ld *LogDAO) segmentPath(id int) string {
+	return fmt.Sprintf("%s%010d.log", ld.dir, id)
+}
+
+// segmentIDs lists the segments in dir, removing what an interrupted
+// compaction left: its temporary file, or the segments it had merged.
+func segmentIDs(dir string) ([]int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, file := range files {
+		if matches := segmentName.FindStringSubmatch(file.Name()); matches != nil {
+			id, _ := strconv.Atoi(matches[1])
+			ids = append(ids, id)
+		} else if strings.HasSuffix(file.Name(), ".compact") {
+			os.Remove(dir + file.Name())
+		}
+	}
+	sort.Ints(ids)
+
+	for i := len(ids) - 1; i > 0; i-- {
+		if isCompacted(fmt.Sprintf("%s%010d.log", dir, ids[i])) {
+			for _, id := range ids[:i] {
+				log.Printf("Removing log segment %d, compacted into %d", id, ids[i])
+				os.Remove(fmt.Sprintf("%s%010d.log", dir, id))
+			}
+			return ids[i:], nil
+		}
+	}
+	return ids, nil
+}
+
+func isCompacted(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	record, _, err := readRecord(bufio.NewReader(file), info.Size())
+	return err == nil && record.Op == logOpBase
+}
+
+func getLogDirectory() string {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		log.Printf("%s", err)
+	}
+
+	return currentDir + "/database/data/log/"
+}
+
+func NewLogDAO(dir string, settings LogSettings) (*LogDAO, error) {
+	if settings.SegmentSize <= 0 {
+		settings.SegmentSize = defaultLogSegmentSize
+	}
+
+	createDirIfNotExist(dir)
+
+	ids, err := segmentIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	logDAO := &LogDAO{
+		dir:      dir,
+		settings: settings,
+		segments: make(map[int]*logSegment),
+		index:    make(map[string]logEntry),
+		aliases:  make(map[string]string),
+	}
+
+	for i, id := range ids {
+		file, err := os.OpenFile(logDAO.segmentPath(id), os.O_RDWR, 0644)
+		if err != nil {
+			logDAO.Close()
+			return nil, err
+		}
+
+		segment := &logSegment{id: id, file: file}
+		logDAO.segments[id] = segment
+
+		if err := logDAO.replay(segment, i == len(ids)-1); err != nil {
+			logDAO.Close()
+			return nil, err
+		}
+		logDAO.active = segment
+	}
+
+	if logDAO.active == nil {
+		if err := logDAO.createSegment(1); err != nil {
+			return nil, err
+		}
+	}
+
+	if settings.CompactInterval > 0 {
+		logDAO.stop = make(chan struct{})
+		logDAO.stopped.Add(1)
+		go logDAO.compactor()
+	}
+
+	counts := logDAO.Counts()
+	log.Printf("Log %s replayed. DB Size = %v, simians = %v, humans = %v", dir, len(logDAO.index), counts.Simians, counts.Humans)
+
+	return logDAO, nil
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogDAO(t *testing.T, dir string, segmentSize int64) *LogDAO {
+	logDAO, err := NewLogDAO(dir, LogSettings{SegmentSize: segmentSize})
+	if err != nil {
+		t.Fatalf("Error on opening log. Details: %s", err)
+	}
+	return logDAO
+}
+
+func logTempDir() string {
+	dir, _ := ioutil.TempDir("", "simio-log")
+	return dir + "/"
+}
+
+func TestReadRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		data           func(record []byte) []byte
+		expectedRecord logRecord
+		expectedErr    error
+	}
+
+	entity := SimioEntity{ID: "111", DNA: "CCCC|AGTC", IsSimian: true}
+	record := logRecord{Op: logOpPut, Entity: &entity}
+
+	cases := []Case{
+		Case{data: func(record []byte) []byte { return record }, expectedRecord: record},
+		Case{data: func(record []byte) []byte { return nil }, expectedErr: fmt.Errorf("EOF")},
+		Case{data: func(record []byte) []byte { return record[:4] }, expectedErr: errTornRecord},
+		Case{data: func(record []byte) []byte { return record[:len(record)-1] }, expectedErr: errTornRecord},
+		Case{data: func(record []byte) []byte {
+			corrupt := append([]byte{}, record...)
+			corrupt[len(corrupt)-2] ^= 0xff
+			return corrupt
+		}, expectedErr: errTornRecord},
+	}
+
+	encoded, err := encodeRecord(record)
+	assert.Nil(err)
+
+	for _, c := range cases {
+		data := c.data(encoded)
+
+		read, size, err := readRecord(bufio.NewReader(bytes.NewReader(data)), int64(len(data)))
+
+		if c.expectedErr == nil {
+			assert.Nil(err)
+			assert.Equal(c.expectedRecord, read)
+			assert.Equal(len(encoded), size)
+		} else {
+			assert.Equal(c.expectedErr.Error(), err.Error())
+		}
+	}
+}
+
+func TestLogDAOTornTail(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		damage       func(path string, size int64)
+		expectedKept bool
+	}
+
+	cases := []Case{
+		Case{damage: func(path string, size int64) {
+			// A crash in the middle of an append.
+			record, _ := encodeRecord(logRecord{Op: logOpPut, Entity: &SimioEntity{ID: "999"}})
+			file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			file.Write(record[:len(record)/2])
+			file.Close()
+		}, expectedKept: true},
+		Case{damage: func(path string, size int64) {
+			// A corrupt last record.
+			file, _ := os.OpenFile(path, os.O_RDWR, 0644)
+			file.WriteAt([]byte{'#'}, size-2)
+			file.Close()
+		}, expectedKept: false},
+	}
+
+	for _, c := range cases {
+		dir := logTempDir()
+
+		logDAO := newTestLogDAO(t, dir, defaultLogSegmentSize)
+		assert.True(logDAO.Save(SimioEntity{ID: "111", IsSimian: true}))
+		goodSize := logDAO.active.size
+		assert.True(logDAO.Save(SimioEntity{ID: "222"}))
+		size := logDAO.active.size
+		logDAO.Close()
+
+		c.damage(logDAO.segmentPath(1), size)
+
+		logDAO = newTestLogDAO(t, dir, defaultLogSegmentSize)
+
+		_, found := logDAO.Get("111")
+		assert.True(found)
+
+		_, found = logDAO.Get("222")
+		assert.Equal(c.expectedKept, found)
+
+		expectedSize, expectedCount := goodSize, 2
+		if c.expectedKept {
+			expectedSize, expectedCount = size, 3
+		}
+		info, _ := os.Stat(logDAO.segmentPath(1))
+		assert.Equal(expectedSize, info.Size())
+
+		assert.True(logDAO.Save(SimioEntity{ID: "333"}))
+		logDAO.Close()
+
+		logDAO = newTestLogDAO(t, dir, defaultLogSegmentSize)
+		_, found = logDAO.Get("333")
+		assert.True(found)
+		assert.Equal(expectedCount, len(logDAO.Snapshot()))
+		logDAO.Close()
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLogDAOCompact(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := logTempDir()
+	defer os.RemoveAll(dir)
+
+	logDAO := newTestLogDAO(t, dir, 256)
+
+	for i := 0; i < 20; i++ {
+		assert.True(logDAO.Save(SimioEntity{ID: fmt.Sprint(i), IsSimian: i%2 == 0}))
+	}
+	for i := 0; i < 10; i++ {
+		deleted, err := logDAO.Delete(fmt.Sprint(i))
+		assert.True(deleted)
+		assert.Nil(err)
+	}
+	assert.Nil(logDAO.Replace("10", SimioEntity{ID: "sha256:10", IsSimian: true}))
+	assert.True(len(logDAO.segments) > 2)
+
+	assert.Nil(logDAO.Compact())
+
+	assert.Equal(2, len(logDAO.segments))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(2, len(files))
+
+	check := func(logDAO *LogDAO) {
+		assert.Equal(10, len(logDAO.Snapshot()))
+		assert.Equal(Counts{Simians: 5, Humans: 5}, logDAO.Counts())
+
+		entity, found := logDAO.Get("10")
+		assert.True(found)
+		assert.Equal("sha256:10", entity.ID)
+
+		_, found = logDAO.Get("5")
+		assert.False(found)
+	}
+
+	check(logDAO)
+	assert.Nil(logDAO.Compact())
+	logDAO.Close()
+
+	logDAO = newTestLogDAO(t, dir, 256)
+	check(logDAO)
+	logDAO.Close()
+}
+
+func TestLogDAOInterruptedCompaction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := logTempDir()
+	defer os.RemoveAll(dir)
+
+	logDAO := newTestLogDAO(t, dir, 1)
+	assert.True(logDAO.Save(SimioEntity{ID: "111"}))
+	assert.True(logDAO.Save(SimioEntity{ID: "222"}))
+	deleted, _ := logDAO.Delete("111")
+	assert.True(deleted)
+
+	merged, _ := ioutil.ReadFile(logDAO.segmentPath(1))
+	assert.Nil(logDAO.Compact())
+	logDAO.Close()
+
+	// A crash after the compacted segment was renamed leaves the segments it
+	// merged, and the temporary file of a later compaction.
+	ioutil.WriteFile(logDAO.segmentPath(1), merged, 0644)
+	ioutil.WriteFile(logDAO.segmentPath(4)+".compact", []byte("partial"), 0644)
+
+	logDAO = newTestLogDAO(t, dir, 1)
+	defer logDAO.Close()
+
+	_, found := logDAO.Get("111")
+	assert.False(found)
+	_, found = logDAO.Get("222")
+	assert.True(found)
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(2, len(files))
+}
+
+func TestLogDAOConcurrentCompaction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := logTempDir()
+	defer os.RemoveAll(dir)
+
+	logDAO := newTestLogDAO(t, dir, 1024)
+	size := stressSize()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < size; i++ {
+			assert.True(logDAO.Save(SimioEntity{ID: fmt.Sprint(i)}))
+			if i%3 == 0 {
+				logDAO.Delete(fmt.Sprint(i))
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < size/10; i++ {
+			assert.Nil(logDAO.Compact())
+			logDAO.List(ListQuery{Limit: 5})
+		}
+	}()
+	wg.Wait()
+
+	expected := size - (size+2)/3
+	assert.Equal(expected, len(logDAO.Snapshot()))
+	logDAO.Close()
+
+	logDAO = newTestLogDAO(t, dir, 1024)
+	assert.Equal(expected, len(logDAO.Snapshot()))
+	assert.Equal(Counts{Humans: expected}, logDAO.Counts())
+	logDAO.Close()
+}
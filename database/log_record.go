@@ -0,0 +1,95 @@
+package database
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	logOpPut     = "put"
+	logOpDelete  = "delete"
+	logOpReplace = "replace"
+	logOpAlias   = "alias"
+	// logOpBase starts a compacted segment, which holds everything the
+	// segments before it did.
+	logOpBase = "base"
+)
+
+// logHeaderSize is the length of a record's header: the payload length and
+// its CRC-32C, as big-endian uint32s.
+const logHeaderSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errTornRecord = fmt.Errorf("Torn or corrupt record")
+
+type logRecord struct {
+	Op         string       `json:"op"`
+	Entity     *SimioEntity `json:"entity,omitempty"`
+	ID         string       `json:"id,omitempty"`
+	PreviousID string       `json:"previous_id,omitempty"`
+}
+
+func encodeRecord(record logRecord) ([]byte, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, logHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[logHeaderSize:], payload)
+
+	return buf, nil
+}
+
+// decodeRecord decodes a whole record, header included.
+func decodeRecord(buf []byte) (logRecord, error) {
+	var record logRecord
+
+	if len(buf) < logHeaderSize || int(binary.BigEndian.Uint32(buf[0:4])) != len(buf)-logHeaderSize {
+		return record, errTornRecord
+	}
+
+	payload := buf[logHeaderSize:]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(buf[4:8]) {
+		return record, errTornRecord
+	}
+
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return record, errTornRecord
+	}
+	return record, nil
+}
+
+// readRecord reads the next record of a segment with remaining bytes left.
+// It returns io.EOF at the end of the segment, and errTornRecord when the
+// record is cut short or corrupt, as a crash mid-write leaves it.
+func readRecord(reader *bufio.Reader, remaining int64) (logRecord, int, error) {
+	if remaining == 0 {
+		return logRecord{}, 0, io.EOF
+	}
+
+	header, err := reader.Peek(logHeaderSize)
+	if err != nil || remaining < logHeaderSize {
+		return logRecord{}, 0, errTornRecord
+	}
+
+	size := logHeaderSize + int64(binary.BigEndian.Uint32(header[0:4]))
+	if size > remaining {
+		return logRecord{}, 0, errTornRecord
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return logRecord{}, 0, errTornRecord
+	}
+
+	record, err := decodeRecord(buf)
+	return record, int(size), err
+}
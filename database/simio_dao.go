@@ -1,52 +1,436 @@
 package database
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"simio-api/config"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type SimioEntity struct {
-	ID       string
-	DNA      string
-	IsSimian bool
+	ID        string
+	DNA       string
+	IsSimian  bool
+	Rules     string
+	Alphabet  string
+	Toroidal  bool
+	CreatedAt time.Time
+	// PreviousID is the ID the entity had before its ID scheme was migrated.
+	// Lookups by it still find the entity.
+	PreviousID string
 }
 
 type DAO interface {
-	Save(entity SimioEntity) error
-	GetData() map[string]SimioEntity
+	// Save stores the entity unless one with its ID is stored already. It
+	// reports whether it was this call that stored it.
+	Save(entity SimioEntity) (bool, error)
+	Get(id string) (SimioEntity, bool)
+	// Snapshot copies the stored entities, so callers can go through them
+	// while others are saved.
+	Snapshot() []SimioEntity
+	// Counts tells how many simian and human entities are stored, without
+	// going through them.
+	Counts() Counts
+	// Recount counts the stored entities one by one and fixes the counters.
+	// It returns the counters as they were and the recounted ones.
+	Recount() (Counts, Counts)
+	// Replace stores the entity under its new ID and removes the one stored
+	// under previousID, which keeps resolving to it. It does nothing when
+	// nothing is stored under previousID, so an entity deleted after it was
+	// read is not brought back.
+	Replace(previousID string, entity SimioEntity) error
+	// SaveAll saves the entities not stored yet, and returns the ones it
+	// stored. It stops at the first one that fails, keeping the ones saved
+	// before it.
+	SaveAll(entities []SimioEntity) ([]SimioEntity, error)
+	// List pages through the entities sorted by creation time, then ID.
+	List(query ListQuery) ListPage
+	// Delete removes the entity and its file. It reports false when there is
+	// no entity with the ID.
+	Delete(id string) (bool, error)
 }
 
+type Counts struct {
+	Simians int
+	Humans  int
+}
+
+type ListQuery struct {
+	// IsSimian keeps only the entities with this verdict. Nil keeps all.
+	IsSimian   *bool
+	Descending bool
+	Limit      int
+	// AfterCreatedAt and AfterID are the position of the last entity of the
+	// previous page. An empty AfterID starts from the first one.
+	AfterCreatedAt time.Time
+	AfterID        string
+}
+
+type ListPage struct {
+	Entities []SimioEntity
+	HasMore  bool
+}
+
+// SimioDAO is safe for concurrent use. Saves reserve the IDs under the lock
+// and write the files without it, so they wait for the disk together and
+// readers are not held up meanwhile. An entity is in the map only once it is
+// on disk.
 type SimioDAO struct {
-	Data map[string]SimioEntity
+	// simians and humans are first, so they are 64-bit aligned for atomic
+	// access on 32-bit platforms.
+	simians int64
+	humans  int64
+	// dir is the data directory the entity files are kept in.
+	dir     string
+	lock    sync.RWMutex
+	data    map[string]SimioEntity
+	aliases map[string]string
+	// pending holds the IDs whose files are being written.
+	pending map[string]bool
+}
+
+func (sDB *SimioDAO) Save(entity SimioEntity) (bool, error) {
+	sDB.lock.Lock()
+	reserved := sDB.reserve(entity.ID)
+	sDB.lock.Unlock()
+
+	if !reserved {
+		log.Printf("The DNA %s has been already saved", entity.ID)
+		return false, nil
+	}
+
+	err := saveEntityOnFile(sDB.dir, fileNameFor(entity.ID), entity)
+
+	sDB.lock.Lock()
+	defer sDB.lock.Unlock()
+
+	delete(sDB.pending, entity.ID)
+	if err != nil {
+		return false, err
+	}
+	return sDB.insert(entity), nil
+}
+
+func (sDB *SimioDAO) SaveAll(entities []SimioEntity) ([]SimioEntity, error) {
+	var newEntities []SimioEntity
+
+	sDB.lock.Lock()
+	for _, entity := range entities {
+		if sDB.reserve(entity.ID) {
+			newEntities = append(newEntities, entity)
+		}
+	}
+	sDB.lock.Unlock()
+
+	saved, err := saveEntitiesOnFiles(sDB.dir, newEntities)
+
+	sDB.lock.Lock()
+	defer sDB.lock.Unlock()
+
+	var inserted []SimioEntity
+	for i, entity := range newEntities {
+		delete(sDB.pending, entity.ID)
+		if i < saved && sDB.insert(entity) {
+			inserted = append(inserted, entity)
+		}
+	}
+
+	return inserted, err
+}
+
+// reserve claims the ID for a save, unless the entity is stored, or being
+// stored, already. It must be called with the lock held.
+func (sDB *SimioDAO) reserve(id string) bool {
+	if _, hasEntity := sDB.data[id]; hasEntity || sDB.pending[id] || sDB.hasFile(id) {
+		return false
+	}
+
+	if sDB.pending == nil {
+		sDB.pending = make(map[string]bool)
+	}
+	sDB.pending[id] = true
+	return true
+}
+
+// hasFile tells whether the entity has a file in the data directory.
+func (sDB *SimioDAO) hasFile(id string) bool {
+	_, found := findEntityFile(sDB.dir, fileNameFor(id))
+	return found
+}
+
+// insert adds an entity whose file was written to the map, unless a Replace
+// stored it while the file was written. It must be called with the lock held.
+func (sDB *SimioDAO) insert(entity SimioEntity) bool {
+	if _, hasEntity := sDB.data[entity.ID]; hasEntity {
+		return false
+	}
+
+	sDB.data[entity.ID] = entity
+	sDB.count(entity, 1)
+	return true
 }
 
-func (sDB *SimioDAO) Save(entity SimioEntity) error {
-	_, hasEntity := sDB.Data[entity.ID]
+func (sDB *SimioDAO) Get(id string) (SimioEntity, bool) {
+	sDB.lock.RLock()
+	defer sDB.lock.RUnlock()
 
+	return sDB.get(id)
+}
+
+func (sDB *SimioDAO) get(id string) (SimioEntity, bool) {
+	entity, hasEntity := sDB.data[id]
 	if !hasEntity {
-		if !checkFileExist(entity.ID) {
+		if newID, hasAlias := sDB.aliases[id]; hasAlias {
+			entity, hasEntity = sDB.data[newID]
+		}
+	}
+	return entity, hasEntity
+}
 
-			err := saveEntityOnFile(entity.ID, entity)
+func (sDB *SimioDAO) Replace(previousID string, entity SimioEntity) error {
+	sDB.lock.Lock()
+	defer sDB.lock.Unlock()
 
-			if err != nil {
-				return err
-			}
+	entity.PreviousID = previousID
+
+	previous, hasPrevious := sDB.data[previousID]
+	if !hasPrevious {
+		return nil
+	}
+
+	if _, hasEntity := sDB.data[entity.ID]; !hasEntity {
+		err := saveEntityOnFile(sDB.dir, fileNameFor(entity.ID), entity)
 
-			sDB.Data[entity.ID] = entity
+		if err != nil {
+			return err
 		}
-	} else {
-		log.Printf("The DNA %s has been already saved", entity.ID)
+
+		sDB.data[entity.ID] = entity
+		sDB.count(entity, 1)
+	}
+
+	if sDB.aliases == nil {
+		sDB.aliases = make(map[string]string)
+	}
+	sDB.aliases[previousID] = entity.ID
+
+	delete(sDB.data, previousID)
+	sDB.count(previous, -1)
+	err := removeEntityFile(sDB.dir, fileNameFor(previousID))
+
+	if err != nil {
+		log.Printf("Error on removing entity %s. Details: %s", previousID, err)
+		return fmt.Errorf("UNEXPECTED_ERROR_ON_DELETE")
 	}
+
 	return nil
 }
 
-func (sDB *SimioDAO) GetData() map[string]SimioEntity {
-	return sDB.Data
+func (sDB *SimioDAO) List(query ListQuery) ListPage {
+	sDB.lock.RLock()
+	defer sDB.lock.RUnlock()
+
+	var entities []SimioEntity
+	for _, entity := range sDB.data {
+		if query.matches(entity) {
+			entities = append(entities, entity)
+		}
+	}
+	return query.page(entities)
+}
+
+func (query ListQuery) matches(entity SimioEntity) bool {
+	if query.IsSimian != nil && entity.IsSimian != *query.IsSimian {
+		return false
+	}
+	return query.AfterID == "" || isAfter(entity, query)
+}
+
+// page sorts the entities matching the query and keeps the first Limit ones.
+func (query ListQuery) page(entities []SimioEntity) ListPage {
+	sort.Slice(entities, func(i, j int) bool {
+		if query.Descending {
+			return createdBefore(entities[j], entities[i].CreatedAt, entities[i].ID)
+		}
+		return createdBefore(entities[i], entities[j].CreatedAt, entities[j].ID)
+	})
+
+	page := ListPage{Entities: entities}
+	if query.Limit > 0 && len(entities) > query.Limit {
+		page.Entities = entities[:query.Limit]
+		page.HasMore = true
+	}
+	return page
+}
+
+func isAfter(entity SimioEntity, query ListQuery) bool {
+	if query.Descending {
+		return createdBefore(entity, query.AfterCreatedAt, query.AfterID)
+	}
+	return !createdBefore(entity, query.AfterCreatedAt, query.AfterID) &&
+		!(entity.CreatedAt.Equal(query.AfterCreatedAt) && entity.ID == query.AfterID)
+}
+
+func createdBefore(entity SimioEntity, createdAt time.Time, id string) bool {
+	if !entity.CreatedAt.Equal(createdAt) {
+		return entity.CreatedAt.Before(createdAt)
+	}
+	return entity.ID < id
+}
+
+func (sDB *SimioDAO) Delete(id string) (bool, error) {
+	sDB.lock.Lock()
+	defer sDB.lock.Unlock()
+
+	entity, hasEntity := sDB.get(id)
+
+	if !hasEntity {
+		return false, nil
+	}
+
+	err := removeEntityFile(sDB.dir, fileNameFor(entity.ID))
+
+	if err != nil {
+		log.Printf("Error on removing entity %s. Details: %s", entity.ID, err)
+		return false, fmt.Errorf("UNEXPECTED_ERROR_ON_DELETE")
+	}
+
+	delete(sDB.data, entity.ID)
+	sDB.count(entity, -1)
+	for previousID, newID := range sDB.aliases {
+		if newID == entity.ID {
+			delete(sDB.aliases, previousID)
+		}
+	}
+
+	log.Printf("Entity %s has been deleted successfully", entity.ID)
+	return true, nil
+}
+
+func (sDB *SimioDAO) Snapshot() []SimioEntity {
+	sDB.lock.RLock()
+	defer sDB.lock.RUnlock()
+
+	entities := make([]SimioEntity, 0, len(sDB.data))
+	for _, entity := range sDB.data {
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+func (sDB *SimioDAO) Counts() Counts {
+	return Counts{
+		Simians: int(atomic.LoadInt64(&sDB.simians)),
+		Humans:  int(atomic.LoadInt64(&sDB.humans)),
+	}
+}
+
+func (sDB *SimioDAO) Recount() (Counts, Counts) {
+	sDB.lock.Lock()
+	defer sDB.lock.Unlock()
+
+	counted := countEntities(sDB.data)
+	previous := sDB.Counts()
+
+	atomic.StoreInt64(&sDB.simians, int64(counted.Simians))
+	atomic.StoreInt64(&sDB.humans, int64(counted.Humans))
+
+	return previous, counted
 }
 
+func (sDB *SimioDAO) count(entity SimioEntity, delta int64) {
+	if entity.IsSimian {
+		atomic.AddInt64(&sDB.simians, delta)
+	} else {
+		atomic.AddInt64(&sDB.humans, delta)
+	}
+}
+
+func countEntities(data map[string]SimioEntity) Counts {
+	var counts Counts
+	for _, entity := range data {
+		if entity.IsSimian {
+			counts.Simians++
+		} else {
+			counts.Humans++
+		}
+	}
+	return counts
+}
+
+// Storage is a backend the entities can be stored in.
+type Storage string
+
+const (
+	// StorageFile stores each entity in its own JSON file.
+	StorageFile Storage = "file"
+	// StorageBolt stores the entities in an embedded bbolt database.
+	StorageBolt Storage = "bolt"
+	// StorageLog appends the changes to a log of segment files.
+	StorageLog Storage = "log"
+)
+
+// BuildSimioDAO opens the storage chosen by SIMIO_STORAGE.
 func BuildSimioDAO() DAO {
-	return NewSimioDAO(getDefaultDirectory())
+	storage := Storage(config.String("SIMIO_STORAGE", string(StorageFile)))
+	if storage != StorageFile && storage != StorageBolt && storage != StorageLog {
+		log.Printf("Unknown storage %s. Using %s", storage, StorageFile)
+		storage = StorageFile
+	}
+
+	if storage == StorageBolt {
+		path := config.String("SIMIO_BOLT_PATH", getBoltPath())
+		boltDAO, err := NewBoltDAO(path)
+
+		if err != nil {
+			log.Fatalf("Error on opening bolt store %s. Details: %s", path, err)
+		}
+
+		imported, err := boltDAO.ImportFiles(getDefaultDirectory())
+		if err != nil {
+			log.Fatalf("Error on importing %s into bolt store %s. Details: %s", getDefaultDirectory(), path, err)
+		}
+		if imported > 0 {
+			log.Printf("%d entities imported from %s into bolt store %s. The files are no longer used and can be removed", imported, getDefaultDirectory(), path)
+		}
+		return boltDAO
+	}
+
+	if storage == StorageLog {
+		dir := config.String("SIMIO_LOG_DIR", getLogDirectory())
+		logDAO, err := NewLogDAO(dir, LogSettings{
+			SegmentSize:     int64(config.Int("SIMIO_LOG_SEGMENT_SIZE", defaultLogSegmentSize)),
+			CompactInterval: config.Duration("SIMIO_LOG_COMPACT_INTERVAL", defaultLogCompactInterval),
+		})
+
+		if err != nil {
+			log.Fatalf("Error on opening log %s. Details: %s", dir, err)
+		}
+		return logDAO
+	}
+
+	simioDAO := NewSimioDAO(getDefaultDirectory()).(*SimioDAO)
+
+	if shardDepth > 0 {
+		go func() {
+			moved, err := simioDAO.MigrateLayout()
+			if err != nil {
+				log.Printf("Error on moving files to the shard directories. Details: %s", err)
+			}
+			if moved > 0 {
+				log.Printf("%d files moved to the shard directories", moved)
+			}
+		}()
+	}
+	return simioDAO
 }
 
 func NewSimioDAO(dir string) DAO {
-	data, err := LoadAll(dir)
+	data, counts, err := LoadAll(dir)
 
 	if err != nil {
 		log.Printf("Error on loading simios from files. Details: %s", err)
@@ -56,7 +440,18 @@ func NewSimioDAO(dir string) DAO {
 		data = make(map[string]SimioEntity)
 	}
 
+	aliases := make(map[string]string)
+	for id, entity := range data {
+		if _, stillStored := data[entity.PreviousID]; entity.PreviousID != "" && !stillStored {
+			aliases[entity.PreviousID] = id
+		}
+	}
+
 	return &SimioDAO{
-		Data: data,
+		simians: int64(counts.Simians),
+		humans:  int64(counts.Humans),
+		dir:     filepath.Clean(dir) + "/",
+		data:    data,
+		aliases: aliases,
 	}
 }
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests are meant to be run with -race.
+
+func stressSize() int {
+	if testing.Short() {
+		return 20
+	}
+	return 200
+}
+
+func TestConcurrentSaveAndRead(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	simioDAO := NewSimioDAO(getDefaultDirectory())
+	size := stressSize()
+	writers, readers := 8, 4
+
+	var wg sync.WaitGroup
+
+	for reader := 0; reader < readers; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < size; i++ {
+				simioDAO.Get(fmt.Sprint(i))
+				simioDAO.Snapshot()
+				simioDAO.List(ListQuery{Limit: 10})
+			}
+		}()
+	}
+
+	for writer := 0; writer < writers; writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for i := 0; i < size; i++ {
+				// Writers save overlapping IDs, so the same entity is saved
+				// concurrently too.
+				id := fmt.Sprint((writer%2)*size + i)
+				_, err := simioDAO.Save(SimioEntity{ID: id, IsSimian: i%2 == 0})
+				assert.Nil(err)
+			}
+		}(writer)
+	}
+
+	wg.Wait()
+
+	assert.Equal(2*size, len(simioDAO.Snapshot()))
+	assert.Equal(2*size, len(NewSimioDAO(getDefaultDirectory()).Snapshot()))
+}
+
+func TestConcurrentSaveAndDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	simioDAO := NewSimioDAO(getDefaultDirectory())
+	size := stressSize()
+
+	var entities []SimioEntity
+	for i := 0; i < size; i++ {
+		entities = append(entities, SimioEntity{ID: fmt.Sprint(i)}, SimioEntity{ID: fmt.Sprint(2*size + i)})
+	}
+	_, err := simioDAO.SaveAll(entities)
+	assert.Nil(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < size; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			deleted, err := simioDAO.Delete(fmt.Sprint(i))
+			assert.True(deleted)
+			assert.Nil(err)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			assert.True(simioDAO.Save(SimioEntity{ID: fmt.Sprint(size + i)}))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			previousID := fmt.Sprint(2*size + i)
+			assert.Nil(simioDAO.Replace(previousID, SimioEntity{ID: "sha256:" + previousID}))
+		}(i)
+	}
+	wg.Wait()
+
+	snapshot := simioDAO.Snapshot()
+	assert.Equal(2*size, len(snapshot))
+	for _, entity := range snapshot {
+		_, found := simioDAO.Get(entity.ID)
+		assert.True(found)
+	}
+	assert.Equal(2*size, len(NewSimioDAO(getDefaultDirectory()).Snapshot()))
+}
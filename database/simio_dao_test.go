@@ -3,6 +3,7 @@ package database
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,14 +22,25 @@ func TestSave(t *testing.T) {
 	dataMoreHumans["333"] = SimioEntity{ID: "333", DNA: "AACG|DTTT", IsSimian: false}
 
 	simioDAO := SimioDAO{
-		Data: dataMoreHumans,
+		dir:  getDefaultDirectory(),
+		data: dataMoreHumans,
 	}
 
 	newEntity := SimioEntity{ID: "4454", DNA: "AACG|DTTT", IsSimian: false}
 
-	err := simioDAO.Save(newEntity)
+	inserted, err := simioDAO.Save(newEntity)
 	assert.Nil(err)
-	simioDAO.Save(newEntity)
+	assert.True(inserted)
+	inserted, err = simioDAO.Save(newEntity)
+	assert.Nil(err)
+	assert.False(inserted)
+
+	savedEntity, found := simioDAO.Get(newEntity.ID)
+	assert.True(found)
+	assert.Equal(newEntity, savedEntity)
+
+	_, found = simioDAO.Get("555")
+	assert.False(found)
 
 	defer cleanFiles()
 }
@@ -38,7 +50,7 @@ func TestBuildSimioDAO(t *testing.T) {
 
 	simioDAO := NewSimioDAO("dasdadasd")
 
-	assert.Empty(simioDAO.GetData())
+	assert.Empty(simioDAO.Snapshot())
 
 	entities := []SimioEntity{
 		SimioEntity{ID: "111", DNA: "ACCG|DGCT", IsSimian: true},
@@ -47,13 +59,211 @@ func TestBuildSimioDAO(t *testing.T) {
 	}
 
 	for _, entity := range entities {
-		saveEntityOnFile(entity.ID, entity)
+		saveEntityOnFile(getDefaultDirectory(), entity.ID, entity)
 	}
 
 	simioDAO = BuildSimioDAO()
 
 	assert.NotNil(simioDAO)
-	assert.Equal(len(entities), len(simioDAO.GetData()))
+	assert.Equal(len(entities), len(simioDAO.Snapshot()))
+
+	defer cleanFiles()
+}
+
+func TestReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	legacy := SimioEntity{ID: "111", DNA: "ACCG|DGCT", IsSimian: true}
+	saveEntityOnFile(getDefaultDirectory(), legacy.ID, legacy)
+
+	simioDAO := NewSimioDAO(getDefaultDirectory())
+
+	migrated := legacy
+	migrated.ID = "sha256:222"
+	err := simioDAO.Replace(legacy.ID, migrated)
+	assert.Nil(err)
+
+	assert.False(checkFileExist(legacy.ID))
+	assert.True(checkFileExist("sha256_222"))
+
+	entity, found := simioDAO.Get(legacy.ID)
+	assert.True(found)
+	assert.Equal("sha256:222", entity.ID)
+	assert.Equal(legacy.ID, entity.PreviousID)
+
+	simioDAO = NewSimioDAO(getDefaultDirectory())
+
+	assert.Equal(1, len(simioDAO.Snapshot()))
+	entity, found = simioDAO.Get(legacy.ID)
+	assert.True(found)
+	assert.Equal("sha256:222", entity.ID)
+}
+
+func TestSaveAll(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	simioDAO := NewSimioDAO(getDefaultDirectory())
+	simioDAO.Save(SimioEntity{ID: "111", DNA: "ACCG|DGCT", IsSimian: true})
+
+	entities := []SimioEntity{
+		SimioEntity{ID: "111", DNA: "ACCG|DGCT", IsSimian: false},
+		SimioEntity{ID: "sha256:222", DNA: "AGCG|GGCT", IsSimian: false},
+		SimioEntity{ID: "333", DNA: "AACG|DTTT", IsSimian: true},
+	}
+
+	inserted, err := simioDAO.SaveAll(entities)
+	assert.Nil(err)
+	assert.Equal([]string{"sha256:222", "333"}, entityIDs(inserted))
+
+	entity, _ := simioDAO.Get("111")
+	assert.True(entity.IsSimian)
+	assert.True(checkFileExist("sha256_222"))
+	assert.Equal(3, len(simioDAO.Snapshot()))
+	assert.Equal(3, len(NewSimioDAO(getDefaultDirectory()).Snapshot()))
+}
+
+func entityIDs(entities []SimioEntity) []string {
+	ids := []string{}
+	for _, entity := range entities {
+		ids = append(ids, entity.ID)
+	}
+	return ids
+}
+
+func TestList(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		query           ListQuery
+		expectedIDs     []string
+		expectedHasMore bool
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	simian, human := true, false
+
+	simioDAO := SimioDAO{dir: getDefaultDirectory(), data: map[string]SimioEntity{
+		"aaa": SimioEntity{ID: "aaa", IsSimian: true, CreatedAt: start.Add(2 * time.Second)},
+		"bbb": SimioEntity{ID: "bbb", IsSimian: false, CreatedAt: start},
+		"ccc": SimioEntity{ID: "ccc", IsSimian: true, CreatedAt: start},
+		"ddd": SimioEntity{ID: "ddd", IsSimian: false, CreatedAt: start.Add(time.Second)},
+	}}
+
+	cases := []Case{
+		Case{query: ListQuery{}, expectedIDs: []string{"bbb", "ccc", "ddd", "aaa"}},
+		Case{query: ListQuery{Descending: true}, expectedIDs: []string{"aaa", "ddd", "ccc", "bbb"}},
+		Case{query: ListQuery{Limit: 2}, expectedIDs: []string{"bbb", "ccc"}, expectedHasMore: true},
+		Case{query: ListQuery{Limit: 4}, expectedIDs: []string{"bbb", "ccc", "ddd", "aaa"}},
+		Case{query: ListQuery{Limit: 2, AfterCreatedAt: start, AfterID: "ccc"}, expectedIDs: []string{"ddd", "aaa"}},
+		Case{query: ListQuery{Limit: 2, AfterCreatedAt: start, AfterID: "bbb"}, expectedIDs: []string{"ccc", "ddd"}, expectedHasMore: true},
+		Case{query: ListQuery{Descending: true, AfterCreatedAt: start.Add(time.Second), AfterID: "ddd"}, expectedIDs: []string{"ccc", "bbb"}},
+		Case{query: ListQuery{IsSimian: &simian}, expectedIDs: []string{"ccc", "aaa"}},
+		Case{query: ListQuery{IsSimian: &human, Descending: true, Limit: 1}, expectedIDs: []string{"ddd"}, expectedHasMore: true},
+		Case{query: ListQuery{AfterCreatedAt: start.Add(time.Hour), AfterID: "zzz"}, expectedIDs: []string{}},
+	}
+
+	for _, c := range cases {
+		page := simioDAO.List(c.query)
+		assert.Equal(c.expectedIDs, entityIDs(page.Entities))
+		assert.Equal(c.expectedHasMore, page.HasMore)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	migrated := SimioEntity{ID: "sha256:222", DNA: "AGCG|GGCT", PreviousID: "111"}
+	saveEntityOnFile(getDefaultDirectory(), fileNameFor(migrated.ID), migrated)
+	saveEntityOnFile(getDefaultDirectory(), "333", SimioEntity{ID: "333", DNA: "AACG|DTTT"})
+
+	simioDAO := NewSimioDAO(getDefaultDirectory())
+
+	deleted, err := simioDAO.Delete("111")
+	assert.Nil(err)
+	assert.True(deleted)
+	assert.False(checkFileExist("sha256_222"))
+
+	_, found := simioDAO.Get("111")
+	assert.False(found)
+	_, found = simioDAO.Get(migrated.ID)
+	assert.False(found)
+
+	deleted, err = simioDAO.Delete(migrated.ID)
+	assert.Nil(err)
+	assert.False(deleted)
+
+	deleted, err = simioDAO.Delete("333")
+	assert.Nil(err)
+	assert.True(deleted)
+
+	assert.Empty(simioDAO.Snapshot())
+	assert.Empty(NewSimioDAO(getDefaultDirectory()).Snapshot())
+}
+
+func TestLoadAllCreatedAt(t *testing.T) {
+	assert := assert.New(t)
 
 	defer cleanFiles()
+
+	createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	saveEntityOnFile(getDefaultDirectory(), "111", SimioEntity{ID: "111", CreatedAt: createdAt})
+	saveEntityOnFile(getDefaultDirectory(), "222", SimioEntity{ID: "222"})
+
+	modTime := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(getDefaultDirectory()+"222", modTime, modTime)
+
+	data, counts, err := LoadAll(getDefaultDirectory())
+	assert.Nil(err)
+	assert.Equal(Counts{Humans: 2}, counts)
+	assert.True(createdAt.Equal(data["111"].CreatedAt))
+	assert.True(modTime.Equal(data["222"].CreatedAt))
+}
+
+func TestCounts(t *testing.T) {
+	assert := assert.New(t)
+
+	defer cleanFiles()
+
+	saveEntityOnFile(getDefaultDirectory(), "111", SimioEntity{ID: "111", IsSimian: true})
+	saveEntityOnFile(getDefaultDirectory(), "222", SimioEntity{ID: "222"})
+
+	simioDAO := NewSimioDAO(getDefaultDirectory())
+	assert.Equal(Counts{Simians: 1, Humans: 1}, simioDAO.Counts())
+
+	simioDAO.Save(SimioEntity{ID: "333", IsSimian: true})
+	simioDAO.Save(SimioEntity{ID: "333", IsSimian: true})
+	assert.Equal(Counts{Simians: 2, Humans: 1}, simioDAO.Counts())
+
+	simioDAO.SaveAll([]SimioEntity{SimioEntity{ID: "222"}, SimioEntity{ID: "444"}, SimioEntity{ID: "555"}})
+	assert.Equal(Counts{Simians: 2, Humans: 3}, simioDAO.Counts())
+
+	simioDAO.Replace("111", SimioEntity{ID: "sha256:111", IsSimian: true})
+	assert.Equal(Counts{Simians: 2, Humans: 3}, simioDAO.Counts())
+
+	simioDAO.Delete("111")
+	simioDAO.Delete("222")
+	simioDAO.Delete("222")
+	assert.Equal(Counts{Simians: 1, Humans: 2}, simioDAO.Counts())
+
+	assert.Equal(simioDAO.Counts(), NewSimioDAO(getDefaultDirectory()).Counts())
+}
+
+func TestRecount(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDAO := SimioDAO{simians: 5, dir: getDefaultDirectory(), data: map[string]SimioEntity{
+		"111": SimioEntity{ID: "111", IsSimian: true},
+		"222": SimioEntity{ID: "222"},
+	}}
+
+	previous, counted := simioDAO.Recount()
+	assert.Equal(Counts{Simians: 5}, previous)
+	assert.Equal(Counts{Simians: 1, Humans: 1}, counted)
+	assert.Equal(counted, simioDAO.Counts())
 }
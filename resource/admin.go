@@ -0,0 +1,28 @@
+package resource
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireAdminToken lets a request through to next only when it carries token
+// as its bearer token. With no token configured the endpoint is disabled.
+func RequireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if token == "" {
+			buildResponse(rw, http.StatusForbidden, "Admin endpoints are disabled. Set SIMIO_ADMIN_TOKEN to enable them")
+			return
+		}
+
+		authorization := req.Header.Get("Authorization")
+		given := strings.TrimPrefix(authorization, "Bearer ")
+		if given == authorization || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			buildResponse(rw, http.StatusUnauthorized, "Invalid admin token")
+			return
+		}
+
+		next(rw, req)
+	}
+}
@@ -0,0 +1,46 @@
+package resource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAdminToken(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		token              string
+		authorization      string
+		expectedStatusCode int
+	}
+
+	cases := []Case{
+		Case{token: "secret", authorization: "Bearer secret", expectedStatusCode: http.StatusOK},
+		Case{token: "secret", authorization: "Bearer wrong", expectedStatusCode: http.StatusUnauthorized},
+		Case{token: "secret", authorization: "secret", expectedStatusCode: http.StatusUnauthorized},
+		Case{token: "secret", authorization: "", expectedStatusCode: http.StatusUnauthorized},
+		Case{token: "", authorization: "Bearer ", expectedStatusCode: http.StatusForbidden},
+		Case{token: "", authorization: "", expectedStatusCode: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		called := false
+		handler := RequireAdminToken(c.token, func(rw http.ResponseWriter, req *http.Request) {
+			called = true
+			rw.WriteHeader(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/stats/recount", nil)
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		assert.Equal(c.expectedStatusCode, rec.Code)
+		assert.Equal(c.expectedStatusCode == http.StatusOK, called)
+	}
+}
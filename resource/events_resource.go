@@ -0,0 +1,112 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"simio-api/config"
+	"simio-api/service"
+	"strconv"
+	"time"
+)
+
+const defaultStatsInterval = 10 * time.Second
+
+// EventsResource streams Server-Sent Events: every new classification, and a
+// stats snapshot on each interval.
+type EventsResource struct {
+	simioService  service.SimioService
+	statsInterval time.Duration
+}
+
+func (er *EventsResource) StreamEvents(rw http.ResponseWriter, req *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+
+	if !ok {
+		buildResponse(rw, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	lastEventID, resume, err := lastEventID(req)
+
+	if err != nil {
+		buildResponse(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subscription := er.simioService.Subscribe(lastEventID, resume)
+	defer subscription.Close()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+
+	for _, event := range subscription.Replay {
+		writeEvent(rw, event)
+	}
+	er.writeStats(rw)
+	flusher.Flush()
+
+	ticker := time.NewTicker(er.statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, open := <-subscription.Events:
+			if !open {
+				return
+			}
+			writeEvent(rw, event)
+		case <-ticker.C:
+			er.writeStats(rw)
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (er *EventsResource) writeStats(rw http.ResponseWriter) {
+	data, _ := json.Marshal(er.simioService.GetSimiansProportion())
+	writeEvent(rw, service.Event{Type: service.EventStats, Data: data})
+}
+
+func writeEvent(rw http.ResponseWriter, event service.Event) {
+	if event.ID != 0 {
+		fmt.Fprintf(rw, "id: %d\n", event.ID)
+	}
+	fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+}
+
+// lastEventID reads the Last-Event-ID header browsers send when reconnecting,
+// or the last_event_id query parameter.
+func lastEventID(req *http.Request) (uint64, bool, error) {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("Invalid Last-Event-ID ( %s )", value)
+	}
+	return id, true, nil
+}
+
+func BuildEventsResource(simioService service.SimioService) *EventsResource {
+	return NewEventsResource(simioService, config.Duration("SIMIO_EVENTS_STATS_INTERVAL", defaultStatsInterval))
+}
+
+func NewEventsResource(simioService service.SimioService, statsInterval time.Duration) *EventsResource {
+	if statsInterval <= 0 {
+		statsInterval = defaultStatsInterval
+	}
+	return &EventsResource{
+		simioService:  simioService,
+		statsInterval: statsInterval,
+	}
+}
@@ -0,0 +1,110 @@
+package resource
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"simio-api/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvents(t *testing.T, reader *bufio.Reader, count int) []string {
+	events := []string{}
+	current := []string{}
+
+	for len(events) < count {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error on reading the event stream. Details: %s", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			events = append(events, strings.Join(current, "|"))
+			current = []string{}
+			continue
+		}
+		current = append(current, line)
+	}
+	return events
+}
+
+func TestStreamEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		lastEventIDHeader string
+		lastEventIDQuery  string
+		expectedLastID    uint64
+		expectedResume    bool
+		expectedEvents    []string
+	}
+
+	stats := service.Stats{CountMutantDNA: 1, CountHumanDNA: 0, Ratio: 0}
+	statsEvent := `event: stats|data: {"count_mutant_dna":1,"count_human_dna":0,"ratio":0}`
+
+	cases := []Case{
+		Case{
+			expectedEvents: []string{statsEvent, `id: 2|event: classification|data: "live"`},
+		},
+		Case{
+			lastEventIDHeader: "0",
+			expectedResume:    true,
+			expectedEvents:    []string{`id: 1|event: classification|data: "buffered"`, statsEvent, `id: 2|event: classification|data: "live"`},
+		},
+		Case{
+			lastEventIDQuery: "1",
+			expectedLastID:   1,
+			expectedResume:   true,
+			expectedEvents:   []string{statsEvent, `id: 2|event: classification|data: "live"`},
+		},
+	}
+
+	for _, c := range cases {
+		bus := service.NewEventBus(10)
+		bus.Publish(service.EventClassification, "buffered")
+
+		simioServiceMock := &SimioServiceMock{}
+		simioServiceMock.On("GetSimiansProportion").Return(stats)
+		simioServiceMock.On("Subscribe", c.expectedLastID, c.expectedResume).Return(bus.Subscribe(c.expectedLastID, c.expectedResume))
+
+		server := httptest.NewServer(http.HandlerFunc(NewEventsResource(simioServiceMock, time.Hour).StreamEvents))
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+		if c.lastEventIDHeader != "" {
+			req.Header.Set("Last-Event-ID", c.lastEventIDHeader)
+		}
+		if c.lastEventIDQuery != "" {
+			req.URL.RawQuery = "last_event_id=" + c.lastEventIDQuery
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+		reader := bufio.NewReader(resp.Body)
+		events := readEvents(t, reader, len(c.expectedEvents)-1)
+		bus.Publish(service.EventClassification, "live")
+		events = append(events, readEvents(t, reader, 1)...)
+
+		assert.Equal(c.expectedEvents, events)
+		resp.Body.Close()
+		server.Close()
+	}
+}
+
+func TestStreamEventsInvalidLastEventID(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(NewEventsResource(&SimioServiceMock{}, time.Hour).StreamEvents))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?last_event_id=abc")
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
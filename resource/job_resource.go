@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"net/http"
+	"simio-api/service"
+
+	"github.com/gorilla/mux"
+)
+
+// JobRequest takes the payload of POST /simian or, when items is set, the one
+// of POST /simian/batch.
+type JobRequest struct {
+	SimioRequest
+	Items       []SimioRequest `json:"items,omitempty"`
+	CallbackURL string         `json:"callback_url,omitempty"`
+}
+
+func (jr *JobRequest) jobRequest() service.JobRequest {
+	if jr.Items != nil {
+		batchRequest := BatchRequest{Items: jr.Items}
+		return service.JobRequest{Items: batchRequest.batchItems(), Batch: true, CallbackURL: jr.CallbackURL}
+	}
+
+	return service.JobRequest{
+		Items:       []service.BatchItem{service.BatchItem{DNA: jr.DNA, Params: jr.detectionParams()}},
+		CallbackURL: jr.CallbackURL,
+	}
+}
+
+type JobResource struct {
+	jobService service.JobService
+}
+
+func (jr *JobResource) SubmitJob(rw http.ResponseWriter, req *http.Request) {
+	var jobRequest JobRequest
+
+	if err := decodeBody(req, &jobRequest); err != nil {
+		buildResponse(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := jr.jobService.Submit(jobRequest.jobRequest())
+
+	if err != nil {
+		buildResponse(rw, jobErrorStatusCode(err), err.Error())
+		return
+	}
+
+	rw.Header().Set("Location", "/jobs/"+job.ID)
+	buildJSONResponse(rw, http.StatusAccepted, job)
+}
+
+func (jr *JobResource) GetJob(rw http.ResponseWriter, req *http.Request) {
+	job, found := jr.jobService.Get(mux.Vars(req)["id"])
+
+	if !found {
+		buildResponse(rw, http.StatusNotFound, service.ErrJobNotFound.Error())
+		return
+	}
+
+	buildJSONResponse(rw, http.StatusOK, job)
+}
+
+func (jr *JobResource) CancelJob(rw http.ResponseWriter, req *http.Request) {
+	job, err := jr.jobService.Cancel(mux.Vars(req)["id"])
+
+	if err != nil {
+		buildResponse(rw, jobErrorStatusCode(err), err.Error())
+		return
+	}
+
+	buildJSONResponse(rw, http.StatusOK, job)
+}
+
+func jobErrorStatusCode(err error) int {
+	switch err {
+	case service.ErrJobNotFound:
+		return http.StatusNotFound
+	case service.ErrJobFinished:
+		return http.StatusConflict
+	case service.ErrJobQueueFull:
+		return http.StatusServiceUnavailable
+	}
+	return errorStatusCode(err)
+}
+
+func NewJobResource(jobService service.JobService) *JobResource {
+	return &JobResource{
+		jobService: jobService,
+	}
+}
@@ -0,0 +1,127 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"simio-api/service"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type JobServiceMock struct {
+	mock.Mock
+	service.JobService
+}
+
+func (jm *JobServiceMock) Submit(request service.JobRequest) (service.Job, error) {
+	args := jm.Called(request)
+	return args.Get(0).(service.Job), args.Error(1)
+}
+
+func (jm *JobServiceMock) Get(id string) (service.Job, bool) {
+	args := jm.Called(id)
+	return args.Get(0).(service.Job), args.Bool(1)
+}
+
+func (jm *JobServiceMock) Cancel(id string) (service.Job, error) {
+	args := jm.Called(id)
+	return args.Get(0).(service.Job), args.Error(1)
+}
+
+func newJobServer(jobService service.JobService) *httptest.Server {
+	jobResource := NewJobResource(jobService)
+	router := mux.NewRouter()
+	router.HandleFunc("/jobs", jobResource.SubmitJob).Methods("POST")
+	router.HandleFunc("/jobs/{id}", jobResource.GetJob).Methods("GET")
+	router.HandleFunc("/jobs/{id}", jobResource.CancelJob).Methods("DELETE")
+	return httptest.NewServer(router)
+}
+
+func TestSubmitJob(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		request            string
+		jobRequest         service.JobRequest
+		submitErr          error
+		expectedStatusCode int
+	}
+
+	cases := []Case{
+		Case{
+			request:            `{"dna": ["CCCG", "AAAT", "GGGA", "TTTT"], "min_sequences": 2}`,
+			jobRequest:         service.JobRequest{Items: []service.BatchItem{service.BatchItem{DNA: dnaSimianHorizontal, Params: service.DetectionParams{MinSequences: 2}}}},
+			expectedStatusCode: http.StatusAccepted,
+		},
+		Case{
+			request:            `{"items": [{"dna": ["CCCG", "AAAT", "GGGA", "TTTT"]}, {"dna": ["CGAT", "GTCA", "TACG", "TCGA"]}], "callback_url": "http://localhost/hook"}`,
+			jobRequest:         service.JobRequest{Batch: true, Items: []service.BatchItem{service.BatchItem{DNA: dnaSimianHorizontal}, service.BatchItem{DNA: dnaHuman}}, CallbackURL: "http://localhost/hook"},
+			expectedStatusCode: http.StatusAccepted,
+		},
+		Case{
+			request:            `{"items": [{"dna": ["CCCG", "AAAT", "GGGA", "TTTT"]}]}`,
+			jobRequest:         service.JobRequest{Batch: true, Items: []service.BatchItem{service.BatchItem{DNA: dnaSimianHorizontal}}},
+			submitErr:          service.ErrJobQueueFull,
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		Case{request: "invalid", expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, currentCase := range cases {
+		jobServiceMocked := new(JobServiceMock)
+		jobServiceMocked.On("Submit", currentCase.jobRequest).
+			Return(service.Job{ID: "abc", Status: service.JobQueued}, currentCase.submitErr)
+
+		server := newJobServer(jobServiceMocked)
+
+		respBody, resultStatusCode := doRequest(server.URL+"/jobs", currentCase.request, http.MethodPost)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode)
+
+		if currentCase.expectedStatusCode == http.StatusAccepted {
+			var job service.Job
+			assert.Nil(json.Unmarshal([]byte(respBody), &job))
+			assert.Equal("abc", job.ID)
+		}
+
+		server.Close()
+	}
+}
+
+func TestGetAndCancelJob(t *testing.T) {
+	assert := assert.New(t)
+
+	job := service.Job{ID: "abc", Status: service.JobDone, Progress: service.JobProgress{Done: 1, Total: 1}}
+
+	jobServiceMocked := new(JobServiceMock)
+	jobServiceMocked.On("Get", "abc").Return(job, true)
+	jobServiceMocked.On("Get", "unknown").Return(service.Job{}, false)
+	jobServiceMocked.On("Cancel", "abc").Return(job, service.ErrJobFinished)
+	jobServiceMocked.On("Cancel", "def").Return(service.Job{ID: "def", Status: service.JobCancelled}, nil)
+	jobServiceMocked.On("Cancel", "unknown").Return(service.Job{}, service.ErrJobNotFound)
+
+	server := newJobServer(jobServiceMocked)
+	defer server.Close()
+
+	respBody, statusCode := doRequest(server.URL+"/jobs/abc", "", http.MethodGet)
+	assert.Equal(http.StatusOK, statusCode)
+	var result service.Job
+	assert.Nil(json.Unmarshal([]byte(respBody), &result))
+	assert.Equal(job.Progress, result.Progress)
+
+	_, statusCode = doRequest(server.URL+"/jobs/unknown", "", http.MethodGet)
+	assert.Equal(http.StatusNotFound, statusCode)
+
+	_, statusCode = doRequest(server.URL+"/jobs/abc", "", http.MethodDelete)
+	assert.Equal(http.StatusConflict, statusCode)
+
+	_, statusCode = doRequest(server.URL+"/jobs/def", "", http.MethodDelete)
+	assert.Equal(http.StatusOK, statusCode)
+
+	_, statusCode = doRequest(server.URL+"/jobs/unknown", "", http.MethodDelete)
+	assert.Equal(http.StatusNotFound, statusCode)
+}
@@ -0,0 +1,34 @@
+package resource
+
+import (
+	"net/http"
+	"simio-api/service"
+)
+
+type MigrationResource struct {
+	migrator service.IDMigrator
+}
+
+// StartMigration starts moving the stored entities to the IDs of SIMIO_HASH.
+// The API goes on serving them meanwhile, under either ID.
+func (mr *MigrationResource) StartMigration(rw http.ResponseWriter, req *http.Request) {
+	migration, started := mr.migrator.Start()
+
+	if !started {
+		buildJSONResponse(rw, http.StatusConflict, migration)
+		return
+	}
+
+	rw.Header().Set("Location", "/admin/migrate-ids")
+	buildJSONResponse(rw, http.StatusAccepted, migration)
+}
+
+func (mr *MigrationResource) GetMigration(rw http.ResponseWriter, req *http.Request) {
+	buildJSONResponse(rw, http.StatusOK, mr.migrator.Status())
+}
+
+func NewMigrationResource(migrator service.IDMigrator) *MigrationResource {
+	return &MigrationResource{
+		migrator: migrator,
+	}
+}
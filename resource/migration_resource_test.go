@@ -0,0 +1,89 @@
+package resource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"simio-api/service"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type IDMigratorMock struct {
+	mock.Mock
+	service.IDMigrator
+}
+
+func (im *IDMigratorMock) Start() (service.IDMigration, bool) {
+	args := im.Called()
+	return args.Get(0).(service.IDMigration), args.Bool(1)
+}
+
+func (im *IDMigratorMock) Status() service.IDMigration {
+	args := im.Called()
+	return args.Get(0).(service.IDMigration)
+}
+
+func newMigrationServer(migrator service.IDMigrator) *httptest.Server {
+	migrationResource := NewMigrationResource(migrator)
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/migrate-ids", migrationResource.StartMigration).Methods("POST")
+	router.HandleFunc("/admin/migrate-ids", migrationResource.GetMigration).Methods("GET")
+	return httptest.NewServer(router)
+}
+
+func TestStartMigration(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		migration          service.IDMigration
+		started            bool
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	cases := []Case{
+		Case{
+			migration:          service.IDMigration{Running: true},
+			started:            true,
+			expectedStatusCode: http.StatusAccepted,
+			expectedBody:       `{"running": true, "migrated": 0}`,
+		},
+		Case{
+			migration:          service.IDMigration{Running: true},
+			started:            false,
+			expectedStatusCode: http.StatusConflict,
+			expectedBody:       `{"running": true, "migrated": 0}`,
+		},
+	}
+
+	for _, c := range cases {
+		migratorMocked := new(IDMigratorMock)
+		migratorMocked.On("Start").Return(c.migration, c.started)
+
+		server := newMigrationServer(migratorMocked)
+		respBody, statusCode := doRequest(server.URL+"/admin/migrate-ids", "", http.MethodPost)
+		server.Close()
+
+		assert.Equal(c.expectedStatusCode, statusCode)
+		assert.JSONEq(c.expectedBody, respBody)
+		migratorMocked.AssertNumberOfCalls(t, "Start", 1)
+	}
+}
+
+func TestGetMigration(t *testing.T) {
+	assert := assert.New(t)
+
+	migratorMocked := new(IDMigratorMock)
+	migratorMocked.On("Status").Return(service.IDMigration{Migrated: 3, Error: "UNEXPECTED_ERROR_ON_SAVE"})
+
+	server := newMigrationServer(migratorMocked)
+	defer server.Close()
+
+	respBody, statusCode := doRequest(server.URL+"/admin/migrate-ids", "", http.MethodGet)
+
+	assert.Equal(http.StatusOK, statusCode)
+	assert.JSONEq(`{"running": false, "migrated": 3, "error": "UNEXPECTED_ERROR_ON_SAVE"}`, respBody)
+}
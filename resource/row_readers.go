@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jsonRowReader reads the rows of the "dna" array one token at a time, so the
+// whole body never has to be in memory. Other keys are skipped.
+type jsonRowReader struct {
+	decoder *json.Decoder
+	started bool
+	done    bool
+}
+
+func newJSONRowReader(body io.Reader) *jsonRowReader {
+	return &jsonRowReader{
+		decoder: json.NewDecoder(body),
+	}
+}
+
+func (jr *jsonRowReader) ReadRow() (string, error) {
+	if !jr.started {
+		if err := jr.seekDNA(); err != nil {
+			return "", err
+		}
+		jr.started = true
+	}
+
+	if jr.done {
+		return "", io.EOF
+	}
+
+	if !jr.decoder.More() {
+		jr.done = true
+		if _, err := jr.decoder.Token(); err != nil {
+			return "", fmt.Errorf("Invalid Request Payload")
+		}
+		return "", io.EOF
+	}
+
+	var row string
+	if err := jr.decoder.Decode(&row); err != nil {
+		return "", fmt.Errorf("Invalid Request Payload")
+	}
+	return row, nil
+}
+
+func (jr *jsonRowReader) seekDNA() error {
+	invalidPayloadError := fmt.Errorf("Invalid Request Payload")
+
+	if token, err := jr.decoder.Token(); err != nil || token != json.Delim('{') {
+		return invalidPayloadError
+	}
+
+	for jr.decoder.More() {
+		key, err := jr.decoder.Token()
+		if err != nil {
+			return invalidPayloadError
+		}
+
+		if key == "dna" {
+			if token, err := jr.decoder.Token(); err != nil || token != json.Delim('[') {
+				return invalidPayloadError
+			}
+			return nil
+		}
+
+		var skipped json.RawMessage
+		if err := jr.decoder.Decode(&skipped); err != nil {
+			return invalidPayloadError
+		}
+	}
+
+	return invalidPayloadError
+}
+
+// textRowReader reads one row per line, ignoring blank lines.
+type textRowReader struct {
+	reader *bufio.Reader
+}
+
+func newTextRowReader(body io.Reader) *textRowReader {
+	return &textRowReader{
+		reader: bufio.NewReader(body),
+	}
+}
+
+func (tr *textRowReader) ReadRow() (string, error) {
+	for {
+		line, err := tr.reader.ReadString('\n')
+		row := strings.TrimSpace(line)
+
+		if row != "" {
+			return row, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -1,17 +1,93 @@
 package resource
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"simio-api/service"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
 )
 
 type SimioRequest struct {
-	DNA []string `json:"dna"`
+	DNA           []string `json:"dna"`
+	SequenceSize  int      `json:"sequence_size,omitempty"`
+	MinSequences  int      `json:"min_sequences,omitempty"`
+	Overlap       string   `json:"overlap,omitempty"`
+	Directions    []string `json:"directions,omitempty"`
+	Alphabet      string   `json:"alphabet,omitempty"`
+	MaxMismatches *int     `json:"max_mismatches,omitempty"`
+	Toroidal      *bool    `json:"toroidal,omitempty"`
+}
+
+func (sr *SimioRequest) detectionParams() service.DetectionParams {
+	var directions []service.Direction
+	for _, direction := range sr.Directions {
+		directions = append(directions, service.Direction(direction))
+	}
+
+	return service.DetectionParams{
+		SequenceSize:  sr.SequenceSize,
+		MinSequences:  sr.MinSequences,
+		Overlap:       service.Overlap(sr.Overlap),
+		Directions:    directions,
+		Alphabet:      sr.Alphabet,
+		MaxMismatches: sr.MaxMismatches,
+		Toroidal:      sr.Toroidal,
+	}
+}
+
+type BatchRequest struct {
+	Items       []SimioRequest `json:"items"`
+	CallbackURL string         `json:"callback_url,omitempty"`
+}
+
+func (br *BatchRequest) batchItems() []service.BatchItem {
+	items := make([]service.BatchItem, len(br.Items))
+	for index := range br.Items {
+		items[index] = service.BatchItem{DNA: br.Items[index].DNA, Params: br.Items[index].detectionParams()}
+	}
+	return items
+}
+
+type BatchResponse struct {
+	Results []service.BatchResult `json:"results"`
+}
+
+// RecountResponse holds the stats counters as they were and as recounted.
+type RecountResponse struct {
+	Counters service.Stats `json:"counters"`
+	Recount  service.Stats `json:"recount"`
+}
+
+type MotifRequest struct {
+	DNA        []string `json:"dna"`
+	Motifs     []string `json:"motifs"`
+	Directions []string `json:"directions,omitempty"`
+	Reverse    bool     `json:"reverse,omitempty"`
+	Alphabet   string   `json:"alphabet,omitempty"`
+}
+
+func (mr *MotifRequest) motifSearch() service.MotifSearch {
+	var directions []service.Direction
+	for _, direction := range mr.Directions {
+		directions = append(directions, service.Direction(direction))
+	}
+
+	return service.MotifSearch{
+		Motifs:     mr.Motifs,
+		Directions: directions,
+		Reverse:    mr.Reverse,
+		Alphabet:   mr.Alphabet,
+	}
 }
 
 type SimioResource struct {
@@ -27,10 +103,15 @@ func (sr *SimioResource) CheckSimian(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	isSimian, processErr := sr.simioService.ProcessDNA(simioRequest.DNA)
+	if isExplainRequested(req) {
+		sr.explainSimian(rw, req, simioRequest)
+		return
+	}
+
+	isSimian, processErr := sr.simioService.ProcessDNA(req.Context(), simioRequest.DNA, simioRequest.detectionParams())
 
 	if processErr != nil {
-		buildResponse(rw, http.StatusBadRequest, processErr.Error())
+		buildResponse(rw, errorStatusCode(processErr), processErr.Error())
 		return
 	}
 
@@ -43,16 +124,166 @@ func (sr *SimioResource) CheckSimian(rw http.ResponseWriter, req *http.Request)
 	}
 }
 
+func (sr *SimioResource) CheckSimianStream(rw http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	simioRequest, err := mapQueryToSimioRequest(req.URL.Query())
+
+	if err != nil {
+		buildResponse(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rows service.RowReader = newJSONRowReader(req.Body)
+	if isPlainText(req) {
+		rows = newTextRowReader(req.Body)
+	}
+
+	explain := isExplainRequested(req)
+	detection, err := sr.simioService.ProcessDNAStream(req.Context(), rows, simioRequest.detectionParams(), explain)
+
+	if err != nil {
+		buildResponse(rw, errorStatusCode(err), err.Error())
+		return
+	}
+
+	statusCode := http.StatusForbidden
+	if detection.IsSimian {
+		statusCode = http.StatusOK
+	}
+
+	if explain {
+		buildJSONResponse(rw, statusCode, detection)
+	} else {
+		buildResponse(rw, statusCode, "")
+	}
+}
+
+func (sr *SimioResource) explainSimian(rw http.ResponseWriter, req *http.Request, simioRequest *SimioRequest) {
+	detection, err := sr.simioService.ExplainDNA(req.Context(), simioRequest.DNA, simioRequest.detectionParams())
+
+	if err != nil {
+		buildResponse(rw, errorStatusCode(err), err.Error())
+		return
+	}
+
+	statusCode := http.StatusForbidden
+	if detection.IsSimian {
+		statusCode = http.StatusOK
+	}
+
+	buildJSONResponse(rw, statusCode, detection)
+}
+
+func (sr *SimioResource) CheckSimianBatch(rw http.ResponseWriter, req *http.Request) {
+	var batchRequest BatchRequest
+
+	if err := decodeBody(req, &batchRequest); err != nil {
+		buildResponse(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := sr.simioService.ProcessBatch(req.Context(), batchRequest.batchItems(), batchRequest.CallbackURL)
+
+	if err != nil {
+		buildResponse(rw, errorStatusCode(err), err.Error())
+		return
+	}
+
+	buildJSONResponse(rw, http.StatusOK, BatchResponse{Results: results})
+}
+
+func (sr *SimioResource) SearchMotifs(rw http.ResponseWriter, req *http.Request) {
+	var motifRequest MotifRequest
+
+	if err := decodeBody(req, &motifRequest); err != nil {
+		buildResponse(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := sr.simioService.SearchMotifs(req.Context(), motifRequest.DNA, motifRequest.motifSearch())
+
+	if err != nil {
+		buildResponse(rw, errorStatusCode(err), err.Error())
+		return
+	}
+
+	buildJSONResponse(rw, http.StatusOK, result)
+}
+
+func (sr *SimioResource) GetSimian(rw http.ResponseWriter, req *http.Request) {
+	record, found := sr.simioService.GetRecord(mux.Vars(req)["id"])
+
+	if !found {
+		buildResponse(rw, http.StatusNotFound, "")
+		return
+	}
+
+	buildJSONResponse(rw, http.StatusOK, record)
+}
+
+func (sr *SimioResource) ListSimians(rw http.ResponseWriter, req *http.Request) {
+	query, err := mapToRecordQuery(req.URL.Query())
+
+	if err != nil {
+		buildResponse(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := sr.simioService.ListRecords(query)
+
+	if err != nil {
+		buildResponse(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	buildJSONResponse(rw, http.StatusOK, page)
+}
+
+func (sr *SimioResource) DeleteSimian(rw http.ResponseWriter, req *http.Request) {
+	deleted, err := sr.simioService.DeleteRecord(mux.Vars(req)["id"])
+
+	if err != nil {
+		buildResponse(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !deleted {
+		buildResponse(rw, http.StatusNotFound, "")
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
 func (sr *SimioResource) GetSimiansProportion(rw http.ResponseWriter, req *http.Request) {
 	stats := sr.simioService.GetSimiansProportion()
-	responseBody, _ := json.Marshal(stats)
+	buildJSONResponse(rw, http.StatusOK, stats)
+}
 
-	rw.Header().Set("Content-Type", "application/json")
-	rw.WriteHeader(http.StatusOK)
-	rw.Write([]byte(responseBody))
+// RecountStats recounts the stored entities in the running API, whose
+// counters are the ones the stats are served from, and fixes them.
+func (sr *SimioResource) RecountStats(rw http.ResponseWriter, req *http.Request) {
+	counters, counted := sr.simioService.RecountStats()
+	buildJSONResponse(rw, http.StatusOK, RecountResponse{Counters: counters, Recount: counted})
+}
+
+func isExplainRequested(req *http.Request) bool {
+	explain, err := strconv.ParseBool(req.URL.Query().Get("explain"))
+	return err == nil && explain
 }
 
 func mapToSimioRequest(req *http.Request) (*SimioRequest, error) {
+	var simioRequest SimioRequest
+
+	if err := decodeBody(req, &simioRequest); err != nil {
+		return nil, err
+	}
+
+	return &simioRequest, nil
+}
+
+func decodeBody(req *http.Request, payload interface{}) error {
 
 	defaultInvalidPayloadError := fmt.Errorf("Invalid Request Payload")
 
@@ -62,20 +293,77 @@ func mapToSimioRequest(req *http.Request) (*SimioRequest, error) {
 
 	if err != nil {
 		log.Printf("%+v", err)
-		return nil, defaultInvalidPayloadError
+		return defaultInvalidPayloadError
 	}
 
-	var simioRequest SimioRequest
-	err = json.Unmarshal([]byte(bodyString), &simioRequest)
+	err = json.Unmarshal([]byte(bodyString), payload)
 
 	if err != nil {
 		log.Printf("%+v", err)
-		return nil, defaultInvalidPayloadError
+		return defaultInvalidPayloadError
 	}
 
+	return nil
+}
+
+// mapQueryToSimioRequest reads the detection parameters of a streamed
+// request, whose body only holds the matrix.
+func mapQueryToSimioRequest(query url.Values) (*SimioRequest, error) {
+	var simioRequest SimioRequest
+	var err error
+
+	if value := query.Get("sequence_size"); value != "" {
+		if simioRequest.SequenceSize, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("Invalid sequence_size ( %s )", value)
+		}
+	}
+
+	if value := query.Get("min_sequences"); value != "" {
+		if simioRequest.MinSequences, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("Invalid min_sequences ( %s )", value)
+		}
+	}
+
+	if value := query.Get("directions"); value != "" {
+		simioRequest.Directions = strings.Split(value, ",")
+	}
+
+	simioRequest.Overlap = query.Get("overlap")
+	simioRequest.Alphabet = query.Get("alphabet")
+
 	return &simioRequest, nil
 }
 
+func mapToRecordQuery(query url.Values) (service.RecordQuery, error) {
+	recordQuery := service.RecordQuery{
+		Cursor: query.Get("cursor"),
+		Order:  query.Get("order"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return recordQuery, fmt.Errorf("Invalid limit ( %s )", value)
+		}
+		recordQuery.Limit = limit
+	}
+
+	if value := query.Get("is_simian"); value != "" {
+		isSimian, err := strconv.ParseBool(value)
+		if err != nil {
+			return recordQuery, fmt.Errorf("Invalid is_simian ( %s )", value)
+		}
+		recordQuery.IsSimian = &isSimian
+	}
+
+	return recordQuery, nil
+}
+
+func isPlainText(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/plain"
+}
+
 func getBody(body io.ReadCloser) (string, error) {
 	var responseBody string
 
@@ -101,6 +389,23 @@ func buildResponse(rw http.ResponseWriter, statusCode int, errorMsg string) {
 	rw.Write([]byte(responseMessage))
 }
 
+// errorStatusCode tells a request the client gave up on, or that timed out,
+// apart from an invalid one.
+func errorStatusCode(err error) int {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+func buildJSONResponse(rw http.ResponseWriter, statusCode int, body interface{}) {
+	responseBody, _ := json.Marshal(body)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+	rw.Write(responseBody)
+}
+
 func BuildSimioResource() *SimioResource {
 	return NewSimioResource(service.BuildSimioService())
 }
@@ -1,8 +1,10 @@
 package resource
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -23,23 +26,82 @@ var (
 	dnaEmpty            = []string{}
 )
 
-//Mocking simio service
+// Mocking simio service
 type SimioServiceMock struct {
 	mock.Mock
 	service.SimioService
 }
 
-func (sm *SimioServiceMock) ProcessDNA(dna []string) (bool, error) {
-	args := sm.Called(dna)
+func (sm *SimioServiceMock) ProcessDNA(ctx context.Context, dna []string, params service.DetectionParams) (bool, error) {
+	args := sm.Called(dna, params)
 	return args.Bool(0), args.Error(1)
 }
 
+func (sm *SimioServiceMock) ExplainDNA(ctx context.Context, dna []string, params service.DetectionParams) (service.Detection, error) {
+	args := sm.Called(dna, params)
+	return args.Get(0).(service.Detection), args.Error(1)
+}
+
+func (sm *SimioServiceMock) ProcessDNAStream(ctx context.Context, rows service.RowReader, params service.DetectionParams, explain bool) (service.Detection, error) {
+	dna := []string{}
+	for {
+		row, err := rows.ReadRow()
+		if err != nil {
+			break
+		}
+		dna = append(dna, row)
+	}
+
+	args := sm.Called(dna, params, explain)
+	return args.Get(0).(service.Detection), args.Error(1)
+}
+
+func (sm *SimioServiceMock) SearchMotifs(ctx context.Context, dna []string, search service.MotifSearch) (service.MotifResult, error) {
+	args := sm.Called(dna, search)
+	return args.Get(0).(service.MotifResult), args.Error(1)
+}
+
+func (sm *SimioServiceMock) ProcessBatch(ctx context.Context, items []service.BatchItem, callbackURL string) ([]service.BatchResult, error) {
+	args := sm.Called(items, callbackURL)
+	results, _ := args.Get(0).([]service.BatchResult)
+	return results, args.Error(1)
+}
+
 func (sm *SimioServiceMock) GetSimiansProportion() service.Stats {
 	args := sm.Called()
 	return args.Get(0).(service.Stats)
 }
 
+func (sm *SimioServiceMock) RecountStats() (service.Stats, service.Stats) {
+	args := sm.Called()
+	return args.Get(0).(service.Stats), args.Get(1).(service.Stats)
+}
+
+func (sm *SimioServiceMock) GetRecord(id string) (service.Record, bool) {
+	args := sm.Called(id)
+	return args.Get(0).(service.Record), args.Bool(1)
+}
+
+func (sm *SimioServiceMock) ListRecords(query service.RecordQuery) (service.RecordPage, error) {
+	args := sm.Called(query)
+	return args.Get(0).(service.RecordPage), args.Error(1)
+}
+
+func (sm *SimioServiceMock) DeleteRecord(id string) (bool, error) {
+	args := sm.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (sm *SimioServiceMock) Subscribe(lastEventID uint64, resume bool) service.Subscription {
+	args := sm.Called(lastEventID, resume)
+	return args.Get(0).(service.Subscription)
+}
+
 func doRequest(url string, reqBody string, method string) (string, int) {
+	return doRequestWithContentType(url, reqBody, method, "application/json")
+}
+
+func doRequestWithContentType(url string, reqBody string, method string, contentType string) (string, int) {
 	client := &http.Client{
 		Timeout: 5 * time.Second,
 	}
@@ -50,6 +112,7 @@ func doRequest(url string, reqBody string, method string) (string, int) {
 		req, _ = http.NewRequest(method, url, nil)
 	} else {
 		req, _ = http.NewRequest(method, url, strings.NewReader(string(reqBody)))
+		req.Header.Set("Content-Type", contentType)
 	}
 
 	resp, err := client.Do(req)
@@ -70,7 +133,7 @@ func doRequest(url string, reqBody string, method string) (string, int) {
 	return respBody, resp.StatusCode
 }
 
-//Test Resources
+// Test Resources
 func TestCheckSimian(t *testing.T) {
 	assert := assert.New(t)
 
@@ -91,7 +154,7 @@ func TestCheckSimian(t *testing.T) {
 
 	for _, currentCase := range cases {
 		simioServiceMocked := new(SimioServiceMock)
-		simioServiceMocked.On("ProcessDNA", currentCase.request.DNA).
+		simioServiceMocked.On("ProcessDNA", currentCase.request.DNA, mock.Anything).
 			Return(currentCase.processResult, currentCase.procesResultErr)
 
 		simioResource := NewSimioResource(simioServiceMocked)
@@ -108,6 +171,272 @@ func TestCheckSimian(t *testing.T) {
 	}
 }
 
+func TestCheckSimianExplained(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		request            SimioRequest
+		detection          service.Detection
+		processErr         error
+		expectedStatusCode int
+	}
+
+	simianDetection := service.Detection{
+		IsSimian: true,
+		Sequences: []service.Sequence{
+			service.Sequence{StartRow: 3, StartCol: 0, EndRow: 3, EndCol: 3, Direction: service.Horizontal, Base: "T"},
+		},
+	}
+
+	cases := []Case{
+		Case{request: SimioRequest{DNA: dnaSimianHorizontal}, detection: simianDetection, expectedStatusCode: http.StatusOK},
+		Case{request: SimioRequest{DNA: dnaHuman}, detection: service.Detection{Sequences: []service.Sequence{}}, expectedStatusCode: http.StatusForbidden},
+		Case{request: SimioRequest{DNA: dnaInvalidFirstChar}, processErr: fmt.Errorf(""), expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, currentCase := range cases {
+		simioServiceMocked := new(SimioServiceMock)
+		simioServiceMocked.On("ExplainDNA", currentCase.request.DNA, mock.Anything).
+			Return(currentCase.detection, currentCase.processErr)
+
+		simioResource := NewSimioResource(simioServiceMocked)
+
+		server := httptest.NewServer(http.HandlerFunc(simioResource.CheckSimian))
+
+		body, _ := json.Marshal(currentCase.request)
+		respBody, resultStatusCode := doRequest(server.URL+"?explain=true", string(body), http.MethodPost)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode)
+		simioServiceMocked.AssertNotCalled(t, "ProcessDNA", mock.Anything, mock.Anything)
+
+		if currentCase.processErr == nil {
+			var detection service.Detection
+			assert.Nil(json.Unmarshal([]byte(respBody), &detection))
+			assert.Equal(currentCase.detection, detection)
+		}
+
+		server.Close()
+	}
+}
+
+func TestCheckSimianBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		request            string
+		items              []service.BatchItem
+		callbackURL        string
+		results            []service.BatchResult
+		processErr         error
+		expectedStatusCode int
+	}
+
+	results := []service.BatchResult{
+		service.BatchResult{Index: 0, ID: "111", IsSimian: true},
+		service.BatchResult{Index: 1, Error: "Matrix has invalid character ( Z )"},
+	}
+
+	cases := []Case{
+		Case{
+			request:     `{"items": [{"dna": ["CCCG", "AAAT", "GGGA", "TTTT"]}, {"dna": ["ZGTC"], "sequence_size": 5}], "callback_url": "http://localhost/hook"}`,
+			callbackURL: "http://localhost/hook",
+			items: []service.BatchItem{
+				service.BatchItem{DNA: dnaSimianHorizontal},
+				service.BatchItem{DNA: []string{"ZGTC"}, Params: service.DetectionParams{SequenceSize: 5}},
+			},
+			results:            results,
+			expectedStatusCode: http.StatusOK,
+		},
+		Case{
+			request:            `{"items": []}`,
+			items:              []service.BatchItem{},
+			processErr:         fmt.Errorf("Invalid batch size ( 0 ). It has to be between 1 and 1000"),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		Case{request: "invalid", expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, currentCase := range cases {
+		simioServiceMocked := new(SimioServiceMock)
+		simioServiceMocked.On("ProcessBatch", currentCase.items, currentCase.callbackURL).
+			Return(currentCase.results, currentCase.processErr)
+
+		simioResource := NewSimioResource(simioServiceMocked)
+
+		server := httptest.NewServer(http.HandlerFunc(simioResource.CheckSimianBatch))
+
+		respBody, resultStatusCode := doRequest(server.URL, currentCase.request, http.MethodPost)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode)
+
+		if currentCase.expectedStatusCode == http.StatusOK {
+			var response BatchResponse
+			assert.Nil(json.Unmarshal([]byte(respBody), &response))
+			assert.Equal(currentCase.results, response.Results)
+		}
+
+		server.Close()
+	}
+}
+
+func TestSearchMotifs(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		request            string
+		search             service.MotifSearch
+		result             service.MotifResult
+		searchErr          error
+		expectedStatusCode int
+	}
+
+	found := service.MotifResult{Count: 1, Hits: []service.MotifHit{
+		service.MotifHit{Motif: "AAAT", StartRow: 1, EndRow: 1, EndCol: 3, Direction: service.Horizontal},
+	}}
+
+	cases := []Case{
+		Case{
+			request:            `{"dna": ["CCCG", "AAAT", "GGGA", "TTTT"], "motifs": ["AAAT"], "directions": ["horizontal"], "reverse": true}`,
+			search:             service.MotifSearch{Motifs: []string{"AAAT"}, Directions: []service.Direction{service.Horizontal}, Reverse: true},
+			result:             found,
+			expectedStatusCode: http.StatusOK,
+		},
+		Case{
+			request:            `{"dna": ["CCCG", "AAAT", "GGGA", "TTTT"], "motifs": ["AZ"]}`,
+			search:             service.MotifSearch{Motifs: []string{"AZ"}},
+			searchErr:          fmt.Errorf("Motif has invalid character ( Z )"),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		Case{request: "invalid", expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, currentCase := range cases {
+		simioServiceMocked := new(SimioServiceMock)
+		simioServiceMocked.On("SearchMotifs", mock.Anything, currentCase.search).
+			Return(currentCase.result, currentCase.searchErr)
+
+		simioResource := NewSimioResource(simioServiceMocked)
+
+		server := httptest.NewServer(http.HandlerFunc(simioResource.SearchMotifs))
+
+		respBody, resultStatusCode := doRequest(server.URL, currentCase.request, http.MethodPost)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode)
+
+		if currentCase.expectedStatusCode == http.StatusOK {
+			var result service.MotifResult
+			assert.Nil(json.Unmarshal([]byte(respBody), &result))
+			assert.Equal(currentCase.result, result)
+		}
+
+		server.Close()
+	}
+}
+
+func TestCheckSimianStream(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		url                string
+		body               string
+		contentType        string
+		expectedDNA        []string
+		expectedParams     service.DetectionParams
+		expectedExplain    bool
+		detection          service.Detection
+		processErr         error
+		expectedStatusCode int
+	}
+
+	cases := []Case{
+		Case{
+			url:                "/simian/stream",
+			body:               `{"dna": ["CCCG", "AAAT", "GGGA", "TTTT"]}`,
+			contentType:        "application/json",
+			expectedDNA:        dnaSimianHorizontal,
+			detection:          service.Detection{IsSimian: true},
+			expectedStatusCode: http.StatusOK,
+		},
+		Case{
+			url:                "/simian/stream?sequence_size=5&directions=horizontal,vertical&explain=true",
+			body:               "CGAT\r\nGTCA\n\nTACG\nTCGA",
+			contentType:        "text/plain; charset=utf-8",
+			expectedDNA:        dnaHuman,
+			expectedParams:     service.DetectionParams{SequenceSize: 5, Directions: []service.Direction{service.Horizontal, service.Vertical}},
+			expectedExplain:    true,
+			detection:          service.Detection{Sequences: []service.Sequence{}},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		Case{
+			url:                "/simian/stream",
+			body:               `{"dna": ["ZGTC"]}`,
+			contentType:        "application/json",
+			expectedDNA:        []string{"ZGTC"},
+			processErr:         fmt.Errorf("Matrix has invalid character ( Z )"),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		Case{
+			url:                "/simian/stream?min_sequences=two",
+			body:               `{"dna": ["CGAT"]}`,
+			contentType:        "application/json",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, currentCase := range cases {
+		simioServiceMocked := new(SimioServiceMock)
+		simioServiceMocked.On("ProcessDNAStream", currentCase.expectedDNA, currentCase.expectedParams, currentCase.expectedExplain).
+			Return(currentCase.detection, currentCase.processErr)
+
+		simioResource := NewSimioResource(simioServiceMocked)
+
+		server := httptest.NewServer(http.HandlerFunc(simioResource.CheckSimianStream))
+
+		_, resultStatusCode := doRequestWithContentType(server.URL+currentCase.url, currentCase.body, http.MethodPost, currentCase.contentType)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode, "url %s", currentCase.url)
+
+		server.Close()
+	}
+}
+
+func TestJSONRowReader(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		body         string
+		expectedRows []string
+		expectedErr  bool
+	}
+
+	cases := []Case{
+		Case{body: `{"dna": ["GTCA", "CAGT"]}`, expectedRows: []string{"GTCA", "CAGT"}},
+		Case{body: `{"min_sequences": 2, "extra": {"a": [1, 2]}, "dna": ["GTCA"], "after": true}`, expectedRows: []string{"GTCA"}},
+		Case{body: `{"dna": []}`, expectedRows: []string{}},
+		Case{body: `{"sequence_size": 4}`, expectedRows: []string{}, expectedErr: true},
+		Case{body: `{"dna": ["GTCA", 12]}`, expectedRows: []string{"GTCA"}, expectedErr: true},
+		Case{body: `invalid`, expectedRows: []string{}, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		reader := newJSONRowReader(strings.NewReader(currentCase.body))
+
+		rows := []string{}
+		var err error
+		for {
+			var row string
+			row, err = reader.ReadRow()
+			if err != nil {
+				break
+			}
+			rows = append(rows, row)
+		}
+
+		assert.Equal(currentCase.expectedRows, rows, "body %s", currentCase.body)
+		assert.Equal(currentCase.expectedErr, err != io.EOF, "body %s", currentCase.body)
+	}
+}
+
 func TestGetSimiansProportion(t *testing.T) {
 	assert := assert.New(t)
 
@@ -146,6 +475,155 @@ func TestGetSimiansProportion(t *testing.T) {
 	}
 }
 
+func TestRecountStats(t *testing.T) {
+	assert := assert.New(t)
+
+	counters := service.Stats{CountMutantDNA: 6, CountHumanDNA: 1, Ratio: 6}
+	counted := service.Stats{CountMutantDNA: 1, CountHumanDNA: 1, Ratio: 1}
+
+	simioServiceMocked := new(SimioServiceMock)
+	simioServiceMocked.On("RecountStats").Return(counters, counted)
+
+	simioResource := NewSimioResource(simioServiceMocked)
+	server := httptest.NewServer(http.HandlerFunc(simioResource.RecountStats))
+	defer server.Close()
+
+	respBody, statusCode := doRequest(server.URL, "", http.MethodPost)
+
+	assert.Equal(http.StatusOK, statusCode)
+	assert.JSONEq(`{
+		"counters": {"count_mutant_dna": 6, "count_human_dna": 1, "ratio": 6},
+		"recount": {"count_mutant_dna": 1, "count_human_dna": 1, "ratio": 1}
+	}`, respBody)
+}
+
+func newRecordServer(simioService service.SimioService) *httptest.Server {
+	simioResource := NewSimioResource(simioService)
+	router := mux.NewRouter()
+	router.HandleFunc("/simian", simioResource.ListSimians).Methods("GET")
+	router.HandleFunc("/simian/{id}", simioResource.GetSimian).Methods("GET")
+	router.HandleFunc("/simian/{id}", simioResource.DeleteSimian).Methods("DELETE")
+	return httptest.NewServer(router)
+}
+
+func TestGetSimian(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		id                 string
+		record             service.Record
+		found              bool
+		expectedStatusCode int
+	}
+
+	record := service.Record{ID: "sha256:111", DNA: dnaSimianHorizontal, IsSimian: true, CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	cases := []Case{
+		Case{id: "sha256:111", record: record, found: true, expectedStatusCode: http.StatusOK},
+		Case{id: "222", expectedStatusCode: http.StatusNotFound},
+	}
+
+	for _, currentCase := range cases {
+		simioServiceMocked := new(SimioServiceMock)
+		simioServiceMocked.On("GetRecord", currentCase.id).Return(currentCase.record, currentCase.found)
+
+		server := newRecordServer(simioServiceMocked)
+
+		respBody, resultStatusCode := doRequest(server.URL+"/simian/"+currentCase.id, "", http.MethodGet)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode)
+
+		if currentCase.found {
+			var result service.Record
+			assert.Nil(json.Unmarshal([]byte(respBody), &result))
+			assert.Equal(currentCase.record, result)
+		}
+
+		server.Close()
+	}
+}
+
+func TestListSimians(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		query              string
+		recordQuery        service.RecordQuery
+		page               service.RecordPage
+		listErr            error
+		expectedStatusCode int
+	}
+
+	simian := false
+	page := service.RecordPage{Records: []service.Record{service.Record{ID: "111", DNA: dnaHuman}}, NextCursor: "abc"}
+
+	cases := []Case{
+		Case{query: "", page: page, expectedStatusCode: http.StatusOK},
+		Case{
+			query:              "?cursor=abc&limit=10&is_simian=false&order=asc",
+			recordQuery:        service.RecordQuery{Cursor: "abc", Limit: 10, IsSimian: &simian, Order: "asc"},
+			page:               page,
+			expectedStatusCode: http.StatusOK,
+		},
+		Case{
+			query:              "?cursor=zzz",
+			recordQuery:        service.RecordQuery{Cursor: "zzz"},
+			listErr:            fmt.Errorf("Invalid cursor ( zzz )"),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		Case{query: "?limit=ten", expectedStatusCode: http.StatusBadRequest},
+		Case{query: "?is_simian=maybe", expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, currentCase := range cases {
+		simioServiceMocked := new(SimioServiceMock)
+		simioServiceMocked.On("ListRecords", currentCase.recordQuery).Return(currentCase.page, currentCase.listErr)
+
+		server := newRecordServer(simioServiceMocked)
+
+		respBody, resultStatusCode := doRequest(server.URL+"/simian"+currentCase.query, "", http.MethodGet)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode)
+
+		if currentCase.expectedStatusCode == http.StatusOK {
+			var result service.RecordPage
+			assert.Nil(json.Unmarshal([]byte(respBody), &result))
+			assert.Equal(currentCase.page, result)
+		}
+
+		server.Close()
+	}
+}
+
+func TestDeleteSimian(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		deleted            bool
+		deleteErr          error
+		expectedStatusCode int
+	}
+
+	cases := []Case{
+		Case{deleted: true, expectedStatusCode: http.StatusNoContent},
+		Case{deleted: false, expectedStatusCode: http.StatusNotFound},
+		Case{deleteErr: fmt.Errorf("UNEXPECTED_ERROR_ON_DELETE"), expectedStatusCode: http.StatusInternalServerError},
+	}
+
+	for _, currentCase := range cases {
+		simioServiceMocked := new(SimioServiceMock)
+		simioServiceMocked.On("DeleteRecord", "111").Return(currentCase.deleted, currentCase.deleteErr)
+
+		server := newRecordServer(simioServiceMocked)
+
+		_, resultStatusCode := doRequest(server.URL+"/simian/111", "", http.MethodDelete)
+
+		assert.Equal(currentCase.expectedStatusCode, resultStatusCode)
+
+		server.Close()
+	}
+}
+
 func TestMapToSimioRequest(t *testing.T) {
 	assert := assert.New(t)
 
@@ -156,6 +634,31 @@ func TestMapToSimioRequest(t *testing.T) {
 
 	assert.NotNil(err)
 	assert.NotNil(res)
+
+	paramsReq, _ := http.NewRequest(http.MethodPost, "url.test.com", strings.NewReader(string(`{"dna": ["GTCA"], "sequence_size": 5, "min_sequences": 2, "directions": ["horizontal", "anti_diagonal"]}`)))
+	res, err = mapToSimioRequest(paramsReq)
+
+	assert.Nil(err)
+	assert.Equal(service.DetectionParams{
+		SequenceSize: 5,
+		MinSequences: 2,
+		Directions:   []service.Direction{service.Horizontal, service.AntiDiagonal},
+	}, res.detectionParams())
+
+	fuzzyReq, _ := http.NewRequest(http.MethodPost, "url.test.com", strings.NewReader(string(`{"dna": ["GTCA"], "max_mismatches": 0}`)))
+	res, err = mapToSimioRequest(fuzzyReq)
+
+	assert.Nil(err)
+	assert.NotNil(res.detectionParams().MaxMismatches)
+	assert.Equal(0, *res.detectionParams().MaxMismatches)
+}
+
+func TestErrorStatusCode(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(http.StatusBadRequest, errorStatusCode(fmt.Errorf("Invalid DNA size")))
+	assert.Equal(http.StatusServiceUnavailable, errorStatusCode(context.Canceled))
+	assert.Equal(http.StatusServiceUnavailable, errorStatusCode(context.DeadlineExceeded))
 }
 
 func TestBuildResource(t *testing.T) {
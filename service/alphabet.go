@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+const customAlphabetPrefix = "custom:"
+
+// Alphabet is the set of characters a DNA may hold. Only Bases can form a
+// sequence: Ambiguous codes are accepted but always break a run, since they
+// do not tell which base is really there.
+type Alphabet struct {
+	Name      string
+	Bases     string
+	Ambiguous string
+	valid     [256]bool
+	runBase   [256]bool
+	// complement maps each character to its pair. It is empty on alphabets
+	// without base pairing, like the custom ones.
+	complement [256]byte
+}
+
+var (
+	DNAAlphabet   = NewAlphabet("dna", "ATCG", "").withComplement("ATCG", "TAGC")
+	RNAAlphabet   = NewAlphabet("rna", "AUCG", "").withComplement("AUCG", "UAGC")
+	IUPACAlphabet = NewAlphabet("iupac", "ATCG", "RYSWKMBDHVN").withComplement("ATCGRYSWKMBDHVN", "TAGCYRSWMKVHDBN")
+)
+
+var builtInAlphabets = []*Alphabet{DNAAlphabet, RNAAlphabet, IUPACAlphabet}
+
+func NewAlphabet(name string, bases string, ambiguous string) *Alphabet {
+	alphabet := &Alphabet{
+		Name:      name,
+		Bases:     bases,
+		Ambiguous: ambiguous,
+	}
+
+	for i := 0; i < len(ambiguous); i++ {
+		alphabet.valid[ambiguous[i]] = true
+	}
+	for i := 0; i < len(bases); i++ {
+		alphabet.valid[bases[i]] = true
+		alphabet.runBase[bases[i]] = true
+	}
+	return alphabet
+}
+
+// reservedBaseChars cannot be bases: | and # split the stored DNA, and ;, =
+// and , split the stored rules, which hold the alphabet name.
+const reservedBaseChars = "|#;=,"
+
+// parseCustomAlphabet builds the alphabet for names like "custom:ACGTX",
+// where every character after the prefix is a base.
+func parseCustomAlphabet(name string) (*Alphabet, error) {
+	bases := strings.TrimPrefix(name, customAlphabetPrefix)
+
+	if bases == "" {
+		return nil, fmt.Errorf("Invalid alphabet ( %s ). A custom alphabet needs at least one base", name)
+	}
+
+	for i := 0; i < len(bases); i++ {
+		if bases[i] <= ' ' || bases[i] > '~' || strings.IndexByte(reservedBaseChars, bases[i]) >= 0 || strings.IndexByte(bases[:i], bases[i]) >= 0 {
+			return nil, fmt.Errorf("Invalid alphabet ( %s ). Bases must be distinct printable characters other than whitespace and %s", name, reservedBaseChars)
+		}
+	}
+
+	return NewAlphabet(name, bases, ""), nil
+}
+
+func (a *Alphabet) withComplement(from string, to string) *Alphabet {
+	for i := 0; i < len(from); i++ {
+		a.complement[from[i]] = to[i]
+	}
+	return a
+}
+
+func (a *Alphabet) hasComplement() bool {
+	for i := 0; i < len(a.Bases); i++ {
+		if a.complement[a.Bases[i]] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Alphabet) isValid(base byte) bool {
+	return a.valid[base]
+}
+
+func (a *Alphabet) isRunBase(base byte) bool {
+	return a.runBase[base]
+}
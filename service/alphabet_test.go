@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"simio-api/database"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAlphabets(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna              []string
+		alphabet         string
+		expectedErr      bool
+		expectedResult   bool
+		expectedAlphabet string
+	}
+
+	cases := []Case{
+		Case{dna: []string{"UUUU", "ACGA", "CGAC", "GACG"}, alphabet: "rna", expectedResult: true, expectedAlphabet: "rna"},
+		Case{dna: []string{"UUUU", "ACGA", "CGAC", "GACG"}, alphabet: "", expectedErr: true},
+		Case{dna: []string{"TTTT", "ACGA", "CGAC", "GACG"}, alphabet: "rna", expectedErr: true},
+		Case{dna: []string{"AANAAA", "CGTCGT", "TCGATC", "GTCAGA"}, alphabet: "iupac", expectedResult: false, expectedAlphabet: "iupac"},
+		Case{dna: []string{"NNNN", "RRRR", "YSWK", "MBDH"}, alphabet: "iupac", expectedResult: false, expectedAlphabet: "iupac"},
+		Case{dna: []string{"AANAAAA", "CGTCGTC", "TCGATCG"}, alphabet: "iupac", expectedResult: true, expectedAlphabet: "iupac"},
+		Case{dna: []string{"AANAAAA", "CGTCGTC", "TCGATCG"}, alphabet: "dna", expectedErr: true},
+		Case{dna: []string{"XXXX", "XYXY", "YXYX", "XYYX"}, alphabet: "custom:XY", expectedResult: true, expectedAlphabet: "custom:XY"},
+		Case{dna: []string{"0101", "1010", "0110", "1001"}, alphabet: "binary", expectedResult: true, expectedAlphabet: "binary"},
+		Case{dna: dnaHuman, alphabet: "custom:", expectedErr: true},
+		Case{dna: dnaHuman, alphabet: "custom:AA", expectedErr: true},
+		Case{dna: dnaHuman, alphabet: "custom:A|C", expectedErr: true},
+		Case{dna: []string{"A;A;", ";A;A", "A;A;", ";A;A"}, alphabet: "custom:A;", expectedErr: true},
+		Case{dna: dnaHuman, alphabet: "klingon", expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioServiceWithSettings(Settings{
+			Rules:     Rules{SequenceSize: 4},
+			Alphabets: []*Alphabet{NewAlphabet("binary", "01", "")},
+		}, simioDaoMock)
+
+		res, err := simioService.ProcessDNA(context.Background(), currentCase.dna, DetectionParams{Alphabet: currentCase.alphabet})
+
+		if currentCase.expectedErr {
+			assert.NotNil(err, "alphabet %s", currentCase.alphabet)
+			simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+			continue
+		}
+
+		assert.Nil(err, "alphabet %s", currentCase.alphabet)
+		assert.Equal(currentCase.expectedResult, res, "alphabet %s", currentCase.alphabet)
+		simioDaoMock.AssertCalled(t, "Save", mock.MatchedBy(func(entity database.SimioEntity) bool {
+			return entity.Alphabet == currentCase.expectedAlphabet
+		}))
+	}
+}
+
+func TestParseCustomAlphabet(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		name          string
+		expectedBases string
+	}
+
+	cases := []Case{
+		Case{name: "custom:ACGTX", expectedBases: "ACGTX"},
+		Case{name: "custom:01", expectedBases: "01"},
+		Case{name: "custom:"},
+		Case{name: "custom:AA"},
+		Case{name: "custom:A C"},
+		Case{name: "custom:A\tC"},
+		Case{name: "custom:A|C"},
+		Case{name: "custom:A#C"},
+		Case{name: "custom:A;C"},
+		Case{name: "custom:A=C"},
+		Case{name: "custom:A,C"},
+	}
+
+	for _, c := range cases {
+		alphabet, err := parseCustomAlphabet(c.name)
+
+		if c.expectedBases == "" {
+			assert.NotNil(err, c.name)
+			continue
+		}
+		assert.Nil(err, c.name)
+		assert.Equal(c.expectedBases, alphabet.Bases)
+	}
+}
+
+func TestAlphabetRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections, Alphabet: DNAAlphabet}
+	assert.Equal("v2;size=4;min=1;overlap=disjoint", rules.String())
+
+	rules.Alphabet = RNAAlphabet
+	assert.Equal("v2;size=4;min=1;overlap=disjoint;alphabet=rna", rules.String())
+
+	assert.True(IUPACAlphabet.isValid('N'))
+	assert.False(IUPACAlphabet.isRunBase('N'))
+	assert.True(IUPACAlphabet.isRunBase('A'))
+	assert.False(DNAAlphabet.isValid('N'))
+}
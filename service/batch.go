@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"simio-api/database"
+	"sync"
+	"time"
+)
+
+const defaultBatchLimit = 1000
+
+type BatchItem struct {
+	DNA    []string
+	Params DetectionParams
+}
+
+// BatchResult is the verdict of one item of a batch, at the same index. Items
+// that could not be classified only carry the Error.
+type BatchResult struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	IsSimian bool   `json:"is_simian"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ProcessBatch classifies the items concurrently, each one on a single
+// worker, and saves the new entities in one write at the end. An invalid item
+// does not stop the others. When callbackURL is set the results are also
+// sent to it.
+func (ss *SimioServiceImpl) ProcessBatch(ctx context.Context, items []BatchItem, callbackURL string) ([]BatchResult, error) {
+	if len(items) == 0 || len(items) > ss.batchLimit {
+		return nil, fmt.Errorf("Invalid batch size ( %d ). It has to be between 1 and %d", len(items), ss.batchLimit)
+	}
+
+	if err := validateCallbackURL(ss.notifier, callbackURL); err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(items))
+	entities := make([]*database.SimioEntity, len(items))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < minInt(ss.workers, len(items)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index], entities[index] = ss.processBatchItem(ctx, index, items[index])
+			}
+		}()
+	}
+
+	for index := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var toSave []database.SimioEntity
+	saved := make(map[string]bool)
+	now := time.Now().UTC()
+	for _, entity := range entities {
+		if entity != nil && !saved[entity.ID] {
+			saved[entity.ID] = true
+			entity.CreatedAt = now
+			toSave = append(toSave, *entity)
+		}
+	}
+
+	var inserted []database.SimioEntity
+	if len(toSave) > 0 {
+		var err error
+		if inserted, err = ss.simioDAO.SaveAll(toSave); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entity := range inserted {
+		ss.events.Publish(EventClassification, newClassificationEvent(entity))
+	}
+
+	if callbackURL != "" {
+		ss.notifier.Notify(callbackURL, WebhookPayload{Event: "batch.finished", Results: results})
+	}
+
+	return results, nil
+}
+
+// processBatchItem returns the item verdict and, when it was not stored yet,
+// the entity to save.
+func (ss *SimioServiceImpl) processBatchItem(ctx context.Context, index int, item BatchItem) (BatchResult, *database.SimioEntity) {
+	result := BatchResult{Index: index}
+
+	rules, err := ss.rulesFor(item.Params)
+
+	if err == nil {
+		err = ss.validateDNA(item.DNA, rules.Alphabet)
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	stringDNA := ss.identityDNA(item.DNA, rules)
+	if cached, found := ss.findClassified(stringDNA, rules); found {
+		result.ID, result.IsSimian = cached.ID, cached.IsSimian
+		return result, nil
+	}
+
+	isSimian, err := scanParallel(ctx, ss.engine.prepare(item.DNA, rules), rules.Directions, 1, untilMinSequences(rules))
+
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	entity := ss.newSimioEntity(stringDNA, isSimian, rules)
+	result.ID, result.IsSimian = entity.ID, isSimian
+	return result, &entity
+}
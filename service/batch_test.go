@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProcessBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioDaoMock.On("SaveAll", mock.Anything).Return(nil)
+	simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Workers: 3}, simioDaoMock).(*SimioServiceImpl)
+
+	items := []BatchItem{
+		BatchItem{DNA: dnaSimianHorizontal},
+		BatchItem{DNA: dnaHuman},
+		BatchItem{DNA: dnaInvalidFirstChar},
+		BatchItem{DNA: dnaSimianHorizontal},
+		BatchItem{DNA: dnaHuman, Params: DetectionParams{SequenceSize: 1}},
+		BatchItem{DNA: dnaSimianHorizontal3x6},
+	}
+
+	results, err := simioService.ProcessBatch(context.Background(), items, "")
+
+	assert.Nil(err)
+	assert.Equal([]BatchResult{
+		BatchResult{Index: 0, ID: simioService.mapToSimioEntity(dnaSimianHorizontal, true, simioService.rules).ID, IsSimian: true},
+		BatchResult{Index: 1, ID: simioService.mapToSimioEntity(dnaHuman, false, simioService.rules).ID},
+		BatchResult{Index: 2, Error: "Matrix has invalid character ( Z )"},
+		BatchResult{Index: 3, ID: simioService.mapToSimioEntity(dnaSimianHorizontal, true, simioService.rules).ID, IsSimian: true},
+		BatchResult{Index: 4, Error: "Invalid sequence_size ( 1 ). It has to be between 2 and 32"},
+		BatchResult{Index: 5, ID: simioService.mapToSimioEntity(dnaSimianHorizontal3x6, true, simioService.rules).ID, IsSimian: true},
+	}, results)
+
+	simioDaoMock.AssertNumberOfCalls(t, "SaveAll", 1)
+	saved := simioDaoMock.Calls[len(simioDaoMock.Calls)-1].Arguments.Get(0).([]database.SimioEntity)
+	assert.Equal(3, len(saved))
+}
+
+func TestProcessBatchErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		items   []BatchItem
+		ctx     context.Context
+		saveErr error
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []Case{
+		Case{items: []BatchItem{}, ctx: context.Background()},
+		Case{items: make([]BatchItem, 3), ctx: context.Background()},
+		Case{items: []BatchItem{BatchItem{DNA: dnaHuman}}, ctx: cancelled},
+		Case{items: []BatchItem{BatchItem{DNA: dnaHuman}}, ctx: context.Background(), saveErr: fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE")},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioDaoMock.On("SaveAll", mock.Anything).Return(currentCase.saveErr)
+		simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, BatchLimit: 2}, simioDaoMock)
+
+		_, err := simioService.ProcessBatch(currentCase.ctx, currentCase.items, "")
+
+		assert.NotNil(err)
+	}
+}
+
+func TestProcessBatchCached(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{ID: "111", IsSimian: true}, true)
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	results, err := simioService.ProcessBatch(context.Background(), []BatchItem{BatchItem{DNA: dnaHuman}}, "")
+
+	assert.Nil(err)
+	assert.Equal([]BatchResult{BatchResult{Index: 0, ID: "111", IsSimian: true}}, results)
+	simioDaoMock.AssertNotCalled(t, "SaveAll", mock.Anything)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	cellsPerWord = 32
+	// lowBits has the low bit of every 2-bit cell set.
+	lowBits = 0x5555555555555555
+)
+
+// packedMatrix holds a matrix with 2 bits per base. codes keeps the index of
+// each base in the alphabet and runs flags (on the low bit of the cell) the
+// cells holding a base that can take part in a run.
+type packedMatrix struct {
+	rules Rules
+	rows  int
+	cols  int
+	words int
+	codes []uint64
+	runs  []uint64
+	bases [4]byte
+	// links are computed once per direction and shared by every band.
+	linksOnce [4]sync.Once
+	linksData [4][]uint64
+}
+
+var directionOffsets = map[Direction][2]int{
+	Horizontal:   [2]int{0, 1},
+	Vertical:     [2]int{1, 0},
+	Diagonal:     [2]int{1, 1},
+	AntiDiagonal: [2]int{-1, 1},
+}
+
+func packMatrix(dna []string, rules Rules) (*packedMatrix, bool) {
+	alphabet := rules.Alphabet
+	if len(dna) == 0 || len(dna[0]) == 0 || len(alphabet.Bases) > len(packedMatrix{}.bases) || rules.SequenceSize < 2 || rules.MaxMismatches > 0 || rules.Toroidal {
+		return nil, false
+	}
+
+	rows, cols := len(dna), len(dna[0])
+	words := (cols + cellsPerWord - 1) / cellsPerWord
+	m := &packedMatrix{
+		rules: rules,
+		rows:  rows,
+		cols:  cols,
+		words: words,
+		codes: make([]uint64, rows*words),
+		runs:  make([]uint64, rows*words),
+	}
+
+	var codeOf [256]uint64
+	for i := 0; i < len(alphabet.Bases); i++ {
+		codeOf[alphabet.Bases[i]] = uint64(i)
+		m.bases[i] = alphabet.Bases[i]
+	}
+
+	for row := 0; row < rows; row++ {
+		codes, runs := m.row(m.codes, row), m.row(m.runs, row)
+		line := dna[row]
+		for col := 0; col < cols; col++ {
+			base := line[col]
+			if alphabet.isRunBase(base) {
+				shift := uint(2 * (col % cellsPerWord))
+				codes[col/cellsPerWord] |= codeOf[base] << shift
+				runs[col/cellsPerWord] |= 1 << shift
+			}
+		}
+	}
+	return m, true
+}
+
+func (m *packedMatrix) row(data []uint64, row int) []uint64 {
+	return data[row*m.words : (row+1)*m.words]
+}
+
+// links returns, for every cell, whether it holds the same run base as its
+// neighbour in the given direction.
+func (m *packedMatrix) links(rowStep, colStep int) []uint64 {
+	links := make([]uint64, m.rows*m.words)
+	nextCodes := make([]uint64, m.words)
+	nextRuns := make([]uint64, m.words)
+
+	for row := 0; row < m.rows; row++ {
+		nextRow := row + rowStep
+		if nextRow < 0 || nextRow >= m.rows {
+			continue
+		}
+
+		shiftCells(nextCodes, m.row(m.codes, nextRow), colStep)
+		shiftCells(nextRuns, m.row(m.runs, nextRow), colStep)
+
+		codes, runs, link := m.row(m.codes, row), m.row(m.runs, row), m.row(links, row)
+		for w := range link {
+			diff := codes[w] ^ nextCodes[w]
+			link[w] = ^(diff | diff>>1) & runs[w] & nextRuns[w] & lowBits
+		}
+	}
+	return links
+}
+
+func (m *packedMatrix) directionLinks(direction Direction) []uint64 {
+	index := directionIndex(direction)
+	m.linksOnce[index].Do(func() {
+		offset := directionOffsets[direction]
+		m.linksData[index] = m.links(offset[0], offset[1])
+	})
+	return m.linksData[index]
+}
+
+func (m *packedMatrix) units(direction Direction) int {
+	return m.rows
+}
+
+func (m *packedMatrix) scanUnits(direction Direction, from, to int, found func(Sequence) bool) bool {
+	offset := directionOffsets[direction]
+	rowStep, colStep := offset[0], offset[1]
+	size := m.rules.SequenceSize
+
+	links := m.directionLinks(direction)
+	starts := make([]uint64, m.words)
+	shifted := make([]uint64, m.words)
+
+	for row := from; row < to; row++ {
+		lastLinkRow := row + (size-2)*rowStep
+		if lastLinkRow < 0 || lastLinkRow >= m.rows {
+			continue
+		}
+
+		// A run starts at a cell linked to the next size-1 cells and not
+		// linked from the previous one.
+		copy(starts, m.row(links, row))
+		for i := 1; i <= size-2; i++ {
+			shiftCells(shifted, m.row(links, row+i*rowStep), i*colStep)
+			for w := range starts {
+				starts[w] &= shifted[w]
+			}
+		}
+
+		if previousRow := row - rowStep; previousRow >= 0 && previousRow < m.rows {
+			shiftCells(shifted, m.row(links, previousRow), -colStep)
+			for w := range starts {
+				starts[w] &^= shifted[w]
+			}
+		}
+
+		for w, word := range starts {
+			for word != 0 {
+				col := w*cellsPerWord + bits.TrailingZeros64(word)/2
+				word &= word - 1
+
+				if found(m.sequenceFrom(links, direction, row, col, rowStep, colStep)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (m *packedMatrix) sequenceFrom(links []uint64, direction Direction, row, col, rowStep, colStep int) Sequence {
+	length := m.rules.SequenceSize
+	for m.linked(links, row+(length-1)*rowStep, col+(length-1)*colStep) {
+		length++
+	}
+
+	return Sequence{
+		StartRow:  row,
+		StartCol:  col,
+		EndRow:    row + (length-1)*rowStep,
+		EndCol:    col + (length-1)*colStep,
+		Direction: direction,
+		Base:      string(m.base(row, col)),
+		Count:     m.rules.count(length),
+	}
+}
+
+func (m *packedMatrix) linked(links []uint64, row, col int) bool {
+	if row < 0 || row >= m.rows || col < 0 || col >= m.cols {
+		return false
+	}
+	return m.row(links, row)[col/cellsPerWord]>>uint(2*(col%cellsPerWord))&1 == 1
+}
+
+func (m *packedMatrix) base(row, col int) byte {
+	code := m.row(m.codes, row)[col/cellsPerWord] >> uint(2*(col%cellsPerWord)) & 3
+	return m.bases[code]
+}
+
+// shiftCells fills dst so that its cell c holds the cell c+k of src. Cells
+// coming from outside src are zero.
+func shiftCells(dst, src []uint64, k int) {
+	shift := 2 * k
+	if shift < 0 {
+		shift = -shift
+	}
+	wordShift, bitShift := shift/64, uint(shift%64)
+
+	for i := range dst {
+		var word uint64
+		if k >= 0 {
+			if i+wordShift < len(src) {
+				word = src[i+wordShift] >> bitShift
+			}
+			if bitShift != 0 && i+wordShift+1 < len(src) {
+				word |= src[i+wordShift+1] << (64 - bitShift)
+			}
+		} else {
+			if i-wordShift >= 0 {
+				word = src[i-wordShift] << bitShift
+			}
+			if bitShift != 0 && i-wordShift-1 >= 0 {
+				word |= src[i-wordShift-1] >> (64 - bitShift)
+			}
+		}
+		dst[i] = word
+	}
+}
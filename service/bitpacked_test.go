@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"simio-api/database"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShiftCells(t *testing.T) {
+	assert := assert.New(t)
+
+	src := []uint64{0x1, 0x4}
+	dst := make([]uint64, 2)
+
+	shiftCells(dst, src, 0)
+	assert.Equal([]uint64{0x1, 0x4}, dst)
+
+	shiftCells(dst, src, 1)
+	assert.Equal([]uint64{0x0, 0x1}, dst)
+
+	shiftCells(dst, src, -1)
+	assert.Equal([]uint64{0x4, 0x10}, dst)
+
+	shiftCells(dst, src, 33)
+	assert.Equal([]uint64{0x1, 0x0}, dst)
+
+	shiftCells(dst, src, -32)
+	assert.Equal([]uint64{0x0, 0x1}, dst)
+}
+
+func TestBitPackedMatchesScanner(t *testing.T) {
+	assert := assert.New(t)
+	random := rand.New(rand.NewSource(7))
+
+	type Case struct {
+		alphabet *Alphabet
+		bases    string
+	}
+
+	cases := []Case{
+		Case{alphabet: DNAAlphabet, bases: "AC"},
+		Case{alphabet: DNAAlphabet, bases: "ACG"},
+		Case{alphabet: DNAAlphabet, bases: "ATCG"},
+		Case{alphabet: RNAAlphabet, bases: "AU"},
+		Case{alphabet: IUPACAlphabet, bases: "AAAACN"},
+	}
+
+	for i := 0; i < 400; i++ {
+		currentCase := cases[random.Intn(len(cases))]
+		rows, cols := 1+random.Intn(12), 1+random.Intn(150)
+		dna := randomDNA(random, rows, cols, currentCase.bases)
+
+		overlap := OverlapDisjoint
+		if random.Intn(2) == 0 {
+			overlap = OverlapOverlapping
+		}
+		rules := Rules{
+			SequenceSize: 2 + random.Intn(40),
+			MinSequences: 1,
+			Overlap:      overlap,
+			Directions:   allDirections,
+			Alphabet:     currentCase.alphabet,
+		}
+
+		packed, ok := packMatrix(dna, rules)
+		assert.True(ok)
+
+		expected, _ := findSequences(context.Background(), lineScanner{dna, rules}, rules, 2)
+		actual, _ := findSequences(context.Background(), packed, rules, 2)
+
+		assert.Equal(expected, actual, "rules %s dna %v", rules, dna)
+	}
+}
+
+func TestBitPackedFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections, Alphabet: NewAlphabet("custom:ABCDE", "ABCDE", "")}
+
+	_, ok := packMatrix([]string{"ABCDE"}, rules)
+	assert.False(ok)
+
+	_, isLineScanner := EngineBitPacked.prepare([]string{"ABCDE"}, rules).(lineScanner)
+	assert.True(isLineScanner)
+}
+
+func TestProcessDNAWithEngines(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna            []string
+		expectedResult bool
+	}
+
+	cases := []Case{
+		Case{dna: dnaSimianHorizontal, expectedResult: true},
+		Case{dna: dnaSimianVertical, expectedResult: true},
+		Case{dna: dnaSimianDiagonal, expectedResult: true},
+		Case{dna: dnaSimianDiagonal2, expectedResult: true},
+		Case{dna: dnaSimianDiagonalAlta6x6, expectedResult: true},
+		Case{dna: dnaSimianDiagonalBaixa6x6, expectedResult: true},
+		Case{dna: dnaSimianDiagonalInversa6x6, expectedResult: true},
+		Case{dna: dnaSimianHorizontal3x6, expectedResult: true},
+		Case{dna: dnaSimianVertical6x3, expectedResult: true},
+		Case{dna: dnaHuman, expectedResult: false},
+		Case{dna: dnaHuman3x5, expectedResult: false},
+		Case{dna: dna3x3, expectedResult: false},
+	}
+
+	for _, engine := range []Engine{EngineBitPacked, EngineDifferential} {
+		for _, currentCase := range cases {
+			simioDaoMock := new(SimioDaoMock)
+			simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+			simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+			simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Engine: engine}, simioDaoMock)
+
+			res, err := simioService.ProcessDNA(context.Background(), currentCase.dna, DetectionParams{})
+			detection, explainErr := simioService.ExplainDNA(context.Background(), currentCase.dna, DetectionParams{})
+
+			assert.Nil(err)
+			assert.Nil(explainErr)
+			assert.Equal(currentCase.expectedResult, res, "engine %s dna %v", engine, currentCase.dna)
+			assert.Equal(currentCase.expectedResult, detection.IsSimian, "engine %s dna %v", engine, currentCase.dna)
+		}
+	}
+}
+
+func TestBitPackedLargeMatrix(t *testing.T) {
+	assert := assert.New(t)
+
+	size := 2000
+	dna := make([]string, size)
+	for row := range dna {
+		dna[row] = strings.Repeat("ACGT", size/4)
+	}
+	dna[size-1] = strings.Repeat("A", 4) + dna[size-1][4:]
+
+	rules := Rules{SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, Directions: []Direction{Horizontal}, Alphabet: DNAAlphabet}
+	packed, _ := packMatrix(dna, rules)
+	detection, _ := findSequences(context.Background(), packed, rules, 2)
+
+	assert.True(detection.IsSimian)
+	assert.Equal([]Sequence{
+		Sequence{StartRow: size - 1, StartCol: 0, EndRow: size - 1, EndCol: 4, Direction: Horizontal, Base: "A", Count: 1},
+	}, detection.Sequences)
+}
+
+func BenchmarkEngines(b *testing.B) {
+	random := rand.New(rand.NewSource(1))
+	dna := randomDNA(random, 1000, 1000, "ATCG")
+	rules := Rules{SequenceSize: 4, MinSequences: 1000000, Overlap: OverlapDisjoint, Directions: allDirections, Alphabet: DNAAlphabet}
+
+	for _, engine := range []Engine{EngineScanner, EngineBitPacked} {
+		b.Run(string(engine), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				findSequences(context.Background(), engine.prepare(dna, rules), rules, 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"strings"
+)
+
+// Transform maps a matrix to an equivalent one, whose classification is the
+// same when all four directions are scanned.
+type Transform string
+
+const (
+	TransformTranspose Transform = "transpose"
+	TransformRotate90  Transform = "rotate90"
+	TransformRotate180 Transform = "rotate180"
+	TransformRotate270 Transform = "rotate270"
+	TransformMirror    Transform = "mirror"
+	// TransformReverseComplement rotates the matrix 180 degrees and swaps
+	// every base for its pair. Alphabets without pairs skip it.
+	TransformReverseComplement Transform = "reverse_complement"
+)
+
+var allTransforms = []Transform{TransformTranspose, TransformRotate90, TransformRotate180, TransformRotate270, TransformMirror, TransformReverseComplement}
+
+func isTransformValid(transform Transform) bool {
+	for _, valid := range allTransforms {
+		if transform == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTransforms reads a comma separated list of transforms, like the
+// SIMIO_CANONICAL_TRANSFORMS variable.
+func parseTransforms(value string) []Transform {
+	var transforms []Transform
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			transforms = append(transforms, Transform(name))
+		}
+	}
+	return transforms
+}
+
+func (t Transform) apply(dna []string, alphabet *Alphabet) ([]string, bool) {
+	rows, cols := len(dna), len(dna[0])
+
+	switch t {
+	case TransformTranspose:
+		return buildMatrix(cols, rows, func(row, col int) byte { return dna[col][row] }), true
+	case TransformRotate90:
+		return buildMatrix(cols, rows, func(row, col int) byte { return dna[rows-1-col][row] }), true
+	case TransformRotate180:
+		return buildMatrix(rows, cols, func(row, col int) byte { return dna[rows-1-row][cols-1-col] }), true
+	case TransformRotate270:
+		return buildMatrix(cols, rows, func(row, col int) byte { return dna[col][cols-1-row] }), true
+	case TransformMirror:
+		return buildMatrix(rows, cols, func(row, col int) byte { return dna[row][cols-1-col] }), true
+	case TransformReverseComplement:
+		if !alphabet.hasComplement() {
+			return nil, false
+		}
+		return buildMatrix(rows, cols, func(row, col int) byte {
+			return alphabet.complement[dna[rows-1-row][cols-1-col]]
+		}), true
+	}
+	return nil, false
+}
+
+func buildMatrix(rows, cols int, cell func(row, col int) byte) []string {
+	matrix := make([]string, rows)
+	bytes := make([]byte, cols)
+	for row := range matrix {
+		for col := range bytes {
+			bytes[col] = cell(row, col)
+		}
+		matrix[row] = string(bytes)
+	}
+	return matrix
+}
+
+// canonicalDNA returns the smallest joined form among every matrix the
+// transforms can reach from dna, composing them as many times as needed, so
+// all the equivalent matrices share it.
+func canonicalDNA(dna []string, transforms []Transform, alphabet *Alphabet) string {
+	smallest := strings.Join(dna, "|")
+	seen := map[string]bool{smallest: true}
+	pending := [][]string{dna}
+
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for _, transform := range transforms {
+			transformed, ok := transform.apply(current, alphabet)
+			if !ok {
+				continue
+			}
+
+			key := strings.Join(transformed, "|")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			pending = append(pending, transformed)
+
+			if key < smallest {
+				smallest = key
+			}
+		}
+	}
+	return smallest
+}
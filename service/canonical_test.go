@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTransforms(t *testing.T) {
+	assert := assert.New(t)
+
+	dna := []string{"ACG", "TTA"}
+
+	type Case struct {
+		transform      Transform
+		alphabet       *Alphabet
+		expectedResult []string
+		expectedOk     bool
+	}
+
+	cases := []Case{
+		Case{transform: TransformTranspose, alphabet: DNAAlphabet, expectedResult: []string{"AT", "CT", "GA"}, expectedOk: true},
+		Case{transform: TransformRotate90, alphabet: DNAAlphabet, expectedResult: []string{"TA", "TC", "AG"}, expectedOk: true},
+		Case{transform: TransformRotate180, alphabet: DNAAlphabet, expectedResult: []string{"ATT", "GCA"}, expectedOk: true},
+		Case{transform: TransformRotate270, alphabet: DNAAlphabet, expectedResult: []string{"GA", "CT", "AT"}, expectedOk: true},
+		Case{transform: TransformMirror, alphabet: DNAAlphabet, expectedResult: []string{"GCA", "ATT"}, expectedOk: true},
+		Case{transform: TransformReverseComplement, alphabet: DNAAlphabet, expectedResult: []string{"TAA", "CGT"}, expectedOk: true},
+		Case{transform: TransformReverseComplement, alphabet: NewAlphabet("custom:ACGT", "ACGT", ""), expectedOk: false},
+		Case{transform: "shuffle", alphabet: DNAAlphabet, expectedOk: false},
+	}
+
+	for _, currentCase := range cases {
+		result, ok := currentCase.transform.apply(dna, currentCase.alphabet)
+
+		assert.Equal(currentCase.expectedOk, ok, "transform %s", currentCase.transform)
+		assert.Equal(currentCase.expectedResult, result, "transform %s", currentCase.transform)
+	}
+}
+
+func TestCanonicalDNA(t *testing.T) {
+	assert := assert.New(t)
+
+	random := rand.New(rand.NewSource(12))
+
+	for i := 0; i < 50; i++ {
+		dna := randomDNA(random, 1+random.Intn(5), 1+random.Intn(5), "ATCG")
+		canonical := canonicalDNA(dna, allTransforms, DNAAlphabet)
+
+		for _, transform := range allTransforms {
+			transformed, _ := transform.apply(dna, DNAAlphabet)
+			assert.Equal(canonical, canonicalDNA(transformed, allTransforms, DNAAlphabet), "dna %v transform %s", dna, transform)
+		}
+
+		onlyMirror := canonicalDNA(dna, []Transform{TransformMirror}, DNAAlphabet)
+		mirrored, _ := TransformMirror.apply(dna, DNAAlphabet)
+		assert.Equal(onlyMirror, canonicalDNA(mirrored, []Transform{TransformMirror}, DNAAlphabet))
+	}
+}
+
+func TestTransformsKeepClassification(t *testing.T) {
+	assert := assert.New(t)
+
+	random := rand.New(rand.NewSource(13))
+
+	for i := 0; i < 100; i++ {
+		dna := randomDNA(random, 1+random.Intn(8), 1+random.Intn(8), "AT")
+		rules := Rules{Alphabet: DNAAlphabet, SequenceSize: 3, MinSequences: 1, Overlap: OverlapOverlapping, Directions: allDirections, Toroidal: random.Intn(2) == 0}
+
+		expected, _ := findSequences(context.Background(), lineScanner{dna: dna, rules: rules}, rules, 1)
+
+		for _, transform := range allTransforms {
+			transformed, _ := transform.apply(dna, DNAAlphabet)
+			detection, _ := findSequences(context.Background(), lineScanner{dna: transformed, rules: rules}, rules, 1)
+
+			assert.Equal(expected.Count, detection.Count, "dna %v transform %s", dna, transform)
+		}
+	}
+}
+
+func TestProcessDNACanonical(t *testing.T) {
+	assert := assert.New(t)
+
+	dna := []string{"ACGT", "TTAC", "GACG"}
+	rotated, _ := TransformRotate90.apply(dna, DNAAlphabet)
+	complemented, _ := TransformReverseComplement.apply(dna, DNAAlphabet)
+
+	type Case struct {
+		canonical      []Transform
+		params         DetectionParams
+		dna            []string
+		expectedSameID bool
+	}
+
+	cases := []Case{
+		Case{canonical: allTransforms, dna: rotated, expectedSameID: true},
+		Case{canonical: allTransforms, dna: complemented, expectedSameID: true},
+		Case{canonical: []Transform{TransformRotate90}, dna: rotated, expectedSameID: true},
+		Case{canonical: []Transform{TransformMirror}, dna: rotated, expectedSameID: false},
+		Case{canonical: nil, dna: rotated, expectedSameID: false},
+		Case{canonical: allTransforms, params: DetectionParams{Directions: []Direction{Horizontal}}, dna: rotated, expectedSameID: false},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Canonical: currentCase.canonical}, simioDaoMock)
+
+		_, err := simioService.ProcessDNA(context.Background(), dna, currentCase.params)
+		assert.Nil(err)
+		_, err = simioService.ProcessDNA(context.Background(), currentCase.dna, currentCase.params)
+		assert.Nil(err)
+
+		var savedIDs []string
+		for _, call := range simioDaoMock.Calls {
+			if call.Method == "Save" {
+				savedIDs = append(savedIDs, call.Arguments.Get(0).(database.SimioEntity).ID)
+			}
+		}
+		saved, savedAgain := savedIDs[0], savedIDs[1]
+		assert.Equal(currentCase.expectedSameID, saved == savedAgain, "canonical %v", currentCase.canonical)
+	}
+}
+
+func TestParseTransforms(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(parseTransforms(""))
+	assert.Equal([]Transform{TransformTranspose, TransformReverseComplement}, parseTransforms("transpose, reverse_complement"))
+}
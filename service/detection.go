@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"sort"
+)
+
+type Direction string
+
+const (
+	Horizontal   Direction = "horizontal"
+	Vertical     Direction = "vertical"
+	Diagonal     Direction = "diagonal"
+	AntiDiagonal Direction = "anti_diagonal"
+)
+
+var allDirections = []Direction{Horizontal, Vertical, Diagonal, AntiDiagonal}
+
+type Sequence struct {
+	StartRow  int       `json:"start_row"`
+	StartCol  int       `json:"start_col"`
+	EndRow    int       `json:"end_row"`
+	EndCol    int       `json:"end_col"`
+	Direction Direction `json:"direction"`
+	Base      string    `json:"base"`
+	Count     int       `json:"count"`
+	// Mismatches are the cells holding another base, in fuzzy detection.
+	Mismatches []Cell `json:"mismatches,omitempty"`
+}
+
+type Cell struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type Detection struct {
+	IsSimian  bool       `json:"is_simian"`
+	Count     int        `json:"count"`
+	Rules     string     `json:"rules"`
+	Sequences []Sequence `json:"sequences"`
+}
+
+// line is a straight path through the matrix starting at (row, col) and
+// moving rowStep/colStep on each cell.
+type line struct {
+	direction Direction
+	row       int
+	col       int
+	rowStep   int
+	colStep   int
+	length    int
+	// rows and cols are only set on toroidal lines, whose cells wrap around
+	// the matrix.
+	rows int
+	cols int
+}
+
+func (l line) cell(i int) (int, int) {
+	row, col := l.row+i*l.rowStep, l.col+i*l.colStep
+	if l.rows > 0 {
+		row, col = wrap(row, l.rows), wrap(col, l.cols)
+	}
+	return row, col
+}
+
+// lineCount returns how many lines a rows x cols matrix has in the direction.
+func lineCount(rows, cols int, direction Direction) int {
+	switch direction {
+	case Horizontal:
+		return rows
+	case Vertical:
+		return cols
+	case Diagonal, AntiDiagonal:
+		return rows + cols - 1
+	}
+	return 0
+}
+
+// lineAt returns the index-th line of the direction. Diagonals go down-right
+// and start on the first column from the bottom, then on the first row.
+// Anti-diagonals go up-right and start on the first column from the top, then
+// on the last row.
+func lineAt(rows, cols int, direction Direction, index int) line {
+	switch direction {
+	case Horizontal:
+		return line{direction: direction, row: index, colStep: 1, length: cols}
+	case Vertical:
+		return line{direction: direction, col: index, rowStep: 1, length: rows}
+	case Diagonal:
+		if index < rows {
+			row := rows - 1 - index
+			return line{direction: direction, row: row, rowStep: 1, colStep: 1, length: minInt(rows-row, cols)}
+		}
+		col := index - rows + 1
+		return line{direction: direction, col: col, rowStep: 1, colStep: 1, length: minInt(rows, cols-col)}
+	default:
+		if index < rows {
+			return line{direction: direction, row: index, rowStep: -1, colStep: 1, length: minInt(index+1, cols)}
+		}
+		col := index - rows + 1
+		return line{direction: direction, row: rows - 1, col: col, rowStep: -1, colStep: 1, length: minInt(rows, cols-col)}
+	}
+}
+
+// walkLines calls visit for every line of the given direction that can hold at
+// least minLength bases. It stops as soon as visit returns true and reports
+// whether it was stopped.
+func walkLines(rows, cols int, direction Direction, minLength int, visit func(line) bool) bool {
+	return walkLineRange(rows, cols, direction, minLength, 0, lineCount(rows, cols, direction), visit)
+}
+
+// walkLineRange is walkLines restricted to the lines with index in [from, to).
+func walkLineRange(rows, cols int, direction Direction, minLength int, from, to int, visit func(line) bool) bool {
+	for index := from; index < to; index++ {
+		l := lineAt(rows, cols, direction, index)
+		if l.length >= minLength && visit(l) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanLine calls found for every run of at least rules.SequenceSize identical
+// bases along the line. It stops as soon as found returns true.
+func scanLine(dna []string, l line, rules Rules, found func(Sequence) bool) bool {
+	if rules.MaxMismatches > 0 {
+		return scanLineFuzzy(dna, l, rules, found)
+	}
+
+	if l.rows > 0 {
+		var whole bool
+		if l, whole = alignCycle(dna, l, rules); whole {
+			return found(wholeCycleSequence(dna, l, rules))
+		}
+	}
+
+	var lastBase byte
+	var sequenceCount int
+
+	for i := 0; i <= l.length; i++ {
+		var currentBase byte
+		if i < l.length {
+			row, col := l.cell(i)
+			currentBase = dna[row][col]
+		}
+
+		if lastBase != 0 && currentBase == lastBase {
+			sequenceCount++
+			continue
+		}
+
+		if sequenceCount >= rules.SequenceSize {
+			startRow, startCol := l.cell(i - sequenceCount)
+			endRow, endCol := l.cell(i - 1)
+			sequence := Sequence{
+				StartRow:  startRow,
+				StartCol:  startCol,
+				EndRow:    endRow,
+				EndCol:    endCol,
+				Direction: l.direction,
+				Base:      string(lastBase),
+				Count:     rules.count(sequenceCount),
+			}
+			if found(sequence) {
+				return true
+			}
+		}
+
+		lastBase = currentBase
+		sequenceCount = 1
+		if !rules.Alphabet.isRunBase(currentBase) {
+			lastBase = 0
+			sequenceCount = 0
+		}
+	}
+	return false
+}
+
+// matrixScanner finds the runs of a matrix already bound to a set of rules.
+// Each direction is split in units (lines or rows) that can be scanned apart.
+type matrixScanner interface {
+	units(direction Direction) int
+	scanUnits(direction Direction, from, to int, found func(Sequence) bool) bool
+}
+
+type lineScanner struct {
+	dna   []string
+	rules Rules
+}
+
+func (ls lineScanner) units(direction Direction) int {
+	if len(ls.dna) == 0 {
+		return 0
+	}
+	if ls.rules.Toroidal {
+		return torusLineCount(len(ls.dna), len(ls.dna[0]), direction)
+	}
+	return lineCount(len(ls.dna), len(ls.dna[0]), direction)
+}
+
+func (ls lineScanner) scanUnits(direction Direction, from, to int, found func(Sequence) bool) bool {
+	if len(ls.dna) == 0 {
+		return false
+	}
+
+	if ls.rules.Toroidal {
+		return walkTorusRange(len(ls.dna), len(ls.dna[0]), direction, ls.rules.SequenceSize, from, to, func(l line) bool {
+			return scanLine(ls.dna, l, ls.rules, found)
+		})
+	}
+
+	return walkLineRange(len(ls.dna), len(ls.dna[0]), direction, ls.rules.SequenceSize, from, to, func(l line) bool {
+		return scanLine(ls.dna, l, ls.rules, found)
+	})
+}
+
+func scanDirection(scanner matrixScanner, direction Direction, found func(Sequence) bool) bool {
+	return scanner.scanUnits(direction, 0, scanner.units(direction), found)
+}
+
+func findSequences(ctx context.Context, scanner matrixScanner, rules Rules, workers int) (Detection, error) {
+	detection := Detection{
+		Rules:     rules.String(),
+		Sequences: []Sequence{},
+	}
+
+	_, err := scanParallel(ctx, scanner, rules.Directions, workers, func(sequence Sequence) bool {
+		detection.Sequences = append(detection.Sequences, sequence)
+		detection.Count += sequence.Count
+		return false
+	})
+
+	if err != nil {
+		return Detection{}, err
+	}
+
+	sortSequences(detection.Sequences)
+	detection.IsSimian = detection.Count >= rules.MinSequences
+	return detection, nil
+}
+
+// sortSequences orders sequences by direction, then by their first cell, so
+// every engine reports them the same way.
+func sortSequences(sequences []Sequence) {
+	sort.Slice(sequences, func(i, j int) bool {
+		a, b := sequences[i], sequences[j]
+		if a.Direction != b.Direction {
+			return directionIndex(a.Direction) < directionIndex(b.Direction)
+		}
+		if a.StartRow != b.StartRow {
+			return a.StartRow < b.StartRow
+		}
+		return a.StartCol < b.StartCol
+	})
+}
+
+func directionIndex(direction Direction) int {
+	for i, current := range allDirections {
+		if current == direction {
+			return i
+		}
+	}
+	return len(allDirections)
+}
+
+// untilMinSequences returns a callback that stops the scan once the runs found
+// add up to rules.MinSequences.
+func untilMinSequences(rules Rules) func(Sequence) bool {
+	count := 0
+	return func(sequence Sequence) bool {
+		count += sequence.Count
+		return count >= rules.MinSequences
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
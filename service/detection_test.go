@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var directionSteps = map[Direction][2]int{
+	Horizontal:   [2]int{0, 1},
+	Vertical:     [2]int{1, 0},
+	Diagonal:     [2]int{1, 1},
+	AntiDiagonal: [2]int{-1, 1},
+}
+
+func randomDNA(random *rand.Rand, rows, cols int, bases string) []string {
+	dna := make([]string, rows)
+	for row := range dna {
+		bytes := make([]byte, cols)
+		for col := range bytes {
+			bytes[col] = bases[random.Intn(len(bases))]
+		}
+		dna[row] = string(bytes)
+	}
+	return dna
+}
+
+// bruteForceSequences finds every maximal run by checking each cell on its own.
+func bruteForceSequences(dna []string, rules Rules) []Sequence {
+	sequences := []Sequence{}
+	rows, cols := len(dna), len(dna[0])
+	inside := func(row, col int) bool { return row >= 0 && row < rows && col >= 0 && col < cols }
+
+	for _, direction := range rules.Directions {
+		step := directionSteps[direction]
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				base := dna[row][col]
+				if inside(row-step[0], col-step[1]) && dna[row-step[0]][col-step[1]] == base {
+					continue
+				}
+
+				length := 1
+				for inside(row+length*step[0], col+length*step[1]) && dna[row+length*step[0]][col+length*step[1]] == base {
+					length++
+				}
+
+				if length >= rules.SequenceSize {
+					sequences = append(sequences, Sequence{
+						StartRow:  row,
+						StartCol:  col,
+						EndRow:    row + (length-1)*step[0],
+						EndCol:    col + (length-1)*step[1],
+						Direction: direction,
+						Base:      string(base),
+						Count:     rules.count(length),
+					})
+				}
+			}
+		}
+	}
+	return sequences
+}
+
+func TestFindSequencesRectangular(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{Alphabet: DNAAlphabet, SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections}
+
+	type Case struct {
+		dna               []string
+		expectedSequences []Sequence
+	}
+
+	cases := []Case{
+		Case{dna: []string{"CTGAGAAAA", "CTATGCTCG", "TATTGTACA"}, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 5, EndRow: 0, EndCol: 8, Direction: Horizontal, Base: "A", Count: 1},
+		}},
+		Case{dna: []string{"CTG", "CAT", "CTG", "CAT", "GTA"}, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 0, EndRow: 3, EndCol: 0, Direction: Vertical, Base: "C", Count: 1},
+		}},
+		Case{dna: []string{"GATCAG", "CGATCA", "TCGATC", "ACTGAT"}, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 0, EndRow: 3, EndCol: 3, Direction: Diagonal, Base: "G", Count: 1},
+			Sequence{StartRow: 0, StartCol: 1, EndRow: 3, EndCol: 4, Direction: Diagonal, Base: "A", Count: 1},
+			Sequence{StartRow: 0, StartCol: 2, EndRow: 3, EndCol: 5, Direction: Diagonal, Base: "T", Count: 1},
+		}},
+		Case{dna: []string{"CTGA", "GTAC", "CACT", "ATCG", "TGGA"}, expectedSequences: []Sequence{
+			Sequence{StartRow: 3, StartCol: 0, EndRow: 0, EndCol: 3, Direction: AntiDiagonal, Base: "A", Count: 1},
+		}},
+	}
+
+	for _, currentCase := range cases {
+		detection, _ := findSequences(context.Background(), lineScanner{currentCase.dna, rules}, rules, 2)
+
+		assert.True(detection.IsSimian)
+		assert.Equal(currentCase.expectedSequences, detection.Sequences)
+	}
+}
+
+func TestFindSequencesMatchesBruteForce(t *testing.T) {
+	assert := assert.New(t)
+	random := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 500; i++ {
+		rows, cols := 1+random.Intn(9), 1+random.Intn(9)
+		dna := randomDNA(random, rows, cols, "ACG"[:2+random.Intn(2)])
+		rules := Rules{
+			Alphabet:     DNAAlphabet,
+			SequenceSize: 2 + random.Intn(3),
+			MinSequences: 1,
+			Overlap:      OverlapOverlapping,
+			Directions:   allDirections,
+		}
+
+		expected := bruteForceSequences(dna, rules)
+		detection, _ := findSequences(context.Background(), lineScanner{dna, rules}, rules, 2)
+
+		sortSequences(expected)
+
+		assert.Equal(expected, detection.Sequences, "dna %v", dna)
+	}
+}
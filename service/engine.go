@@ -0,0 +1,83 @@
+package service
+
+import (
+	"log"
+	"reflect"
+)
+
+// Engine selects how a matrix is scanned. All engines report the same
+// sequences; they only differ in speed and memory.
+type Engine string
+
+const (
+	// EngineScanner walks the matrix base by base.
+	EngineScanner Engine = "scanner"
+	// EngineBitPacked packs bases in 2 bits and finds runs with bitwise
+	// operations. Alphabets with more than 4 bases, fuzzy and toroidal rules
+	// fall back to the scanner.
+	EngineBitPacked Engine = "bitpacked"
+	// EngineDifferential runs both engines, logs any disagreement and trusts
+	// the scanner. It is meant to validate the bit-packed engine.
+	EngineDifferential Engine = "differential"
+)
+
+func (e Engine) prepare(dna []string, rules Rules) matrixScanner {
+	reference := lineScanner{dna: dna, rules: rules}
+
+	switch e {
+	case EngineBitPacked:
+		if packed, ok := packMatrix(dna, rules); ok {
+			return packed
+		}
+	case EngineDifferential:
+		if packed, ok := packMatrix(dna, rules); ok {
+			return differentialScanner{reference: reference, candidate: packed}
+		}
+	}
+	return reference
+}
+
+func isEngineValid(engine Engine) bool {
+	return engine == EngineScanner || engine == EngineBitPacked || engine == EngineDifferential
+}
+
+type differentialScanner struct {
+	reference matrixScanner
+	candidate matrixScanner
+}
+
+// units keeps each direction whole, since both engines must be compared on
+// the same sequences.
+func (ds differentialScanner) units(direction Direction) int {
+	return 1
+}
+
+func (ds differentialScanner) scanUnits(direction Direction, from, to int, found func(Sequence) bool) bool {
+	if from > 0 {
+		return false
+	}
+
+	expected := collectDirection(ds.reference, direction)
+	actual := collectDirection(ds.candidate, direction)
+
+	if !reflect.DeepEqual(expected, actual) {
+		log.Printf("Bit-packed engine disagrees with scanner on %s: expected %+v, got %+v", direction, expected, actual)
+	}
+
+	for _, sequence := range expected {
+		if found(sequence) {
+			return true
+		}
+	}
+	return false
+}
+
+func collectDirection(scanner matrixScanner, direction Direction) []Sequence {
+	sequences := []Sequence{}
+	scanDirection(scanner, direction, func(sequence Sequence) bool {
+		sequences = append(sequences, sequence)
+		return false
+	})
+	sortSequences(sequences)
+	return sequences
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"simio-api/database"
+)
+
+const (
+	EventClassification = "classification"
+	EventStats          = "stats"
+)
+
+const (
+	defaultEventBufferSize = 1000
+	subscriberBufferSize   = 64
+)
+
+// Event is a message for the event stream. Only buffered events have an ID,
+// which clients send back to resume after it.
+type Event struct {
+	ID   uint64
+	Type string
+	Data json.RawMessage
+}
+
+type ClassificationEvent struct {
+	ID        string    `json:"id"`
+	IsSimian  bool      `json:"is_simian"`
+	Rows      int       `json:"rows"`
+	Cols      int       `json:"cols"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Subscription struct {
+	// Replay are the buffered events after the one the client saw last.
+	Replay []Event
+	// Events is closed when the subscriber falls too far behind.
+	Events <-chan Event
+	Close  func()
+}
+
+// EventBus fans events out to every subscriber, keeping the last ones in a
+// ring buffer so reconnecting clients can catch up.
+type EventBus struct {
+	lock        sync.Mutex
+	buffer      []Event
+	next        int
+	lastID      uint64
+	subscribers map[chan Event]bool
+}
+
+func NewEventBus(bufferSize int) *EventBus {
+	if bufferSize < 1 {
+		bufferSize = defaultEventBufferSize
+	}
+	return &EventBus{
+		buffer:      make([]Event, 0, bufferSize),
+		subscribers: make(map[chan Event]bool),
+	}
+}
+
+func (eb *EventBus) Publish(eventType string, data interface{}) {
+	encoded, err := json.Marshal(data)
+
+	if err != nil {
+		log.Printf("Error on encoding %s event. Details: %s", eventType, err)
+		return
+	}
+
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	eb.lastID++
+	event := Event{ID: eb.lastID, Type: eventType, Data: encoded}
+
+	if len(eb.buffer) < cap(eb.buffer) {
+		eb.buffer = append(eb.buffer, event)
+	} else {
+		eb.buffer[eb.next] = event
+		eb.next = (eb.next + 1) % len(eb.buffer)
+	}
+
+	for subscriber := range eb.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			log.Printf("Dropping a slow event subscriber")
+			delete(eb.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Subscribe replays the buffered events after lastID, when resume is set, and
+// delivers the next ones. Events older than the buffer are lost.
+func (eb *EventBus) Subscribe(lastID uint64, resume bool) Subscription {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	var replay []Event
+	if resume {
+		for i := range eb.buffer {
+			event := eb.buffer[(eb.next+i)%len(eb.buffer)]
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	subscriber := make(chan Event, subscriberBufferSize)
+	eb.subscribers[subscriber] = true
+
+	return Subscription{
+		Replay: replay,
+		Events: subscriber,
+		Close: func() {
+			eb.lock.Lock()
+			defer eb.lock.Unlock()
+			if eb.subscribers[subscriber] {
+				delete(eb.subscribers, subscriber)
+				close(subscriber)
+			}
+		},
+	}
+}
+
+func newClassificationEvent(entity database.SimioEntity) ClassificationEvent {
+	cols := strings.IndexByte(entity.DNA, '|')
+	if cols < 0 {
+		cols = len(entity.DNA)
+	}
+	return ClassificationEvent{
+		ID:        entity.ID,
+		IsSimian:  entity.IsSimian,
+		Rows:      strings.Count(entity.DNA, "|") + 1,
+		Cols:      cols,
+		CreatedAt: entity.CreatedAt,
+	}
+}
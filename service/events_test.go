@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func eventIDs(events []Event) []uint64 {
+	ids := []uint64{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestEventBusSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		published      int
+		lastID         uint64
+		resume         bool
+		expectedReplay []uint64
+	}
+
+	cases := []Case{
+		Case{published: 2, expectedReplay: []uint64{}},
+		Case{published: 2, lastID: 0, resume: true, expectedReplay: []uint64{1, 2}},
+		Case{published: 3, lastID: 2, resume: true, expectedReplay: []uint64{3}},
+		Case{published: 5, lastID: 1, resume: true, expectedReplay: []uint64{3, 4, 5}},
+		Case{published: 5, lastID: 5, resume: true, expectedReplay: []uint64{}},
+	}
+
+	for _, c := range cases {
+		bus := NewEventBus(3)
+		for i := 0; i < c.published; i++ {
+			bus.Publish(EventClassification, i)
+		}
+
+		subscription := bus.Subscribe(c.lastID, c.resume)
+		assert.Equal(c.expectedReplay, eventIDs(subscription.Replay))
+
+		bus.Publish(EventClassification, "next")
+		event := <-subscription.Events
+		assert.Equal(uint64(c.published+1), event.ID)
+		assert.Equal(json.RawMessage(`"next"`), event.Data)
+
+		subscription.Close()
+		subscription.Close()
+		_, open := <-subscription.Events
+		assert.False(open)
+	}
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	assert := assert.New(t)
+
+	bus := NewEventBus(10)
+	slow := bus.Subscribe(0, false)
+	fast := bus.Subscribe(0, false)
+
+	received := 0
+	for i := 0; i <= subscriberBufferSize; i++ {
+		bus.Publish(EventClassification, i)
+		<-fast.Events
+		received++
+	}
+
+	assert.Equal(subscriberBufferSize+1, received)
+
+	buffered := 0
+	for range slow.Events {
+		buffered++
+	}
+	assert.Equal(subscriberBufferSize, buffered)
+
+	slow.Close()
+	fast.Close()
+}
+
+func TestProcessDNAPublishesEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	subscription := simioService.Subscribe(0, false)
+	defer subscription.Close()
+
+	isSimian, err := simioService.ProcessDNA(context.Background(), dnaSimianHorizontal3x6, DetectionParams{})
+	assert.Nil(err)
+	assert.True(isSimian)
+
+	event := <-subscription.Events
+	assert.Equal(EventClassification, event.Type)
+
+	var classification ClassificationEvent
+	assert.Nil(json.Unmarshal(event.Data, &classification))
+	assert.True(classification.IsSimian)
+	assert.Equal(3, classification.Rows)
+	assert.Equal(6, classification.Cols)
+	assert.NotEmpty(classification.ID)
+	assert.False(classification.CreatedAt.IsZero())
+}
+
+func TestProcessDNAPublishesEventOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	// Both requests miss the lookup, as concurrent ones do, but only the first
+	// save stores the entity.
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioDaoMock.On("Save", mock.Anything).Return(true, nil).Once()
+	simioDaoMock.On("Save", mock.Anything).Return(false, nil)
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	subscription := simioService.Subscribe(0, false)
+	defer subscription.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := simioService.ProcessDNA(context.Background(), dnaSimianHorizontal3x6, DetectionParams{})
+		assert.Nil(err)
+	}
+
+	simioDaoMock.AssertNumberOfCalls(t, "Save", 2)
+	assert.Equal(1, len(subscription.Events))
+}
@@ -0,0 +1,80 @@
+package service
+
+// scanLineFuzzy calls found for every window of rules.SequenceSize cells along
+// the line where all but rules.MaxMismatches cells hold the same base.
+// Ambiguous codes always count as mismatches. Since mismatches are fewer than
+// half the window, its base is never ambiguous. With disjoint overlap a window
+// found is skipped whole; with overlapping every window counts.
+func scanLineFuzzy(dna []string, l line, rules Rules, found func(Sequence) bool) bool {
+	size := rules.SequenceSize
+	if l.length < size {
+		return false
+	}
+
+	var counts [256]int
+	baseAt := func(i int) byte {
+		row, col := l.cell(i)
+		return dna[row][col]
+	}
+
+	windowStart := 0
+	for i := 0; i < l.length; i++ {
+		counts[baseAt(i)]++
+		if i-windowStart+1 < size {
+			continue
+		}
+		if i-windowStart+1 > size {
+			counts[baseAt(windowStart)]--
+			windowStart++
+		}
+
+		base, ok := windowBase(&counts, rules)
+		if !ok {
+			continue
+		}
+		if found(fuzzySequence(dna, l, rules, windowStart, base)) {
+			return true
+		}
+		if rules.Overlap == OverlapDisjoint {
+			counts = [256]int{}
+			windowStart = i + 1
+		}
+	}
+	return false
+}
+
+func windowBase(counts *[256]int, rules Rules) (byte, bool) {
+	needed := rules.SequenceSize - rules.MaxMismatches
+	bases := rules.Alphabet.Bases
+
+	for i := 0; i < len(bases); i++ {
+		if counts[bases[i]] >= needed {
+			return bases[i], true
+		}
+	}
+	return 0, false
+}
+
+func fuzzySequence(dna []string, l line, rules Rules, start int, base byte) Sequence {
+	end := start + rules.SequenceSize - 1
+	startRow, startCol := l.cell(start)
+	endRow, endCol := l.cell(end)
+
+	sequence := Sequence{
+		StartRow:  startRow,
+		StartCol:  startCol,
+		EndRow:    endRow,
+		EndCol:    endCol,
+		Direction: l.direction,
+		Base:      string(base),
+		Count:     1,
+	}
+
+	for i := start; i <= end; i++ {
+		row, col := l.cell(i)
+		if dna[row][col] != base {
+			sequence.Mismatches = append(sequence.Mismatches, Cell{Row: row, Col: col})
+		}
+	}
+	return sequence
+}
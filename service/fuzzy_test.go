@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// bruteForceFuzzy checks every window of every line on its own.
+func bruteForceFuzzy(dna []string, rules Rules) []Sequence {
+	sequences := []Sequence{}
+	rows, cols := len(dna), len(dna[0])
+
+	for _, direction := range rules.Directions {
+		walkLines(rows, cols, direction, rules.SequenceSize, func(l line) bool {
+			for start := 0; start+rules.SequenceSize <= l.length; start++ {
+				var counts [256]int
+				for i := start; i < start+rules.SequenceSize; i++ {
+					row, col := l.cell(i)
+					counts[dna[row][col]]++
+				}
+				if base, ok := windowBase(&counts, rules); ok {
+					sequences = append(sequences, fuzzySequence(dna, l, rules, start, base))
+					if rules.Overlap == OverlapDisjoint {
+						start += rules.SequenceSize - 1
+					}
+				}
+			}
+			return false
+		})
+	}
+	sortSequences(sequences)
+	return sequences
+}
+
+func TestScanLineFuzzy(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna               []string
+		overlap           Overlap
+		mismatches        int
+		expectedSequences []Sequence
+	}
+
+	horizontal := line{direction: Horizontal, colStep: 1, length: 7}
+
+	cases := []Case{
+		Case{dna: []string{"AATAGCG"}, overlap: OverlapDisjoint, mismatches: 1, expectedSequences: []Sequence{
+			Sequence{EndCol: 3, Direction: Horizontal, Base: "A", Count: 1, Mismatches: []Cell{Cell{Col: 2}}},
+		}},
+		Case{dna: []string{"AATAAGC"}, overlap: OverlapOverlapping, mismatches: 1, expectedSequences: []Sequence{
+			Sequence{EndCol: 3, Direction: Horizontal, Base: "A", Count: 1, Mismatches: []Cell{Cell{Col: 2}}},
+			Sequence{StartCol: 1, EndCol: 4, Direction: Horizontal, Base: "A", Count: 1, Mismatches: []Cell{Cell{Col: 2}}},
+		}},
+		Case{dna: []string{"AATAAAA"}, overlap: OverlapDisjoint, mismatches: 1, expectedSequences: []Sequence{
+			Sequence{EndCol: 3, Direction: Horizontal, Base: "A", Count: 1, Mismatches: []Cell{Cell{Col: 2}}},
+		}},
+		Case{dna: []string{"ATTAGCG"}, overlap: OverlapDisjoint, mismatches: 1, expectedSequences: []Sequence{}},
+	}
+
+	for _, currentCase := range cases {
+		rules := Rules{Alphabet: DNAAlphabet, SequenceSize: 4, MinSequences: 1, Overlap: currentCase.overlap, MaxMismatches: currentCase.mismatches}
+		sequences := []Sequence{}
+
+		scanLine(currentCase.dna, horizontal, rules, func(sequence Sequence) bool {
+			sequences = append(sequences, sequence)
+			return false
+		})
+
+		assert.Equal(currentCase.expectedSequences, sequences)
+	}
+}
+
+func TestFuzzyAmbiguousBases(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{Alphabet: IUPACAlphabet, SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, MaxMismatches: 1}
+	sequences := []Sequence{}
+
+	scanLine([]string{"ANAANN"}, line{direction: Horizontal, colStep: 1, length: 6}, rules, func(sequence Sequence) bool {
+		sequences = append(sequences, sequence)
+		return false
+	})
+
+	assert.Equal([]Sequence{
+		Sequence{EndCol: 3, Direction: Horizontal, Base: "A", Count: 1, Mismatches: []Cell{Cell{Col: 1}}},
+	}, sequences)
+}
+
+func TestFuzzyMatchesBruteForce(t *testing.T) {
+	assert := assert.New(t)
+
+	random := rand.New(rand.NewSource(9))
+
+	for i := 0; i < 200; i++ {
+		rows, cols := 1+random.Intn(9), 1+random.Intn(9)
+		dna := randomDNA(random, rows, cols, "AT")
+		size := 3 + random.Intn(3)
+
+		for _, overlap := range []Overlap{OverlapDisjoint, OverlapOverlapping} {
+			rules := Rules{Alphabet: DNAAlphabet, SequenceSize: size, MinSequences: 1, Overlap: overlap, Directions: allDirections, MaxMismatches: 1 + random.Intn((size-1)/2)}
+
+			detection, err := findSequences(context.Background(), lineScanner{dna: dna, rules: rules}, rules, 2)
+
+			assert.Nil(err)
+			assert.Equal(bruteForceFuzzy(dna, rules), detection.Sequences, "dna %v rules %s", dna, rules.String())
+		}
+	}
+}
+
+func TestProcessDNAFuzzy(t *testing.T) {
+	assert := assert.New(t)
+
+	one, two := 1, 2
+	dna := []string{"AACAGT", "GTCTCA", "CTGACG", "TGACTC", "GCTGAT", "ACGTCA"}
+
+	type Case struct {
+		engine         Engine
+		params         DetectionParams
+		expectedErr    bool
+		expectedResult bool
+	}
+
+	cases := []Case{
+		Case{engine: EngineScanner, params: DetectionParams{}, expectedResult: false},
+		Case{engine: EngineScanner, params: DetectionParams{MaxMismatches: &one}, expectedResult: true},
+		Case{engine: EngineBitPacked, params: DetectionParams{MaxMismatches: &one}, expectedResult: true},
+		Case{engine: EngineDifferential, params: DetectionParams{MaxMismatches: &one}, expectedResult: true},
+		Case{engine: EngineScanner, params: DetectionParams{MaxMismatches: &two}, expectedErr: true},
+		Case{engine: EngineScanner, params: DetectionParams{SequenceSize: 5, MaxMismatches: &two}, expectedResult: true},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Engine: currentCase.engine}, simioDaoMock)
+
+		res, err := simioService.ProcessDNA(context.Background(), dna, currentCase.params)
+
+		if currentCase.expectedErr {
+			assert.NotNil(err)
+			continue
+		}
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedResult, res)
+	}
+}
+
+func TestFuzzyRulesString(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{Alphabet: DNAAlphabet, SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections}
+	assert.Equal("v2;size=4;min=1;overlap=disjoint", rules.String())
+
+	rules.MaxMismatches = 1
+	assert.Equal("v2;size=4;min=1;overlap=disjoint;mismatches=1", rules.String())
+}
+
+func TestProcessDNAStreamRejectsFuzzy(t *testing.T) {
+	assert := assert.New(t)
+
+	one := 1
+	simioService := NewSimioService(4, 1, new(SimioDaoMock))
+
+	_, err := simioService.ProcessDNAStream(context.Background(), &sliceRowReader{rows: []string{"AAAA"}}, DetectionParams{MaxMismatches: &one}, false)
+
+	assert.NotNil(err)
+}
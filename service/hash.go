@@ -0,0 +1,59 @@
+package service
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"simio-api/database"
+	"strings"
+
+	"github.com/cespare/xxhash"
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashAlgorithm builds entity IDs. Every algorithm but sha1 prefixes the IDs
+// with its name, like "sha256:...", so IDs of different schemes never collide.
+type HashAlgorithm string
+
+const (
+	// HashSHA1 is the legacy scheme, whose IDs have no prefix.
+	HashSHA1    HashAlgorithm = "sha1"
+	HashSHA256  HashAlgorithm = "sha256"
+	HashBLAKE2b HashAlgorithm = "blake2b"
+	// HashXXHash is fast but not cryptographic. Use it only on trusted input.
+	HashXXHash HashAlgorithm = "xxhash"
+)
+
+func isHashValid(hash HashAlgorithm) bool {
+	return hash == HashSHA1 || hash == HashSHA256 || hash == HashBLAKE2b || hash == HashXXHash
+}
+
+func (h HashAlgorithm) id(content string) string {
+	switch h {
+	case HashSHA256:
+		return fmt.Sprintf("%s:%x", h, sha256.Sum256([]byte(content)))
+	case HashBLAKE2b:
+		return fmt.Sprintf("%s:%x", h, blake2b.Sum256([]byte(content)))
+	case HashXXHash:
+		return fmt.Sprintf("%s:%016x", h, xxhash.Sum64String(content))
+	default:
+		return fmt.Sprintf("%x", sha1.Sum([]byte(content)))
+	}
+}
+
+// hashOf returns the algorithm that built id, named by its prefix.
+func hashOf(id string) HashAlgorithm {
+	if i := strings.Index(id, ":"); i >= 0 {
+		return HashAlgorithm(id[:i])
+	}
+	return HashSHA1
+}
+
+// entityContent is what the ID of a stored entity hashes. Entities without
+// rules were classified before IDs included them.
+func entityContent(entity database.SimioEntity) string {
+	if entity.Rules == "" {
+		return entity.DNA
+	}
+	return entity.DNA + "#" + entity.Rules
+}
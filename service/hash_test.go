@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHashAlgorithms(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		hash       HashAlgorithm
+		expectedID string
+	}
+
+	cases := []Case{
+		Case{hash: HashSHA1, expectedID: "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		Case{hash: HashSHA256, expectedID: "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		Case{hash: HashBLAKE2b, expectedID: "blake2b:bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		Case{hash: HashXXHash, expectedID: "xxhash:44bc2cf5ad770999"},
+	}
+
+	for _, currentCase := range cases {
+		assert.Equal(currentCase.expectedID, currentCase.hash.id("abc"))
+	}
+}
+
+func TestEntityIdPerHash(t *testing.T) {
+	assert := assert.New(t)
+
+	legacy := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}}, new(SimioDaoMock)).(*SimioServiceImpl)
+	sha256 := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Hash: HashSHA256}, new(SimioDaoMock)).(*SimioServiceImpl)
+	unknown := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Hash: "md5"}, new(SimioDaoMock)).(*SimioServiceImpl)
+
+	entity := sha256.mapToSimioEntity(dnaHuman, false, sha256.rules)
+
+	assert.Equal(HashSHA256.id(entityContent(entity)), entity.ID)
+	assert.Equal(legacy.mapToSimioEntity(dnaHuman, false, legacy.rules).ID, HashSHA1.id(entityContent(entity)))
+	assert.Equal(HashSHA1, unknown.hash)
+}
+
+func TestProcessDNAFindsLegacyId(t *testing.T) {
+	assert := assert.New(t)
+
+	legacyID := HashSHA1.id("CGAT|GTCA|TACG|TCGA#v2;size=4;min=1;overlap=disjoint")
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", legacyID).Return(database.SimioEntity{ID: legacyID, IsSimian: true}, true)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Hash: HashBLAKE2b}, simioDaoMock)
+
+	res, err := simioService.ProcessDNA(context.Background(), dnaHuman, DetectionParams{})
+
+	assert.Nil(err)
+	assert.True(res)
+	simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+}
+
+func TestProcessDNAFindsV1Records(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		hash          HashAlgorithm
+		storedID      string
+		params        DetectionParams
+		expectedFound bool
+	}
+
+	dna := "CGAT|GTCA|TACG|TCGA"
+	// v1 records have no rules, and their IDs hash the DNA alone.
+	cases := []Case{
+		Case{hash: HashSHA1, storedID: HashSHA1.id(dna), expectedFound: true},
+		Case{hash: HashSHA256, storedID: HashSHA1.id(dna), expectedFound: true},
+		Case{hash: HashSHA256, storedID: HashSHA256.id(dna), expectedFound: true},
+		Case{hash: HashSHA1, storedID: HashSHA1.id(dna), params: DetectionParams{SequenceSize: 5}, expectedFound: false},
+		Case{hash: HashSHA1, storedID: HashSHA1.id(dna), params: DetectionParams{MinSequences: 2}, expectedFound: false},
+	}
+
+	for _, c := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Get", c.storedID).Return(database.SimioEntity{ID: c.storedID, DNA: dna, IsSimian: true}, true)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Hash: c.hash}, simioDaoMock)
+
+		res, err := simioService.ProcessDNA(context.Background(), dnaHuman, c.params)
+
+		assert.Nil(err)
+		assert.Equal(c.expectedFound, res)
+		if c.expectedFound {
+			simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+		} else {
+			simioDaoMock.AssertCalled(t, "Save", mock.Anything)
+		}
+	}
+}
+
+func TestMigrateIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	legacy := database.SimioEntity{ID: HashSHA1.id("CGAT|GTCA"), DNA: "CGAT|GTCA"}
+	withRules := database.SimioEntity{ID: HashSHA1.id("CCCC|GTCA#v2;size=4;min=1;overlap=disjoint"), DNA: "CCCC|GTCA", IsSimian: true, Rules: "v2;size=4;min=1;overlap=disjoint"}
+	migratedAlready := database.SimioEntity{ID: HashSHA256.id("AAAA|GTCA"), DNA: "AAAA|GTCA"}
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Snapshot").Return([]database.SimioEntity{legacy, withRules, migratedAlready})
+	simioDaoMock.On("Replace", mock.Anything, mock.Anything).Return(nil)
+	simioService := NewSimioServiceWithSettings(Settings{Hash: HashSHA256}, simioDaoMock)
+
+	migrated, err := simioService.MigrateIDs()
+
+	assert.Nil(err)
+	assert.Equal(2, migrated)
+
+	expectedLegacy := legacy
+	expectedLegacy.ID = HashSHA256.id("CGAT|GTCA")
+	simioDaoMock.AssertCalled(t, "Replace", legacy.ID, expectedLegacy)
+
+	expectedWithRules := withRules
+	expectedWithRules.ID = HashSHA256.id("CCCC|GTCA#v2;size=4;min=1;overlap=disjoint")
+	simioDaoMock.AssertCalled(t, "Replace", withRules.ID, expectedWithRules)
+}
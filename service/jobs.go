@@ -0,0 +1,405 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"simio-api/config"
+	"simio-api/database"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+func (s JobStatus) finished() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
+
+var (
+	ErrJobNotFound  = fmt.Errorf("Job not found")
+	ErrJobFinished  = fmt.Errorf("Job has already finished")
+	ErrJobQueueFull = fmt.Errorf("Job queue is full. Try again later")
+)
+
+// JobRequest is the work of a job: a single DNA is a batch of one item that
+// is not reported as a batch.
+type JobRequest struct {
+	Items       []BatchItem
+	Batch       bool
+	CallbackURL string
+}
+
+type JobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+type Job struct {
+	ID        string        `json:"id"`
+	Status    JobStatus     `json:"status"`
+	Batch     bool          `json:"batch"`
+	Progress  JobProgress   `json:"progress"`
+	Results   []BatchResult `json:"results,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	request   JobRequest
+	// unsaved are the results not appended to the saved ones yet.
+	unsaved []BatchResult
+	// saving makes the saves of the job one at a time, in order.
+	saving *sync.Mutex
+}
+
+type JobService interface {
+	Submit(request JobRequest) (Job, error)
+	Get(id string) (Job, bool)
+	Cancel(id string) (Job, error)
+}
+
+type JobSettings struct {
+	Workers int
+	// QueueSize is how many jobs may wait for a worker.
+	QueueSize int
+	// ChunkSize is how many items are classified between progress updates.
+	ChunkSize int
+	// BatchLimit is the most items the simio service takes in a batch. Larger
+	// chunk sizes are lowered to it.
+	BatchLimit int
+	// MaxItems is the most items a job may have.
+	MaxItems int
+	// Notifier delivers the callbacks of finished jobs. Nil disables them.
+	Notifier Notifier
+}
+
+var defaultJobSettings = JobSettings{Workers: 2, QueueSize: 100, ChunkSize: 100, MaxItems: 100000}
+
+// JobServiceImpl runs jobs on a fixed pool of workers. Jobs are saved on every
+// change, and the ones a restart interrupted are queued again. Saving happens
+// outside the lock, so a slow disk does not stall the other calls.
+type JobServiceImpl struct {
+	simioService SimioService
+	jobDAO       database.JobDAO
+	settings     JobSettings
+	queue        chan string
+	lock         sync.Mutex
+	jobs         map[string]*Job
+	cancels      map[string]context.CancelFunc
+}
+
+func (js *JobServiceImpl) Submit(request JobRequest) (Job, error) {
+	if len(request.Items) == 0 || len(request.Items) > js.settings.MaxItems {
+		return Job{}, fmt.Errorf("Invalid job size ( %d ). It has to be between 1 and %d", len(request.Items), js.settings.MaxItems)
+	}
+
+	if err := validateCallbackURL(js.settings.Notifier, request.CallbackURL); err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        newRandomId(),
+		Status:    JobQueued,
+		Batch:     request.Batch,
+		Progress:  JobProgress{Total: len(request.Items)},
+		CreatedAt: now,
+		UpdatedAt: now,
+		request:   request,
+		saving:    new(sync.Mutex),
+	}
+
+	js.lock.Lock()
+	select {
+	case js.queue <- job.ID:
+	default:
+		js.lock.Unlock()
+		return Job{}, ErrJobQueueFull
+	}
+
+	js.jobs[job.ID] = job
+	submitted := *job
+	// Nothing else can save the job before it is created.
+	job.saving.Lock()
+	js.lock.Unlock()
+
+	js.create(submitted)
+	job.saving.Unlock()
+
+	return submitted, nil
+}
+
+func (js *JobServiceImpl) Get(id string) (Job, bool) {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+
+	job, found := js.jobs[id]
+	if !found {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (js *JobServiceImpl) Cancel(id string) (Job, error) {
+	js.lock.Lock()
+
+	job, found := js.jobs[id]
+	if !found {
+		js.lock.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	if job.Status.finished() {
+		js.lock.Unlock()
+		return *job, ErrJobFinished
+	}
+
+	if cancel, running := js.cancels[id]; running {
+		cancel()
+	}
+	js.update(job, func() { job.Status = JobCancelled })
+	cancelled := *job
+	js.lock.Unlock()
+
+	js.persist(job)
+	return cancelled, nil
+}
+
+func (js *JobServiceImpl) work() {
+	for id := range js.queue {
+		js.lock.Lock()
+		job := js.jobs[id]
+		if job.Status != JobQueued {
+			js.lock.Unlock()
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		js.cancels[id] = cancel
+		js.update(job, func() { job.Status = JobRunning })
+		js.lock.Unlock()
+
+		js.persist(job)
+		js.run(ctx, job)
+
+		js.lock.Lock()
+		delete(js.cancels, id)
+		js.lock.Unlock()
+		cancel()
+	}
+}
+
+func (js *JobServiceImpl) run(ctx context.Context, job *Job) {
+	items := job.request.Items
+
+	for from := job.Progress.Done; from < len(items); from += js.settings.ChunkSize {
+		to := minInt(from+js.settings.ChunkSize, len(items))
+		results, err := js.simioService.ProcessBatch(ctx, items[from:to], "")
+
+		js.lock.Lock()
+		if job.Status == JobCancelled {
+			js.lock.Unlock()
+			return
+		}
+		if err != nil {
+			js.update(job, func() {
+				job.Status = JobFailed
+				job.Error = err.Error()
+			})
+			js.lock.Unlock()
+			js.persist(job)
+			log.Printf("Job %s failed. Details: %s", job.ID, err)
+			return
+		}
+		js.update(job, func() {
+			for _, result := range results {
+				result.Index += from
+				job.Results = append(job.Results, result)
+				job.unsaved = append(job.unsaved, result)
+			}
+			job.Progress.Done = to
+		})
+		js.lock.Unlock()
+		js.persist(job)
+	}
+
+	js.lock.Lock()
+	js.update(job, func() { job.Status = JobDone })
+	js.lock.Unlock()
+	js.persist(job)
+}
+
+// update changes the job, notifying its callback once it finishes. The caller
+// must hold the lock, and save the job with persist once it releases it.
+func (js *JobServiceImpl) update(job *Job, change func()) {
+	change()
+	job.UpdatedAt = time.Now().UTC()
+
+	if job.Status.finished() && job.request.CallbackURL != "" && js.settings.Notifier != nil {
+		js.settings.Notifier.Notify(job.request.CallbackURL, WebhookPayload{
+			Event:   "job.finished",
+			JobID:   job.ID,
+			Status:  job.Status,
+			Results: append([]BatchResult{}, job.Results...),
+		})
+	}
+}
+
+// create saves a new job with its request, which is only written this once.
+func (js *JobServiceImpl) create(job Job) {
+	request, _ := json.Marshal(job.request)
+
+	entity := mapToJobEntity(job)
+	entity.Request = request
+
+	if err := js.jobDAO.Create(entity); err != nil {
+		log.Printf("Error on saving job %s. Details: %s", job.ID, err)
+	}
+}
+
+// persist saves the latest state of the job and appends its unsaved results.
+// Saves of a job are one at a time, and each takes the state when it starts,
+// so an older state never overwrites a newer one.
+func (js *JobServiceImpl) persist(job *Job) {
+	job.saving.Lock()
+	defer job.saving.Unlock()
+
+	js.lock.Lock()
+	entity := mapToJobEntity(*job)
+	unsaved := job.unsaved
+	job.unsaved = nil
+	js.lock.Unlock()
+
+	var results []byte
+	if len(unsaved) > 0 {
+		results, _ = json.Marshal(unsaved)
+	}
+
+	if err := js.jobDAO.Update(entity, results); err != nil {
+		log.Printf("Error on saving job %s. Details: %s", job.ID, err)
+
+		// The next save appends them.
+		js.lock.Lock()
+		job.unsaved = append(unsaved, job.unsaved...)
+		js.lock.Unlock()
+	}
+}
+
+func mapToJobEntity(job Job) database.JobEntity {
+	return database.JobEntity{
+		ID:        job.ID,
+		Status:    string(job.Status),
+		Error:     job.Error,
+		Done:      job.Progress.Done,
+		Total:     job.Progress.Total,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
+
+func mapToJob(entity database.JobEntity) (*Job, error) {
+	job := &Job{
+		ID:        entity.ID,
+		Status:    JobStatus(entity.Status),
+		Progress:  JobProgress{Done: entity.Done, Total: entity.Total},
+		Error:     entity.Error,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+		saving:    new(sync.Mutex),
+	}
+
+	if err := json.Unmarshal(entity.Request, &job.request); err != nil {
+		return nil, err
+	}
+	if len(entity.Results) > 0 {
+		if err := json.Unmarshal(entity.Results, &job.Results); err != nil {
+			return nil, err
+		}
+	}
+	job.Batch = job.request.Batch
+	return job, nil
+}
+
+func newRandomId() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return fmt.Sprintf("%x", bytes)
+}
+
+func BuildJobService(simioService SimioService) JobService {
+	settings := JobSettings{
+		Workers:    config.Int("SIMIO_JOB_WORKERS", defaultJobSettings.Workers),
+		QueueSize:  config.Int("SIMIO_JOB_QUEUE_SIZE", defaultJobSettings.QueueSize),
+		ChunkSize:  config.Int("SIMIO_JOB_CHUNK_SIZE", defaultJobSettings.ChunkSize),
+		BatchLimit: config.Int("SIMIO_BATCH_LIMIT", defaultBatchLimit),
+		MaxItems:   config.Int("SIMIO_JOB_MAX_ITEMS", defaultJobSettings.MaxItems),
+		Notifier:   BuildWebhookNotifier(),
+	}
+	return NewJobService(settings, simioService, database.BuildJobDAO())
+}
+
+// NewJobService starts the workers and queues again the jobs that were
+// queued or running when the service last stopped.
+func NewJobService(settings JobSettings, simioService SimioService, jobDAO database.JobDAO) JobService {
+	if settings.Workers < 1 {
+		settings.Workers = defaultJobSettings.Workers
+	}
+	if settings.QueueSize < 1 {
+		settings.QueueSize = defaultJobSettings.QueueSize
+	}
+	if settings.ChunkSize < 1 {
+		settings.ChunkSize = defaultJobSettings.ChunkSize
+	}
+	if settings.BatchLimit < 1 {
+		settings.BatchLimit = defaultBatchLimit
+	}
+	if settings.ChunkSize > settings.BatchLimit {
+		log.Printf("Job chunk size %d is over the batch limit, using %d", settings.ChunkSize, settings.BatchLimit)
+		settings.ChunkSize = settings.BatchLimit
+	}
+	if settings.MaxItems < 1 {
+		settings.MaxItems = defaultJobSettings.MaxItems
+	}
+
+	js := &JobServiceImpl{
+		simioService: simioService,
+		jobDAO:       jobDAO,
+		settings:     settings,
+		jobs:         make(map[string]*Job),
+		cancels:      make(map[string]context.CancelFunc),
+	}
+
+	var pending []string
+	for _, entity := range jobDAO.GetAll() {
+		job, err := mapToJob(entity)
+		if err != nil {
+			log.Printf("Ignoring job %s. Details: %s", entity.ID, err)
+			continue
+		}
+		if job.Status == JobRunning {
+			job.Status = JobQueued
+		}
+		if job.Status == JobQueued {
+			pending = append(pending, job.ID)
+		}
+		js.jobs[job.ID] = job
+	}
+
+	js.queue = make(chan string, settings.QueueSize+len(pending))
+	for _, id := range pending {
+		js.queue <- id
+	}
+
+	for i := 0; i < settings.Workers; i++ {
+		go js.work()
+	}
+
+	return js
+}
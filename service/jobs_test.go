@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type JobDaoMock struct {
+	mock.Mock
+	database.JobDAO
+	lock    sync.Mutex
+	updates []database.JobEntity
+	results []json.RawMessage
+	// blocked, when set, holds every update until it is closed.
+	blocked chan bool
+}
+
+func (jm *JobDaoMock) Create(job database.JobEntity) error {
+	args := jm.Called(job)
+	return args.Error(0)
+}
+
+func (jm *JobDaoMock) Update(job database.JobEntity, results json.RawMessage) error {
+	if jm.blocked != nil {
+		<-jm.blocked
+	}
+
+	jm.lock.Lock()
+	jm.updates = append(jm.updates, job)
+	if len(results) > 0 {
+		jm.results = append(jm.results, results)
+	}
+	jm.lock.Unlock()
+	return nil
+}
+
+// waitUpdate waits for the job to be saved with the status, and returns the
+// updates and appended results up to then.
+func (jm *JobDaoMock) waitUpdate(status JobStatus) ([]database.JobEntity, []json.RawMessage) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jm.lock.Lock()
+		updates, results := append([]database.JobEntity{}, jm.updates...), append([]json.RawMessage{}, jm.results...)
+		jm.lock.Unlock()
+
+		if len(updates) > 0 && updates[len(updates)-1].Status == string(status) || time.Now().After(deadline) {
+			return updates, results
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (jm *JobDaoMock) GetAll() []database.JobEntity {
+	args := jm.Called()
+	return args.Get(0).([]database.JobEntity)
+}
+
+// blockingSimioService holds every batch until its context is cancelled.
+type blockingSimioService struct {
+	SimioService
+	started chan bool
+}
+
+func (bs *blockingSimioService) ProcessBatch(ctx context.Context, items []BatchItem, callbackURL string) ([]BatchResult, error) {
+	bs.started <- true
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newJobDaoMock(jobs []database.JobEntity) *JobDaoMock {
+	jobDaoMock := new(JobDaoMock)
+	jobDaoMock.On("Create", mock.Anything).Return(nil)
+	jobDaoMock.On("GetAll").Return(jobs)
+	return jobDaoMock
+}
+
+func newBatchSimioService() SimioService {
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioDaoMock.On("SaveAll", mock.Anything).Return(nil)
+	return NewSimioService(4, 1, simioDaoMock)
+}
+
+func waitJob(jobService JobService, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := jobService.Get(id)
+		if job.Status.finished() || time.Now().After(deadline) {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubmitJob(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		request         JobRequest
+		expectedResults []bool
+	}
+
+	cases := []Case{
+		Case{request: JobRequest{Items: []BatchItem{BatchItem{DNA: dnaSimianHorizontal}}}, expectedResults: []bool{true}},
+		Case{request: JobRequest{Batch: true, Items: []BatchItem{
+			BatchItem{DNA: dnaSimianHorizontal},
+			BatchItem{DNA: dnaHuman},
+			BatchItem{DNA: dnaSimianVertical},
+			BatchItem{DNA: dnaHuman3x5},
+			BatchItem{DNA: dnaSimianDiagonal},
+		}}, expectedResults: []bool{true, false, true, false, true}},
+	}
+
+	for _, currentCase := range cases {
+		jobDaoMock := newJobDaoMock([]database.JobEntity{})
+		jobService := NewJobService(JobSettings{ChunkSize: 2}, newBatchSimioService(), jobDaoMock)
+
+		job, err := jobService.Submit(currentCase.request)
+		assert.Nil(err)
+		assert.Equal(JobQueued, job.Status)
+		assert.Equal(currentCase.request.Batch, job.Batch)
+
+		job = waitJob(jobService, job.ID)
+
+		assert.Equal(JobDone, job.Status)
+		assert.Equal(JobProgress{Done: len(currentCase.expectedResults), Total: len(currentCase.expectedResults)}, job.Progress)
+		for index, expected := range currentCase.expectedResults {
+			assert.Equal(index, job.Results[index].Index)
+			assert.Equal(expected, job.Results[index].IsSimian)
+		}
+
+		updates, chunks := jobDaoMock.waitUpdate(JobDone)
+		assert.Equal(string(JobDone), updates[len(updates)-1].Status)
+
+		// The request is saved once, and each chunk of results is appended once.
+		jobDaoMock.AssertNumberOfCalls(t, "Create", 1)
+		created := jobDaoMock.Calls[1].Arguments.Get(0).(database.JobEntity)
+		assert.Equal("Create", jobDaoMock.Calls[1].Method)
+		var request JobRequest
+		assert.Nil(json.Unmarshal(created.Request, &request))
+		assert.Equal(len(currentCase.request.Items), len(request.Items))
+		for _, update := range updates {
+			assert.Nil(update.Request)
+		}
+
+		var appended []BatchResult
+		for _, chunk := range chunks {
+			var results []BatchResult
+			assert.Nil(json.Unmarshal(chunk, &results))
+			assert.True(len(results) <= 2)
+			appended = append(appended, results...)
+		}
+		assert.Equal(job.Results, appended)
+	}
+}
+
+func TestJobChunkSizeOverBatchLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioDaoMock.On("SaveAll", mock.Anything).Return(nil)
+	simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, BatchLimit: 2}, simioDaoMock)
+
+	jobDaoMock := newJobDaoMock([]database.JobEntity{})
+	jobService := NewJobService(JobSettings{ChunkSize: 5, BatchLimit: 2}, simioService, jobDaoMock)
+
+	job, err := jobService.Submit(JobRequest{Items: []BatchItem{
+		BatchItem{DNA: dnaSimianHorizontal},
+		BatchItem{DNA: dnaHuman},
+		BatchItem{DNA: dnaSimianVertical},
+		BatchItem{DNA: dnaHuman3x5},
+		BatchItem{DNA: dnaSimianDiagonal},
+	}})
+	assert.Nil(err)
+
+	job = waitJob(jobService, job.ID)
+	assert.Equal(JobDone, job.Status)
+	assert.Equal(5, len(job.Results))
+
+	_, chunks := jobDaoMock.waitUpdate(JobDone)
+	assert.Equal(3, len(chunks))
+}
+
+func TestJobSaveDoesNotBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	jobDaoMock := newJobDaoMock([]database.JobEntity{})
+	jobDaoMock.blocked = make(chan bool)
+	jobService := NewJobService(JobSettings{Workers: 1}, newBatchSimioService(), jobDaoMock)
+
+	running, err := jobService.Submit(JobRequest{Items: []BatchItem{BatchItem{DNA: dnaHuman}}})
+	assert.Nil(err)
+
+	// The worker is stuck saving the first job. The other calls go on.
+	done := make(chan bool)
+	go func() {
+		queued, err := jobService.Submit(JobRequest{Items: []BatchItem{BatchItem{DNA: dnaHuman}}})
+		assert.Nil(err)
+		_, found := jobService.Get(running.ID)
+		assert.True(found)
+		_, found = jobService.Get(queued.ID)
+		assert.True(found)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail("Calls blocked behind a save")
+	}
+	close(jobDaoMock.blocked)
+
+	assert.Equal(JobDone, waitJob(jobService, running.ID).Status)
+}
+
+func TestSubmitJobInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	jobService := NewJobService(JobSettings{MaxItems: 2}, newBatchSimioService(), newJobDaoMock([]database.JobEntity{}))
+
+	_, err := jobService.Submit(JobRequest{})
+	assert.NotNil(err)
+
+	_, err = jobService.Submit(JobRequest{Items: make([]BatchItem, 3)})
+	assert.NotNil(err)
+}
+
+func TestCancelJob(t *testing.T) {
+	assert := assert.New(t)
+
+	simioService := &blockingSimioService{started: make(chan bool, 1)}
+	jobService := NewJobService(JobSettings{Workers: 1}, simioService, newJobDaoMock([]database.JobEntity{}))
+
+	running, _ := jobService.Submit(JobRequest{Items: []BatchItem{BatchItem{DNA: dnaHuman}}})
+	queued, _ := jobService.Submit(JobRequest{Items: []BatchItem{BatchItem{DNA: dnaHuman}}})
+	<-simioService.started
+
+	job, err := jobService.Cancel(queued.ID)
+	assert.Nil(err)
+	assert.Equal(JobCancelled, job.Status)
+
+	job, err = jobService.Cancel(running.ID)
+	assert.Nil(err)
+	assert.Equal(JobCancelled, job.Status)
+	assert.Equal(JobCancelled, waitJob(jobService, running.ID).Status)
+
+	_, err = jobService.Cancel(running.ID)
+	assert.Equal(ErrJobFinished, err)
+
+	_, err = jobService.Cancel("unknown")
+	assert.Equal(ErrJobNotFound, err)
+
+	_, found := jobService.Get("unknown")
+	assert.False(found)
+}
+
+func TestJobQueueFull(t *testing.T) {
+	assert := assert.New(t)
+
+	simioService := &blockingSimioService{started: make(chan bool, 10)}
+	jobService := NewJobService(JobSettings{Workers: 1, QueueSize: 1}, simioService, newJobDaoMock([]database.JobEntity{}))
+
+	var errs []error
+	for i := 0; i < 3; i++ {
+		job, err := jobService.Submit(JobRequest{Items: []BatchItem{BatchItem{DNA: dnaHuman}}})
+		errs = append(errs, err)
+		defer jobService.Cancel(job.ID)
+	}
+
+	assert.Contains(errs, ErrJobQueueFull)
+}
+
+func TestResumeJobs(t *testing.T) {
+	assert := assert.New(t)
+
+	request, _ := json.Marshal(JobRequest{Batch: true, Items: []BatchItem{BatchItem{DNA: dnaSimianHorizontal}, BatchItem{DNA: dnaHuman}}})
+	results, _ := json.Marshal([]BatchResult{BatchResult{Index: 0, ID: "111", IsSimian: true}})
+
+	jobDaoMock := newJobDaoMock([]database.JobEntity{
+		database.JobEntity{ID: "running", Status: string(JobRunning), Request: request, Results: results, Done: 1, Total: 2},
+		database.JobEntity{ID: "finished", Status: string(JobDone), Request: request, Results: results, Done: 2, Total: 2},
+		database.JobEntity{ID: "broken", Status: string(JobQueued), Request: json.RawMessage("{")},
+	})
+	jobService := NewJobService(JobSettings{}, newBatchSimioService(), jobDaoMock)
+
+	job := waitJob(jobService, "running")
+
+	assert.Equal(JobDone, job.Status)
+	assert.True(job.Batch)
+	assert.Equal(2, len(job.Results))
+	assert.Equal("111", job.Results[0].ID)
+	assert.Equal(1, job.Results[1].Index)
+	assert.False(job.Results[1].IsSimian)
+
+	job, _ = jobService.Get("finished")
+	assert.Equal(JobDone, job.Status)
+
+	_, found := jobService.Get("broken")
+	assert.False(found)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// IDMigration is the state of the last ID migration the API ran.
+type IDMigration struct {
+	Running    bool       `json:"running"`
+	Migrated   int        `json:"migrated"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// IDMigrator runs MigrateIDs in the background of the API, so the entities are
+// moved to the new IDs while it keeps serving them.
+type IDMigrator interface {
+	// Start starts a migration. It returns false, and the migration that is
+	// running, when one already is.
+	Start() (IDMigration, bool)
+	Status() IDMigration
+}
+
+type IDMigratorImpl struct {
+	simioService SimioService
+	lock         sync.Mutex
+	migration    IDMigration
+}
+
+func NewIDMigrator(simioService SimioService) IDMigrator {
+	return &IDMigratorImpl{simioService: simioService}
+}
+
+func (im *IDMigratorImpl) Start() (IDMigration, bool) {
+	im.lock.Lock()
+	defer im.lock.Unlock()
+
+	if im.migration.Running {
+		return im.migration, false
+	}
+
+	startedAt := time.Now()
+	im.migration = IDMigration{Running: true, StartedAt: &startedAt}
+	go im.run()
+
+	return im.migration, true
+}
+
+func (im *IDMigratorImpl) Status() IDMigration {
+	im.lock.Lock()
+	defer im.lock.Unlock()
+
+	return im.migration
+}
+
+func (im *IDMigratorImpl) run() {
+	migrated, err := im.simioService.MigrateIDs()
+
+	im.lock.Lock()
+	defer im.lock.Unlock()
+
+	finishedAt := time.Now()
+	im.migration.Running = false
+	im.migration.Migrated = migrated
+	im.migration.FinishedAt = &finishedAt
+	if err != nil {
+		im.migration.Error = err.Error()
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"simio-api/database"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func waitMigration(migrator IDMigrator) IDMigration {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		migration := migrator.Status()
+		if !migration.Running || time.Now().After(deadline) {
+			return migration
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIDMigrator(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		replaceErr       error
+		expectedMigrated int
+		expectedError    string
+	}
+
+	cases := []Case{
+		Case{expectedMigrated: 1},
+		Case{replaceErr: fmt.Errorf("UNEXPECTED_ERROR_ON_SAVE"), expectedMigrated: 0, expectedError: "UNEXPECTED_ERROR_ON_SAVE"},
+	}
+
+	for _, c := range cases {
+		legacy := database.SimioEntity{ID: HashSHA1.id("CGAT|GTCA"), DNA: "CGAT|GTCA"}
+		release := make(chan bool)
+
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Snapshot").Return([]database.SimioEntity{legacy})
+		simioDaoMock.On("Replace", mock.Anything, mock.Anything).Run(func(mock.Arguments) { <-release }).Return(c.replaceErr)
+		migrator := NewIDMigrator(NewSimioServiceWithSettings(Settings{Hash: HashSHA256}, simioDaoMock))
+
+		assert.False(migrator.Status().Running)
+
+		migration, started := migrator.Start()
+		assert.True(started)
+		assert.True(migration.Running)
+		assert.NotNil(migration.StartedAt)
+
+		// Only one migration runs at a time.
+		migration, started = migrator.Start()
+		assert.False(started)
+		assert.True(migration.Running)
+
+		close(release)
+		migration = waitMigration(migrator)
+
+		assert.False(migration.Running)
+		assert.Equal(c.expectedMigrated, migration.Migrated)
+		assert.Equal(c.expectedError, migration.Error)
+		assert.NotNil(migration.FinishedAt)
+		simioDaoMock.AssertNumberOfCalls(t, "Replace", 1)
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// MotifWildcard matches any base of the matrix.
+const MotifWildcard = '?'
+
+const maxMotifs = 100
+
+// maxMotifHits caps the hits of a search, since short or wildcard motifs can
+// match nearly every cell in every direction.
+const maxMotifHits = 10000
+
+type MotifSearch struct {
+	Motifs     []string
+	Directions []Direction
+	// Reverse also looks for the motifs read backwards along each direction.
+	Reverse  bool
+	Alphabet string
+}
+
+type MotifHit struct {
+	Motif     string    `json:"motif"`
+	StartRow  int       `json:"start_row"`
+	StartCol  int       `json:"start_col"`
+	EndRow    int       `json:"end_row"`
+	EndCol    int       `json:"end_col"`
+	Direction Direction `json:"direction"`
+	Reversed  bool      `json:"reversed"`
+}
+
+type MotifResult struct {
+	Count int        `json:"count"`
+	Hits  []MotifHit `json:"hits"`
+	// Truncated tells the search stopped at maxMotifHits hits.
+	Truncated bool `json:"truncated"`
+}
+
+func (ss *SimioServiceImpl) SearchMotifs(ctx context.Context, DNA []string, search MotifSearch) (MotifResult, error) {
+	alphabet := ss.rules.Alphabet
+	var err error
+
+	if search.Alphabet != "" {
+		if alphabet, err = ss.findAlphabet(search.Alphabet); err != nil {
+			return MotifResult{}, err
+		}
+	}
+
+	directions := allDirections
+	if len(search.Directions) > 0 {
+		if directions, err = normalizeDirections(search.Directions); err != nil {
+			return MotifResult{}, err
+		}
+	}
+
+	if err = validateMotifs(search.Motifs, alphabet); err != nil {
+		return MotifResult{}, err
+	}
+
+	if err = ss.validateDNA(DNA, alphabet); err != nil {
+		return MotifResult{}, err
+	}
+
+	result := MotifResult{Hits: []MotifHit{}}
+	for _, motif := range search.Motifs {
+		hits, truncated, err := findMotif(ctx, DNA, motif, directions, search.Reverse, maxMotifHits-len(result.Hits))
+		if err != nil {
+			return MotifResult{}, err
+		}
+		result.Hits = append(result.Hits, hits...)
+
+		if truncated {
+			result.Truncated = true
+			break
+		}
+	}
+
+	result.Count = len(result.Hits)
+	return result, nil
+}
+
+func validateMotifs(motifs []string, alphabet *Alphabet) error {
+	if len(motifs) == 0 {
+		return fmt.Errorf("Invalid motifs. At least one motif is required")
+	}
+	if len(motifs) > maxMotifs {
+		return fmt.Errorf("Invalid motifs. At most %d motifs are accepted", maxMotifs)
+	}
+
+	for _, motif := range motifs {
+		if motif == "" {
+			return fmt.Errorf("Invalid motif. Motifs can not be empty")
+		}
+		for i := 0; i < len(motif); i++ {
+			if motif[i] != MotifWildcard && !alphabet.isValid(motif[i]) {
+				return fmt.Errorf("Motif has invalid character ( %c )", motif[i])
+			}
+		}
+	}
+	return nil
+}
+
+// findMotif walks every line of the directions looking for the motif. Reversed
+// hits keep the motif's first base as their start, so they run against the
+// direction. Motifs that read the same backwards are only searched once. It
+// stops at limit hits, reporting whether there were more.
+func findMotif(ctx context.Context, dna []string, motif string, directions []Direction, reverse bool, limit int) ([]MotifHit, bool, error) {
+	hits := []MotifHit{}
+	rows, cols := len(dna), len(dna[0])
+
+	patterns := []string{motif}
+	reversed := reverseString(motif)
+	if reverse && reversed != motif {
+		patterns = append(patterns, reversed)
+	}
+
+	truncated := false
+	for _, direction := range directions {
+		stopped := walkLines(rows, cols, direction, len(motif), func(l line) bool {
+			if ctx.Err() != nil {
+				return true
+			}
+
+			for start := 0; start+len(motif) <= l.length; start++ {
+				for index, pattern := range patterns {
+					if !matchesMotif(dna, l, start, pattern) {
+						continue
+					}
+					if len(hits) == limit {
+						truncated = true
+						return true
+					}
+
+					hit := MotifHit{Motif: motif, Direction: direction, Reversed: index > 0}
+					hit.StartRow, hit.StartCol = l.cell(start)
+					hit.EndRow, hit.EndCol = l.cell(start + len(motif) - 1)
+					if hit.Reversed {
+						hit.StartRow, hit.StartCol, hit.EndRow, hit.EndCol = hit.EndRow, hit.EndCol, hit.StartRow, hit.StartCol
+					}
+					hits = append(hits, hit)
+				}
+			}
+			return false
+		})
+
+		if stopped && !truncated {
+			return nil, false, ctx.Err()
+		}
+		if truncated {
+			break
+		}
+	}
+
+	sortMotifHits(hits)
+	return hits, truncated, nil
+}
+
+func matchesMotif(dna []string, l line, start int, pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		row, col := l.cell(start + i)
+		if pattern[i] != MotifWildcard && pattern[i] != dna[row][col] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortMotifHits(hits []MotifHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Direction != b.Direction {
+			return directionIndex(a.Direction) < directionIndex(b.Direction)
+		}
+		if a.StartRow != b.StartRow {
+			return a.StartRow < b.StartRow
+		}
+		if a.StartCol != b.StartCol {
+			return a.StartCol < b.StartCol
+		}
+		return !a.Reversed && b.Reversed
+	})
+}
+
+func reverseString(value string) string {
+	bytes := []byte(value)
+	for i, j := 0, len(bytes)-1; i < j; i, j = i+1, j-1 {
+		bytes[i], bytes[j] = bytes[j], bytes[i]
+	}
+	return string(bytes)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchMotifs(t *testing.T) {
+	assert := assert.New(t)
+
+	dna := []string{
+		"GATTACA",
+		"ACATTAG",
+		"TGCCGTA",
+	}
+
+	type Case struct {
+		search       MotifSearch
+		expectedHits []MotifHit
+		expectedErr  bool
+	}
+
+	cases := []Case{
+		Case{search: MotifSearch{Motifs: []string{"GATTACA"}}, expectedHits: []MotifHit{
+			MotifHit{Motif: "GATTACA", EndCol: 6, Direction: Horizontal},
+		}},
+		Case{search: MotifSearch{Motifs: []string{"GATTACA"}, Reverse: true}, expectedHits: []MotifHit{
+			MotifHit{Motif: "GATTACA", EndCol: 6, Direction: Horizontal},
+			MotifHit{Motif: "GATTACA", StartRow: 1, StartCol: 6, EndRow: 1, Direction: Horizontal, Reversed: true},
+		}},
+		Case{search: MotifSearch{Motifs: []string{"A?T"}, Directions: []Direction{Horizontal}}, expectedHits: []MotifHit{
+			MotifHit{Motif: "A?T", StartCol: 1, EndCol: 3, Direction: Horizontal},
+			MotifHit{Motif: "A?T", StartRow: 1, StartCol: 2, EndRow: 1, EndCol: 4, Direction: Horizontal},
+		}},
+		Case{search: MotifSearch{Motifs: []string{"GAT"}, Directions: []Direction{Vertical, Diagonal, AntiDiagonal}}, expectedHits: []MotifHit{
+			MotifHit{Motif: "GAT", EndRow: 2, Direction: Vertical},
+			MotifHit{Motif: "GAT", StartRow: 2, StartCol: 1, EndCol: 3, Direction: AntiDiagonal},
+		}},
+		Case{search: MotifSearch{Motifs: []string{"TAG"}, Directions: []Direction{Vertical}, Reverse: true}, expectedHits: []MotifHit{
+			MotifHit{Motif: "TAG", StartRow: 2, Direction: Vertical, Reversed: true},
+		}},
+		Case{search: MotifSearch{Motifs: []string{"ATA"}, Directions: []Direction{Diagonal}, Reverse: true}, expectedHits: []MotifHit{}},
+		Case{search: MotifSearch{Motifs: []string{"CTG"}, Directions: []Direction{AntiDiagonal}}, expectedHits: []MotifHit{}},
+		Case{search: MotifSearch{Motifs: []string{"TCT"}, Directions: []Direction{AntiDiagonal}, Reverse: true}, expectedHits: []MotifHit{
+			MotifHit{Motif: "TCT", StartRow: 2, EndCol: 2, Direction: AntiDiagonal},
+		}},
+		Case{search: MotifSearch{}, expectedErr: true},
+		Case{search: MotifSearch{Motifs: []string{""}}, expectedErr: true},
+		Case{search: MotifSearch{Motifs: []string{"GAZ"}}, expectedErr: true},
+		Case{search: MotifSearch{Motifs: []string{"GAU"}, Alphabet: "rna"}, expectedErr: true},
+		Case{search: MotifSearch{Motifs: []string{"GAT"}, Directions: []Direction{"sideways"}}, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		simioService := NewSimioService(4, 1, new(SimioDaoMock))
+
+		result, err := simioService.SearchMotifs(context.Background(), dna, currentCase.search)
+
+		if currentCase.expectedErr {
+			assert.NotNil(err)
+			continue
+		}
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedHits, result.Hits)
+		assert.Equal(len(currentCase.expectedHits), result.Count)
+	}
+}
+
+func TestSearchMotifsCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	simioService := NewSimioService(4, 1, new(SimioDaoMock))
+	_, err := simioService.SearchMotifs(ctx, []string{"GATTACA"}, MotifSearch{Motifs: []string{"GAT"}})
+
+	assert.Equal(context.Canceled, err)
+}
+
+func TestSearchMotifsTruncated(t *testing.T) {
+	assert := assert.New(t)
+
+	dna := make([]string, 60)
+	for i := range dna {
+		dna[i] = strings.Repeat("A", 60)
+	}
+
+	type Case struct {
+		motifs            []string
+		expectedCount     int
+		expectedTruncated bool
+	}
+
+	cases := []Case{
+		Case{motifs: []string{strings.Repeat("A", 60)}, expectedCount: 60 + 60 + 1 + 1, expectedTruncated: false},
+		Case{motifs: []string{"?"}, expectedCount: maxMotifHits, expectedTruncated: true},
+		Case{motifs: []string{"AAAA", "?"}, expectedCount: maxMotifHits, expectedTruncated: true},
+	}
+
+	for _, c := range cases {
+		simioService := NewSimioService(4, 1, new(SimioDaoMock))
+
+		result, err := simioService.SearchMotifs(context.Background(), dna, MotifSearch{Motifs: c.motifs, Reverse: true})
+
+		assert.Nil(err)
+		assert.Equal(c.expectedCount, result.Count, "%v", c.motifs)
+		assert.Equal(c.expectedCount, len(result.Hits))
+		assert.Equal(c.expectedTruncated, result.Truncated)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// bandsPerWorker splits each direction in more bands than workers, so a
+// cancelled scan stops soon and slow bands don't leave workers idle.
+const bandsPerWorker = 4
+
+type band struct {
+	direction Direction
+	from      int
+	to        int
+}
+
+// scanParallel scans the directions with workers goroutines, each taking bands
+// of units. found is never called concurrently; once it returns true the other
+// workers are cancelled and scanParallel reports true. It returns the context
+// error when ctx is done before the scan ends.
+func scanParallel(ctx context.Context, scanner matrixScanner, directions []Direction, workers int, found func(Sequence) bool) (bool, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	scanCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lock sync.Mutex
+	stopped := false
+	guardedFound := func(sequence Sequence) bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if stopped || scanCtx.Err() != nil {
+			return true
+		}
+		if found(sequence) {
+			stopped = true
+			cancel()
+		}
+		return stopped
+	}
+
+	bands := make(chan band)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range bands {
+				if scanCtx.Err() == nil {
+					scanner.scanUnits(b.direction, b.from, b.to, guardedFound)
+				}
+			}
+		}()
+	}
+
+	feedBands(scanCtx, scanner, directions, workers, bands)
+	close(bands)
+	wg.Wait()
+
+	if stopped {
+		return true, nil
+	}
+	return false, ctx.Err()
+}
+
+func feedBands(ctx context.Context, scanner matrixScanner, directions []Direction, workers int, bands chan<- band) {
+	for _, direction := range directions {
+		units := scanner.units(direction)
+		size := units/(workers*bandsPerWorker) + 1
+
+		for from := 0; from < units; from += size {
+			select {
+			case bands <- band{direction: direction, from: from, to: minInt(from+size, units)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
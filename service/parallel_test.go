@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"simio-api/database"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// countingScanner reports one sequence per unit and counts the units scanned.
+type countingScanner struct {
+	unitsPerDirection int
+	scanned           int64
+}
+
+func (cs *countingScanner) units(direction Direction) int {
+	return cs.unitsPerDirection
+}
+
+func (cs *countingScanner) scanUnits(direction Direction, from, to int, found func(Sequence) bool) bool {
+	for unit := from; unit < to; unit++ {
+		atomic.AddInt64(&cs.scanned, 1)
+		if found(Sequence{StartRow: unit, Direction: direction, Count: 1}) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestScanParallelStopsEarly(t *testing.T) {
+	assert := assert.New(t)
+
+	scanner := &countingScanner{unitsPerDirection: 10000}
+	stopped, err := scanParallel(context.Background(), scanner, allDirections, 4, untilMinSequences(Rules{MinSequences: 3}))
+
+	assert.Nil(err)
+	assert.True(stopped)
+	assert.True(atomic.LoadInt64(&scanner.scanned) < int64(4*scanner.unitsPerDirection))
+}
+
+func TestScanParallelScansEverything(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, workers := range []int{0, 1, 3, 16} {
+		scanner := &countingScanner{unitsPerDirection: 1000}
+		count := 0
+		stopped, err := scanParallel(context.Background(), scanner, allDirections, workers, func(Sequence) bool {
+			count++
+			return false
+		})
+
+		assert.Nil(err)
+		assert.False(stopped)
+		assert.Equal(4*scanner.unitsPerDirection, count)
+	}
+}
+
+func TestScanParallelCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scanner := &countingScanner{unitsPerDirection: 10000}
+	stopped, err := scanParallel(ctx, scanner, allDirections, 4, func(Sequence) bool { return false })
+
+	assert.False(stopped)
+	assert.Equal(context.Canceled, err)
+	assert.Equal(int64(0), atomic.LoadInt64(&scanner.scanned))
+}
+
+func TestParallelMatchesSequential(t *testing.T) {
+	assert := assert.New(t)
+	random := rand.New(rand.NewSource(11))
+
+	for i := 0; i < 100; i++ {
+		dna := randomDNA(random, 1+random.Intn(40), 1+random.Intn(40), "AC")
+		rules := Rules{SequenceSize: 2 + random.Intn(4), MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections, Alphabet: DNAAlphabet}
+
+		for _, engine := range []Engine{EngineScanner, EngineBitPacked} {
+			sequential, _ := findSequences(context.Background(), engine.prepare(dna, rules), rules, 1)
+			parallel, _ := findSequences(context.Background(), engine.prepare(dna, rules), rules, 1+random.Intn(8))
+
+			assert.Equal(sequential, parallel, "engine %s dna %v", engine, dna)
+		}
+	}
+}
+
+func TestProcessDNACancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	_, err := simioService.ProcessDNA(ctx, dnaHuman, DetectionParams{})
+	_, explainErr := simioService.ExplainDNA(ctx, dnaHuman, DetectionParams{})
+
+	assert.Equal(context.Canceled, err)
+	assert.Equal(context.Canceled, explainErr)
+	simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+}
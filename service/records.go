@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"simio-api/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+const (
+	OrderAscending  = "asc"
+	OrderDescending = "desc"
+)
+
+// Record is a stored classification, as the API shows it.
+type Record struct {
+	ID        string    `json:"id"`
+	DNA       []string  `json:"dna"`
+	IsSimian  bool      `json:"is_simian"`
+	Rules     string    `json:"rules,omitempty"`
+	Alphabet  string    `json:"alphabet,omitempty"`
+	Toroidal  bool      `json:"toroidal,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RecordQuery struct {
+	// Cursor is the next_cursor of the previous page. Empty starts over.
+	Cursor   string
+	Limit    int
+	IsSimian *bool
+	// Order sorts by creation time: asc or desc. Empty is desc.
+	Order string
+}
+
+type RecordPage struct {
+	Records    []Record `json:"records"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+func (ss *SimioServiceImpl) GetRecord(id string) (Record, bool) {
+	entity, found := ss.simioDAO.Get(id)
+	if !found {
+		return Record{}, false
+	}
+	return mapToRecord(entity), true
+}
+
+func (ss *SimioServiceImpl) ListRecords(query RecordQuery) (RecordPage, error) {
+	listQuery, err := query.listQuery()
+	if err != nil {
+		return RecordPage{}, err
+	}
+
+	page := ss.simioDAO.List(listQuery)
+
+	records := make([]Record, 0, len(page.Entities))
+	for _, entity := range page.Entities {
+		records = append(records, mapToRecord(entity))
+	}
+
+	recordPage := RecordPage{Records: records}
+	if page.HasMore {
+		last := page.Entities[len(page.Entities)-1]
+		recordPage.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return recordPage, nil
+}
+
+func (ss *SimioServiceImpl) DeleteRecord(id string) (bool, error) {
+	return ss.simioDAO.Delete(id)
+}
+
+func (rq RecordQuery) listQuery() (database.ListQuery, error) {
+	limit := rq.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 1 || limit > maxPageSize {
+		return database.ListQuery{}, fmt.Errorf("Invalid limit ( %d ). It has to be between 1 and %d", rq.Limit, maxPageSize)
+	}
+
+	if rq.Order != "" && rq.Order != OrderAscending && rq.Order != OrderDescending {
+		return database.ListQuery{}, fmt.Errorf("Invalid order ( %s ). It has to be %s or %s", rq.Order, OrderAscending, OrderDescending)
+	}
+
+	listQuery := database.ListQuery{
+		IsSimian:   rq.IsSimian,
+		Descending: rq.Order != OrderAscending,
+		Limit:      limit,
+	}
+
+	if rq.Cursor != "" {
+		createdAt, id, err := decodeCursor(rq.Cursor)
+		if err != nil {
+			return database.ListQuery{}, err
+		}
+		listQuery.AfterCreatedAt = createdAt
+		listQuery.AfterID = id
+	}
+	return listQuery, nil
+}
+
+// encodeCursor hides the position of a record, its creation time and ID, in
+// an opaque token.
+func encodeCursor(createdAt time.Time, id string) string {
+	position := strconv.FormatInt(createdAt.UnixNano(), 10) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	invalid := fmt.Errorf("Invalid cursor ( %s )", cursor)
+
+	position, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", invalid
+	}
+
+	parts := strings.SplitN(string(position), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", invalid
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", invalid
+	}
+	return time.Unix(0, nanos).UTC(), parts[1], nil
+}
+
+func mapToRecord(entity database.SimioEntity) Record {
+	return Record{
+		ID:        entity.ID,
+		DNA:       strings.Split(entity.DNA, "|"),
+		IsSimian:  entity.IsSimian,
+		Rules:     entity.Rules,
+		Alphabet:  entity.Alphabet,
+		Toroidal:  entity.Toroidal,
+		CreatedAt: entity.CreatedAt,
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		query         RecordQuery
+		listQuery     database.ListQuery
+		page          database.ListPage
+		expectedPage  RecordPage
+		expectedError error
+	}
+
+	createdAt := time.Date(2020, 1, 1, 0, 0, 0, 5, time.UTC)
+	simian := true
+	entity := database.SimioEntity{ID: "sha256:111", DNA: "CCCG|AAAT", IsSimian: true, Rules: "size=4", Alphabet: "dna", CreatedAt: createdAt}
+	record := Record{ID: "sha256:111", DNA: []string{"CCCG", "AAAT"}, IsSimian: true, Rules: "size=4", Alphabet: "dna", CreatedAt: createdAt}
+	cursor := encodeCursor(createdAt, entity.ID)
+
+	cases := []Case{
+		Case{
+			listQuery:    database.ListQuery{Descending: true, Limit: defaultPageSize},
+			expectedPage: RecordPage{Records: []Record{}},
+		},
+		Case{
+			query:        RecordQuery{Limit: 1, IsSimian: &simian, Order: OrderAscending},
+			listQuery:    database.ListQuery{IsSimian: &simian, Limit: 1},
+			page:         database.ListPage{Entities: []database.SimioEntity{entity}, HasMore: true},
+			expectedPage: RecordPage{Records: []Record{record}, NextCursor: cursor},
+		},
+		Case{
+			query:        RecordQuery{Cursor: cursor, Order: OrderDescending},
+			listQuery:    database.ListQuery{Descending: true, Limit: defaultPageSize, AfterCreatedAt: createdAt, AfterID: entity.ID},
+			page:         database.ListPage{Entities: []database.SimioEntity{entity}},
+			expectedPage: RecordPage{Records: []Record{record}},
+		},
+		Case{query: RecordQuery{Limit: maxPageSize + 1}, expectedError: fmt.Errorf("Invalid limit ( 501 ). It has to be between 1 and 500")},
+		Case{query: RecordQuery{Limit: -1}, expectedError: fmt.Errorf("Invalid limit ( -1 ). It has to be between 1 and 500")},
+		Case{query: RecordQuery{Order: "newest"}, expectedError: fmt.Errorf("Invalid order ( newest ). It has to be asc or desc")},
+		Case{query: RecordQuery{Cursor: "!!"}, expectedError: fmt.Errorf("Invalid cursor ( !! )")},
+		Case{query: RecordQuery{Cursor: "YWJj"}, expectedError: fmt.Errorf("Invalid cursor ( YWJj )")},
+	}
+
+	for _, c := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("List", c.listQuery).Return(c.page)
+		simioService := NewSimioService(4, 1, simioDaoMock)
+
+		page, err := simioService.ListRecords(c.query)
+
+		assert.Equal(c.expectedError, err)
+		if c.expectedError == nil {
+			assert.Equal(c.expectedPage, page)
+		} else {
+			simioDaoMock.AssertNotCalled(t, "List", c.listQuery)
+		}
+	}
+}
+
+func TestGetAndDeleteRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	entity := database.SimioEntity{ID: "111", DNA: "CCCG|AAAT"}
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", "111").Return(entity, true)
+	simioDaoMock.On("Get", "222").Return(database.SimioEntity{}, false)
+	simioDaoMock.On("Delete", "111").Return(true, nil)
+	simioDaoMock.On("Delete", "222").Return(false, fmt.Errorf("UNEXPECTED_ERROR_ON_DELETE"))
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	record, found := simioService.GetRecord("111")
+	assert.True(found)
+	assert.Equal(Record{ID: "111", DNA: []string{"CCCG", "AAAT"}}, record)
+
+	_, found = simioService.GetRecord("222")
+	assert.False(found)
+
+	deleted, err := simioService.DeleteRecord("111")
+	assert.True(deleted)
+	assert.Nil(err)
+
+	deleted, err = simioService.DeleteRecord("222")
+	assert.False(deleted)
+	assert.Equal(fmt.Errorf("UNEXPECTED_ERROR_ON_DELETE"), err)
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ruleVersion identifies the classification rule stored on each entity.
+// Entities without rules were classified by v1 (first sequence found).
+const ruleVersion = "v2"
+
+type Overlap string
+
+const (
+	// OverlapDisjoint counts AAAAA as a single sequence of 4.
+	OverlapDisjoint Overlap = "disjoint"
+	// OverlapOverlapping counts AAAAA as two sequences of 4.
+	OverlapOverlapping Overlap = "overlapping"
+)
+
+type Rules struct {
+	SequenceSize int
+	MinSequences int
+	Overlap      Overlap
+	Directions   []Direction
+	Alphabet     *Alphabet
+	// MaxMismatches lets a sequence hold up to this many bases other than its
+	// own. Zero only accepts identical bases.
+	MaxMismatches int
+	// Toroidal wraps rows, columns and diagonals around the matrix edges.
+	Toroidal bool
+}
+
+// Limits are the server-side bounds for the parameters a request may send.
+type Limits struct {
+	MaxSequenceSize int
+	MaxMinSequences int
+}
+
+const minSequenceSize = 2
+
+var defaultLimits = Limits{
+	MaxSequenceSize: 32,
+	MaxMinSequences: 100,
+}
+
+// DetectionParams overrides the service rules for a single request.
+// Zero values keep the service defaults.
+type DetectionParams struct {
+	SequenceSize int
+	MinSequences int
+	Overlap      Overlap
+	Directions   []Direction
+	Alphabet     string
+	// MaxMismatches is a pointer since zero is a valid override.
+	MaxMismatches *int
+	Toroidal      *bool
+}
+
+func (r Rules) with(params DetectionParams, limits Limits) (Rules, error) {
+	if params.SequenceSize != 0 {
+		if params.SequenceSize < minSequenceSize || params.SequenceSize > limits.MaxSequenceSize {
+			return r, fmt.Errorf("Invalid sequence_size ( %d ). It has to be between %d and %d", params.SequenceSize, minSequenceSize, limits.MaxSequenceSize)
+		}
+		r.SequenceSize = params.SequenceSize
+	}
+
+	if params.MinSequences < 0 || params.MinSequences > limits.MaxMinSequences {
+		return r, fmt.Errorf("Invalid min_sequences ( %d ). It has to be between 1 and %d", params.MinSequences, limits.MaxMinSequences)
+	}
+	if params.MinSequences > 0 {
+		r.MinSequences = params.MinSequences
+	}
+
+	if len(params.Directions) > 0 {
+		directions, err := normalizeDirections(params.Directions)
+		if err != nil {
+			return r, err
+		}
+		r.Directions = directions
+	}
+
+	if params.MaxMismatches != nil {
+		r.MaxMismatches = *params.MaxMismatches
+	}
+	if r.MaxMismatches < 0 || 2*r.MaxMismatches >= r.SequenceSize {
+		return r, fmt.Errorf("Invalid max_mismatches ( %d ). It has to be less than half the sequence_size", r.MaxMismatches)
+	}
+
+	if params.Toroidal != nil {
+		r.Toroidal = *params.Toroidal
+	}
+	if r.Toroidal && r.MaxMismatches > 0 {
+		return r, fmt.Errorf("Fuzzy detection ( max_mismatches ) is not supported on toroidal matrices")
+	}
+
+	switch params.Overlap {
+	case "":
+	case OverlapDisjoint, OverlapOverlapping:
+		r.Overlap = params.Overlap
+	default:
+		return r, fmt.Errorf("Invalid overlap ( %s ). It has to be %s or %s", params.Overlap, OverlapDisjoint, OverlapOverlapping)
+	}
+
+	return r, nil
+}
+
+func (r Rules) scans(direction Direction) bool {
+	for _, scanned := range r.Directions {
+		if scanned == direction {
+			return true
+		}
+	}
+	return false
+}
+
+// count returns how many sequences a run of runLength identical bases is worth.
+func (r Rules) count(runLength int) int {
+	if runLength < r.SequenceSize {
+		return 0
+	}
+	if r.Overlap == OverlapOverlapping {
+		return runLength - r.SequenceSize + 1
+	}
+	return runLength / r.SequenceSize
+}
+
+// String identifies the rule set. It is stored on each entity and is part of
+// its ID, so the same DNA classified under different rules is kept apart.
+func (r Rules) String() string {
+	rules := fmt.Sprintf("%s;size=%d;min=%d;overlap=%s", ruleVersion, r.SequenceSize, r.MinSequences, r.Overlap)
+
+	if len(r.Directions) != len(allDirections) {
+		names := make([]string, len(r.Directions))
+		for i, direction := range r.Directions {
+			names[i] = string(direction)
+		}
+		rules += ";dirs=" + strings.Join(names, ",")
+	}
+
+	if r.Alphabet != DNAAlphabet {
+		rules += ";alphabet=" + r.Alphabet.Name
+	}
+
+	if r.MaxMismatches > 0 {
+		rules += fmt.Sprintf(";mismatches=%d", r.MaxMismatches)
+	}
+
+	if r.Toroidal {
+		rules += ";toroidal"
+	}
+
+	return rules
+}
+
+// legacyRules is the v1 rule entities without rules were classified by: the
+// first sequence of 4 identical bases in any direction.
+var legacyRules = Rules{
+	SequenceSize: 4,
+	MinSequences: 1,
+	Overlap:      OverlapDisjoint,
+	Directions:   allDirections,
+	Alphabet:     DNAAlphabet,
+}
+
+// parseRules reads back the rules String stored on an entity. An empty value
+// means the legacy v1 rule.
+func (ss *SimioServiceImpl) parseRules(value string) (Rules, error) {
+	if value == "" {
+		return legacyRules, nil
+	}
+
+	fields := strings.Split(value, ";")
+	if fields[0] != ruleVersion {
+		return Rules{}, fmt.Errorf("Unknown rules version ( %s )", fields[0])
+	}
+
+	rules := Rules{Directions: allDirections, Alphabet: DNAAlphabet}
+	var err error
+
+	for _, field := range fields[1:] {
+		if field == "toroidal" {
+			rules.Toroidal = true
+			continue
+		}
+
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return Rules{}, fmt.Errorf("Invalid rules field ( %s )", field)
+		}
+
+		switch key, val := parts[0], parts[1]; key {
+		case "size":
+			rules.SequenceSize, err = strconv.Atoi(val)
+		case "min":
+			rules.MinSequences, err = strconv.Atoi(val)
+		case "mismatches":
+			rules.MaxMismatches, err = strconv.Atoi(val)
+		case "overlap":
+			rules.Overlap = Overlap(val)
+			if rules.Overlap != OverlapDisjoint && rules.Overlap != OverlapOverlapping {
+				err = fmt.Errorf("Invalid overlap ( %s )", val)
+			}
+		case "dirs":
+			var directions []Direction
+			for _, name := range strings.Split(val, ",") {
+				directions = append(directions, Direction(name))
+			}
+			rules.Directions, err = normalizeDirections(directions)
+		case "alphabet":
+			rules.Alphabet, err = ss.findAlphabet(val)
+		default:
+			err = fmt.Errorf("Unknown rules field ( %s )", key)
+		}
+
+		if err != nil {
+			return Rules{}, err
+		}
+	}
+
+	if rules.SequenceSize < minSequenceSize || rules.MinSequences < 1 {
+		return Rules{}, fmt.Errorf("Invalid rules ( %s )", value)
+	}
+	return rules, nil
+}
+
+// normalizeDirections validates the directions and returns them without
+// duplicates, in the order they are scanned.
+func normalizeDirections(directions []Direction) ([]Direction, error) {
+	requested := make(map[Direction]bool)
+	for _, direction := range directions {
+		if !isDirectionValid(direction) {
+			return nil, fmt.Errorf("Invalid direction ( %s )", direction)
+		}
+		requested[direction] = true
+	}
+
+	normalized := []Direction{}
+	for _, direction := range allDirections {
+		if requested[direction] {
+			normalized = append(normalized, direction)
+		}
+	}
+	return normalized, nil
+}
+
+func isDirectionValid(direction Direction) bool {
+	for _, valid := range allDirections {
+		if direction == valid {
+			return true
+		}
+	}
+	return false
+}
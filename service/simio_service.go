@@ -1,9 +1,14 @@
 package service
 
 import (
-	"crypto/sha1"
+	"context"
 	"fmt"
+	"log"
+	"runtime"
+	"simio-api/config"
 	"simio-api/database"
+	"strings"
+	"time"
 )
 
 type Stats struct {
@@ -13,228 +18,297 @@ type Stats struct {
 }
 
 type SimioService interface {
-	ProcessDNA(dna []string) (bool, error)
+	ProcessDNA(ctx context.Context, dna []string, params DetectionParams) (bool, error)
+	ExplainDNA(ctx context.Context, dna []string, params DetectionParams) (Detection, error)
+	ProcessDNAStream(ctx context.Context, rows RowReader, params DetectionParams, explain bool) (Detection, error)
+	SearchMotifs(ctx context.Context, dna []string, search MotifSearch) (MotifResult, error)
+	ProcessBatch(ctx context.Context, items []BatchItem, callbackURL string) ([]BatchResult, error)
 	GetSimiansProportion() Stats
+	RecountStats() (Stats, Stats)
+	GetRecord(id string) (Record, bool)
+	ListRecords(query RecordQuery) (RecordPage, error)
+	DeleteRecord(id string) (bool, error)
+	Subscribe(lastEventID uint64, resume bool) Subscription
+	MigrateIDs() (int, error)
+}
+
+type Settings struct {
+	Rules  Rules
+	Limits Limits
+	// Alphabets are user-defined alphabets requests may choose by name,
+	// besides the built-in dna, rna and iupac.
+	Alphabets []*Alphabet
+	Engine    Engine
+	// Workers is how many goroutines scan a matrix. Zero uses one per CPU.
+	Workers int
+	// Canonical are the transforms a matrix is reduced by before being
+	// stored, so equivalent matrices are stored once. Empty keeps it as sent.
+	Canonical []Transform
+	// Hash builds the entity IDs. Empty uses the legacy sha1.
+	Hash HashAlgorithm
+	// BatchLimit is the most items a batch may have.
+	BatchLimit int
+	// Notifier delivers the callbacks of batches. Nil disables them.
+	Notifier Notifier
+	// EventBufferSize is how many events reconnecting clients can replay.
+	EventBufferSize int
 }
 
 type SimioServiceImpl struct {
-	sequenceSize int
-	simioDAO     database.DAO
+	rules      Rules
+	limits     Limits
+	alphabets  map[string]*Alphabet
+	engine     Engine
+	workers    int
+	canonical  []Transform
+	hash       HashAlgorithm
+	batchLimit int
+	notifier   Notifier
+	events     *EventBus
+	simioDAO   database.DAO
 }
 
-func (ss *SimioServiceImpl) ProcessDNA(DNA []string) (bool, error) {
-	err := ss.validateDNA(DNA)
+func (ss *SimioServiceImpl) ProcessDNA(ctx context.Context, DNA []string, params DetectionParams) (bool, error) {
+	rules, err := ss.rulesFor(params)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = ss.validateDNA(DNA, rules.Alphabet)
 
 	if err != nil {
 		return false, err
 	}
 
-	isSimian := ss.isSimian(DNA)
-	ss.simioDAO.Save(ss.mapToSimioEntity(DNA, isSimian))
+	stringDNA := ss.identityDNA(DNA, rules)
+	if cached, found := ss.findClassified(stringDNA, rules); found {
+		return cached.IsSimian, nil
+	}
+
+	isSimian, err := ss.isSimian(ctx, DNA, rules)
+
+	if err != nil {
+		return false, err
+	}
+
+	ss.store(ss.newSimioEntity(stringDNA, isSimian, rules))
 
 	return isSimian, nil
 }
 
-func (ss *SimioServiceImpl) GetSimiansProportion() Stats {
-	data := ss.simioDAO.GetData()
-
-	simians, humans := 0, 0
+func (ss *SimioServiceImpl) ExplainDNA(ctx context.Context, DNA []string, params DetectionParams) (Detection, error) {
+	rules, err := ss.rulesFor(params)
 
-	for _, entity := range data {
-		if entity.IsSimian {
-			simians++
-		} else {
-			humans++
-		}
+	if err != nil {
+		return Detection{}, err
 	}
 
-	var ratio float64
-	if humans != 0 {
-		ratio = float64(simians) / float64(humans)
-	} else {
-		ratio = float64(0)
+	err = ss.validateDNA(DNA, rules.Alphabet)
+
+	if err != nil {
+		return Detection{}, err
 	}
 
-	return Stats{
-		Ratio:          ratio,
-		CountHumanDNA:  humans,
-		CountMutantDNA: simians,
+	detection, err := findSequences(ctx, ss.engine.prepare(DNA, rules), rules, ss.workers)
+
+	if err != nil {
+		return Detection{}, err
 	}
+
+	ss.store(ss.mapToSimioEntity(DNA, detection.IsSimian, rules))
+
+	return detection, nil
 }
 
-func (ss *SimioServiceImpl) mapToSimioEntity(dna []string, isSimian bool) database.SimioEntity {
-	stringDNA := ss.getStringDNA(dna)
-	return database.SimioEntity{
-		DNA:      stringDNA,
-		ID:       ss.generateId(stringDNA),
-		IsSimian: isSimian,
+// ProcessDNAStream classifies a matrix read row by row. The result is not
+// stored, since that would need the whole matrix in memory.
+func (ss *SimioServiceImpl) ProcessDNAStream(ctx context.Context, rows RowReader, params DetectionParams, explain bool) (Detection, error) {
+	rules, err := ss.rulesFor(params)
+
+	if err != nil {
+		return Detection{}, err
+	}
+
+	if rules.MaxMismatches > 0 {
+		return Detection{}, fmt.Errorf("Fuzzy detection ( max_mismatches ) is not supported on streamed matrices")
+	}
+	if rules.Toroidal {
+		return Detection{}, fmt.Errorf("Toroidal detection is not supported on streamed matrices")
 	}
-}
 
-func (ss *SimioServiceImpl) generateId(dna string) string {
-	hashFunc := sha1.New()
-	hashFunc.Write([]byte(dna))
-	hashBytes := hashFunc.Sum(nil)
-	return fmt.Sprintf("%x", hashBytes)
+	return detectStream(ctx, rows, rules, explain)
 }
 
-func (ss *SimioServiceImpl) getStringDNA(arrayDNA []string) string {
+func (ss *SimioServiceImpl) rulesFor(params DetectionParams) (Rules, error) {
+	rules, err := ss.rules.with(params, ss.limits)
+
+	if err != nil {
+		return rules, err
+	}
 
-	var stringDNA string
-	for i := 0; i < len(arrayDNA); i++ {
-		stringDNA = stringDNA + "|" + arrayDNA[i]
+	if params.Alphabet != "" {
+		rules.Alphabet, err = ss.findAlphabet(params.Alphabet)
 	}
 
-	return stringDNA[1:]
+	return rules, err
 }
 
-func (ss *SimioServiceImpl) isSimian(dna []string) bool {
+func (ss *SimioServiceImpl) findAlphabet(name string) (*Alphabet, error) {
+	if strings.HasPrefix(name, customAlphabetPrefix) {
+		return parseCustomAlphabet(name)
+	}
 
-	if ss.checkHorizontals(dna) || ss.checkVerticals(dna) || ss.checkDiagonals(dna) {
-		return true
+	alphabet, found := ss.alphabets[name]
+	if !found {
+		return nil, fmt.Errorf("Unknown alphabet ( %s )", name)
 	}
+	return alphabet, nil
+}
 
-	return false
+func (ss *SimioServiceImpl) GetSimiansProportion() Stats {
+	return mapToStats(ss.simioDAO.Counts())
 }
 
-func (ss *SimioServiceImpl) checkVerticals(dna []string) bool {
-	n := len(dna)
+// RecountStats checks the stats counters against a count of every stored
+// entity, and fixes them. It returns the stats before and after.
+func (ss *SimioServiceImpl) RecountStats() (Stats, Stats) {
+	previous, counted := ss.simioDAO.Recount()
+	return mapToStats(previous), mapToStats(counted)
+}
 
-	var lastBase byte
-	var sequenceCount int
-	for col := 0; col < n; col++ {
-		for row := 0; row < n; row++ {
-			if ss.verifySequence(&lastBase, dna[row][col], &sequenceCount) {
-				return true
-			}
-		}
-		lastBase = 0
-		sequenceCount = 0
+func mapToStats(counts database.Counts) Stats {
+	var ratio float64
+	if counts.Humans != 0 {
+		ratio = float64(counts.Simians) / float64(counts.Humans)
+	} else {
+		ratio = float64(0)
+	}
+
+	return Stats{
+		Ratio:          ratio,
+		CountHumanDNA:  counts.Humans,
+		CountMutantDNA: counts.Simians,
 	}
-	return false
 }
 
-func (ss *SimioServiceImpl) checkHorizontals(dna []string) bool {
-	n := len(dna)
+// store saves a new entity and, when it was not stored already, publishes it
+// to the event stream.
+func (ss *SimioServiceImpl) store(entity database.SimioEntity) {
+	entity.CreatedAt = time.Now().UTC()
 
-	var lastBase byte
-	var sequenceCount int
-	for row := 0; row < n; row++ {
-		for col := 0; col < n; col++ {
-			if ss.verifySequence(&lastBase, dna[row][col], &sequenceCount) {
-				return true
-			}
-		}
-		lastBase = 0
-		sequenceCount = 0
+	inserted, err := ss.simioDAO.Save(entity)
+	if err != nil || !inserted {
+		return
 	}
-	return false
+	ss.events.Publish(EventClassification, newClassificationEvent(entity))
 }
 
-func (ss *SimioServiceImpl) checkDiagonals(dna []string) bool {
-	numDiagonals := (2 * len(dna)) - 1
-	numTargetDiaginals := numDiagonals - (ss.sequenceSize-1)*2
-	n := len(dna)
-	lastIndex := n - 1
-
-	var lastBase byte
-	var sequenceCount int
+func (ss *SimioServiceImpl) Subscribe(lastEventID uint64, resume bool) Subscription {
+	return ss.events.Subscribe(lastEventID, resume)
+}
 
-	for left, right := 0, 0; left < numTargetDiaginals; left++ {
-		startRow := (ss.sequenceSize - 1) + left
+func (ss *SimioServiceImpl) mapToSimioEntity(dna []string, isSimian bool, rules Rules) database.SimioEntity {
+	return ss.newSimioEntity(ss.identityDNA(dna, rules), isSimian, rules)
+}
 
-		if startRow < n {
-			for row, col := startRow, 0; row >= 0; row, col = row-1, col+1 {
-				if ss.verifySequence(&lastBase, dna[row][col], &sequenceCount) {
-					return true
-				}
-			}
-		} else {
-			startCol := n - (ss.sequenceSize + right)
-			for row, col := lastIndex, startCol; col < n; row, col = row-1, col+1 {
-				if ss.verifySequence(&lastBase, dna[row][col], &sequenceCount) {
-					return true
-				}
-			}
-			right++
-		}
-		lastBase = 0
-		sequenceCount = 0
+func (ss *SimioServiceImpl) newSimioEntity(stringDNA string, isSimian bool, rules Rules) database.SimioEntity {
+	return database.SimioEntity{
+		DNA:      stringDNA,
+		ID:       ss.generateId(stringDNA, rules),
+		IsSimian: isSimian,
+		Rules:    rules.String(),
+		Alphabet: rules.Alphabet.Name,
+		Toroidal: rules.Toroidal,
 	}
+}
 
-	for left, right := 0, 0; left < numTargetDiaginals; left++ {
-		startRow := (n - ss.sequenceSize) - left
+func (ss *SimioServiceImpl) generateId(dna string, rules Rules) string {
+	return ss.hash.id(dna + "#" + rules.String())
+}
 
-		if startRow >= 0 {
-			for row, col := startRow, 0; row < n; row, col = row+1, col+1 {
-				if ss.verifySequence(&lastBase, dna[row][col], &sequenceCount) {
-					return true
-				}
-			}
-		} else {
-			startCol := (n - ss.sequenceSize) - right
+// findClassified looks the DNA up by its ID, and by its legacy sha1 ID, since
+// records not migrated yet are still stored under it. Under the rules v1 used,
+// it also looks up the IDs of v1 records, which hash the DNA alone.
+func (ss *SimioServiceImpl) findClassified(dna string, rules Rules) (database.SimioEntity, bool) {
+	ids := []string{ss.generateId(dna, rules)}
+	if ss.hash != HashSHA1 {
+		ids = append(ids, HashSHA1.id(dna+"#"+rules.String()))
+	}
 
-			for row, col := 0, startCol; col < n; row, col = row+1, col+1 {
-				if ss.verifySequence(&lastBase, dna[row][col], &sequenceCount) {
-					return true
-				}
-			}
-			right++
+	if rules.String() == legacyRules.String() {
+		ids = append(ids, ss.hash.id(dna))
+		if ss.hash != HashSHA1 {
+			ids = append(ids, HashSHA1.id(dna))
 		}
+	}
 
-		lastBase = 0
-		sequenceCount = 0
+	for _, id := range ids {
+		if entity, found := ss.simioDAO.Get(id); found {
+			return entity, true
+		}
 	}
-	return false
+	return database.SimioEntity{}, false
 }
 
-func (ss *SimioServiceImpl) verifySequence(lastBase *byte, currentBase byte, sequenceCount *int) bool {
-
-	if isCharacterNotValid(currentBase) {
-		lastBase = nil
-		sequenceCount = nil
-		return false
+// MigrateIDs moves every stored entity whose ID comes from another hash
+// algorithm to the one this service uses. It returns how many were moved.
+func (ss *SimioServiceImpl) MigrateIDs() (int, error) {
+	var outdated []database.SimioEntity
+	for _, entity := range ss.simioDAO.Snapshot() {
+		if ss.hash.id(entityContent(entity)) != entity.ID {
+			outdated = append(outdated, entity)
+		}
 	}
 
-	if *lastBase != 0 && currentBase == *lastBase {
-		*sequenceCount++
-	} else {
-		*sequenceCount = 1
-		*lastBase = currentBase
-	}
+	migrated := 0
+	for _, entity := range outdated {
+		previousID := entity.ID
+		entity.ID = ss.hash.id(entityContent(entity))
 
-	if *sequenceCount == ss.sequenceSize {
-		return true
+		if err := ss.simioDAO.Replace(previousID, entity); err != nil {
+			return migrated, err
+		}
+		migrated++
 	}
 
-	return false
+	log.Printf("%d entities migrated to %s IDs", migrated, ss.hash)
+	return migrated, nil
 }
 
-func isCharacterNotValid(currentBase byte) bool {
-	const baseA, baseT, baseC, baseG = byte('A'), byte('T'), byte('C'), byte('G')
-
-	if currentBase != baseA && currentBase != baseT && currentBase != baseC && currentBase != baseG {
-		return true
+// identityDNA is the DNA a sample is stored and looked up by: its canonical
+// form, when transforms are set and the rules scan all four directions.
+func (ss *SimioServiceImpl) identityDNA(dna []string, rules Rules) string {
+	if len(ss.canonical) == 0 || len(rules.Directions) != len(allDirections) {
+		return ss.getStringDNA(dna)
 	}
+	return canonicalDNA(dna, ss.canonical, rules.Alphabet)
+}
 
-	return false
+func (ss *SimioServiceImpl) getStringDNA(arrayDNA []string) string {
+	return strings.Join(arrayDNA, "|")
 }
 
-func (ss *SimioServiceImpl) validateDNA(DNA []string) error {
-	const baseA, baseT, baseC, baseG = byte('A'), byte('T'), byte('C'), byte('G')
-	size := len(DNA)
+func (ss *SimioServiceImpl) isSimian(ctx context.Context, dna []string, rules Rules) (bool, error) {
+	return scanParallel(ctx, ss.engine.prepare(dna, rules), rules.Directions, ss.workers, untilMinSequences(rules))
+}
 
-	if len(DNA) == 0 {
+func (ss *SimioServiceImpl) validateDNA(DNA []string, alphabet *Alphabet) error {
+	rows := len(DNA)
+
+	if rows == 0 || len(DNA[0]) == 0 {
 		return fmt.Errorf("Invalid DNA size. the matrix is empty")
 	}
 
-	for row := 0; row < size; row++ {
-		if len(DNA[row]) != size {
-			return fmt.Errorf("Invalid DNA size. It has to be NxN")
+	cols := len(DNA[0])
+
+	for row := 0; row < rows; row++ {
+		if len(DNA[row]) != cols {
+			return fmt.Errorf("Invalid DNA size. All rows must have the same length")
 		}
 
-		for col := 0; col < size; col++ {
-			if isCharacterNotValid(DNA[row][col]) {
+		for col := 0; col < cols; col++ {
+			if !alphabet.isValid(DNA[row][col]) {
 				return fmt.Errorf("Matrix has invalid character ( %c )", DNA[row][col])
 			}
 		}
@@ -243,12 +317,135 @@ func (ss *SimioServiceImpl) validateDNA(DNA []string) error {
 }
 
 func BuildSimioService() SimioService {
-	return NewSimioService(4, database.BuildSimioDAO())
+	settings := Settings{
+		Rules: Rules{
+			SequenceSize:  config.Int("SIMIO_SEQUENCE_SIZE", 4),
+			MinSequences:  config.Int("SIMIO_MIN_SEQUENCES", 1),
+			Overlap:       Overlap(config.String("SIMIO_OVERLAP", string(OverlapDisjoint))),
+			MaxMismatches: config.Int("SIMIO_MAX_MISMATCHES", 0),
+			Toroidal:      config.Bool("SIMIO_TOROIDAL", false),
+		},
+		Limits: Limits{
+			MaxSequenceSize: config.Int("SIMIO_MAX_SEQUENCE_SIZE", defaultLimits.MaxSequenceSize),
+			MaxMinSequences: config.Int("SIMIO_MAX_MIN_SEQUENCES", defaultLimits.MaxMinSequences),
+		},
+		Engine:          Engine(config.String("SIMIO_ENGINE", string(EngineScanner))),
+		Workers:         config.Int("SIMIO_WORKERS", runtime.NumCPU()),
+		Canonical:       parseTransforms(config.String("SIMIO_CANONICAL_TRANSFORMS", "")),
+		Hash:            HashAlgorithm(config.String("SIMIO_HASH", string(HashSHA1))),
+		BatchLimit:      config.Int("SIMIO_BATCH_LIMIT", defaultBatchLimit),
+		Notifier:        BuildWebhookNotifier(),
+		EventBufferSize: config.Int("SIMIO_EVENTS_BUFFER_SIZE", defaultEventBufferSize),
+	}
+	simioService := NewSimioServiceWithSettings(settings, database.BuildSimioDAO()).(*SimioServiceImpl)
+
+	alphabet, err := simioService.findAlphabet(config.String("SIMIO_ALPHABET", DNAAlphabet.Name))
+	if err != nil {
+		log.Printf("%s. Using %s", err, DNAAlphabet.Name)
+		alphabet = DNAAlphabet
+	}
+	simioService.rules.Alphabet = alphabet
+
+	return simioService
 }
 
-func NewSimioService(sequenceSize int, dao database.DAO) SimioService {
+func NewSimioService(sequenceSize int, minSequences int, dao database.DAO) SimioService {
+	return NewSimioServiceWithSettings(Settings{
+		Rules: Rules{
+			SequenceSize: sequenceSize,
+			MinSequences: minSequences,
+		},
+		Limits: defaultLimits,
+	}, dao)
+}
+
+func NewSimioServiceWithSettings(settings Settings, dao database.DAO) SimioService {
+	rules := settings.Rules
+	if rules.MinSequences < 1 {
+		rules.MinSequences = 1
+	}
+	if rules.Overlap != OverlapOverlapping {
+		rules.Overlap = OverlapDisjoint
+	}
+	if len(rules.Directions) == 0 {
+		rules.Directions = allDirections
+	}
+	if rules.Alphabet == nil {
+		rules.Alphabet = DNAAlphabet
+	}
+	if rules.MaxMismatches < 0 || 2*rules.MaxMismatches >= rules.SequenceSize {
+		if rules.MaxMismatches != 0 {
+			log.Printf("Invalid max mismatches %d for sequence size %d. Using 0", rules.MaxMismatches, rules.SequenceSize)
+		}
+		rules.MaxMismatches = 0
+	}
+	if rules.Toroidal && rules.MaxMismatches > 0 {
+		log.Printf("Fuzzy detection is not supported on toroidal matrices. Using 0 max mismatches")
+		rules.MaxMismatches = 0
+	}
+
+	engine := settings.Engine
+	if !isEngineValid(engine) {
+		if engine != "" {
+			log.Printf("Unknown engine %s. Using %s", engine, EngineScanner)
+		}
+		engine = EngineScanner
+	}
+
+	workers := settings.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	hash := settings.Hash
+	if !isHashValid(hash) {
+		if hash != "" {
+			log.Printf("Unknown hash algorithm %s. Using %s", hash, HashSHA1)
+		}
+		hash = HashSHA1
+	}
+
+	batchLimit := settings.BatchLimit
+	if batchLimit < 1 {
+		batchLimit = defaultBatchLimit
+	}
+
+	var canonical []Transform
+	for _, transform := range settings.Canonical {
+		if !isTransformValid(transform) {
+			log.Printf("Unknown transform %s. Ignoring it", transform)
+			continue
+		}
+		canonical = append(canonical, transform)
+	}
+
+	alphabets := make(map[string]*Alphabet)
+	for _, alphabet := range builtInAlphabets {
+		alphabets[alphabet.Name] = alphabet
+	}
+	for _, alphabet := range settings.Alphabets {
+		alphabets[alphabet.Name] = alphabet
+	}
+
+	limits := settings.Limits
+	if limits.MaxSequenceSize == 0 {
+		limits.MaxSequenceSize = defaultLimits.MaxSequenceSize
+	}
+	if limits.MaxMinSequences == 0 {
+		limits.MaxMinSequences = defaultLimits.MaxMinSequences
+	}
+
 	return &SimioServiceImpl{
-		sequenceSize: sequenceSize,
-		simioDAO:     dao,
+		rules:      rules,
+		limits:     limits,
+		alphabets:  alphabets,
+		engine:     engine,
+		workers:    workers,
+		canonical:  canonical,
+		hash:       hash,
+		batchLimit: batchLimit,
+		notifier:   settings.Notifier,
+		events:     NewEventBus(settings.EventBufferSize),
+		simioDAO:   dao,
 	}
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"simio-api/database"
 	"testing"
@@ -29,6 +30,11 @@ var (
 	dnaInvalidLastChar          = []string{"AGTCCCTA", "GCAGGAAT", "TTCCAAGG", "TCAATTGC", "GGTTCCAG", "CCTAGGCC", "TTGCGCAA", "AAACCGTZ"}
 	dnaInvalidFirstChar         = []string{"ZGTCCCTA", "GCAGGAAT", "TTCCAAGG", "TCAATTGC", "GGTTCCAG", "CCTAGGCC", "TTGCGCAA", "AAACCGTA"}
 	dnaEmpty                    = []string{}
+	dnaRunOfFive                = []string{"AAAAA", "CGTCG", "TCGAT", "GATCA", "CTGAC"}
+	dnaSimianHorizontal3x6      = []string{"CTGAGA", "CTTTTC", "TATTGA"}
+	dnaSimianVertical6x3        = []string{"CTG", "CTA", "TTA", "AGA", "CCA", "TCG"}
+	dnaHuman3x5                 = []string{"CTGAG", "GACTC", "TCAGA"}
+	dnaEmptyRow                 = []string{""}
 )
 
 //Mocking simio dao
@@ -38,14 +44,54 @@ type SimioDaoMock struct {
 	database.DAO
 }
 
-func (sm *SimioDaoMock) Save(entity database.SimioEntity) error {
+func (sm *SimioDaoMock) Save(entity database.SimioEntity) (bool, error) {
 	args := sm.Called(entity)
+	return args.Bool(0), args.Error(1)
+}
+
+func (sm *SimioDaoMock) Get(id string) (database.SimioEntity, bool) {
+	args := sm.Called(id)
+	return args.Get(0).(database.SimioEntity), args.Bool(1)
+}
+
+func (sm *SimioDaoMock) Snapshot() []database.SimioEntity {
+	args := sm.Called()
+	return args.Get(0).([]database.SimioEntity)
+}
+
+// SaveAll reports all the entities as inserted unless the mock returns an
+// error.
+func (sm *SimioDaoMock) SaveAll(entities []database.SimioEntity) ([]database.SimioEntity, error) {
+	args := sm.Called(entities)
+	if err := args.Error(0); err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+func (sm *SimioDaoMock) Replace(previousID string, entity database.SimioEntity) error {
+	args := sm.Called(previousID, entity)
 	return args.Error(0)
 }
 
-func (sm *SimioDaoMock) GetData() map[string]database.SimioEntity {
+func (sm *SimioDaoMock) Counts() database.Counts {
+	args := sm.Called()
+	return args.Get(0).(database.Counts)
+}
+
+func (sm *SimioDaoMock) Recount() (database.Counts, database.Counts) {
 	args := sm.Called()
-	return args.Get(0).(map[string]database.SimioEntity)
+	return args.Get(0).(database.Counts), args.Get(1).(database.Counts)
+}
+
+func (sm *SimioDaoMock) List(query database.ListQuery) database.ListPage {
+	args := sm.Called(query)
+	return args.Get(0).(database.ListPage)
+}
+
+func (sm *SimioDaoMock) Delete(id string) (bool, error) {
+	args := sm.Called(id)
+	return args.Bool(0), args.Error(1)
 }
 
 //Start Tests
@@ -78,10 +124,11 @@ func TestProcessDNA(t *testing.T) {
 
 	for _, currentCase := range cases {
 		simioDaoMock := new(SimioDaoMock)
-		simioDaoMock.On("Save", mock.Anything).Return(nil)
-		simioService := NewSimioService(4, simioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioService(4, 1, simioDaoMock)
 
-		res, err := simioService.ProcessDNA(currentCase.instance)
+		res, err := simioService.ProcessDNA(context.Background(), currentCase.instance, DetectionParams{})
 
 		if err != nil {
 			assert.False(res)
@@ -97,45 +144,22 @@ func TestGetSimiansProportion(t *testing.T) {
 	assert := assert.New(t)
 
 	type Case struct {
-		data           map[string]database.SimioEntity
+		counts         database.Counts
 		expectedResult Stats
 	}
 
-	dataMoreHumans := make(map[string]database.SimioEntity)
-	dataMoreHumans["1"] = database.SimioEntity{IsSimian: true}
-	dataMoreHumans["2"] = database.SimioEntity{IsSimian: false}
-	dataMoreHumans["3"] = database.SimioEntity{IsSimian: false}
-
-	dataMoreSimians := make(map[string]database.SimioEntity)
-	dataMoreSimians["1"] = database.SimioEntity{IsSimian: true}
-	dataMoreSimians["2"] = database.SimioEntity{IsSimian: true}
-	dataMoreSimians["3"] = database.SimioEntity{IsSimian: true}
-	dataMoreSimians["4"] = database.SimioEntity{IsSimian: false}
-
-	dataNoHumans := make(map[string]database.SimioEntity)
-	dataNoHumans["1"] = database.SimioEntity{IsSimian: true}
-
-	dataNoSimians := make(map[string]database.SimioEntity)
-	dataNoSimians["1"] = database.SimioEntity{IsSimian: false}
-
-	dataEqualHumanAndSimian := make(map[string]database.SimioEntity)
-	dataEqualHumanAndSimian["1"] = database.SimioEntity{IsSimian: true}
-	dataEqualHumanAndSimian["2"] = database.SimioEntity{IsSimian: true}
-	dataEqualHumanAndSimian["3"] = database.SimioEntity{IsSimian: false}
-	dataEqualHumanAndSimian["4"] = database.SimioEntity{IsSimian: false}
-
 	cases := []Case{
-		Case{data: dataMoreHumans, expectedResult: Stats{CountMutantDNA: 1, CountHumanDNA: 2, Ratio: float64(1) / float64(2)}},
-		Case{data: dataMoreSimians, expectedResult: Stats{CountMutantDNA: 3, CountHumanDNA: 1, Ratio: float64(3) / float64(1)}},
-		Case{data: dataNoHumans, expectedResult: Stats{CountMutantDNA: 1, CountHumanDNA: 0, Ratio: float64(0)}},
-		Case{data: dataNoSimians, expectedResult: Stats{CountMutantDNA: 0, CountHumanDNA: 1, Ratio: float64(0)}},
-		Case{data: dataEqualHumanAndSimian, expectedResult: Stats{CountMutantDNA: 2, CountHumanDNA: 2, Ratio: float64(2) / float64(2)}},
+		Case{counts: database.Counts{Simians: 1, Humans: 2}, expectedResult: Stats{CountMutantDNA: 1, CountHumanDNA: 2, Ratio: float64(1) / float64(2)}},
+		Case{counts: database.Counts{Simians: 3, Humans: 1}, expectedResult: Stats{CountMutantDNA: 3, CountHumanDNA: 1, Ratio: float64(3) / float64(1)}},
+		Case{counts: database.Counts{Simians: 1, Humans: 0}, expectedResult: Stats{CountMutantDNA: 1, CountHumanDNA: 0, Ratio: float64(0)}},
+		Case{counts: database.Counts{Simians: 0, Humans: 1}, expectedResult: Stats{CountMutantDNA: 0, CountHumanDNA: 1, Ratio: float64(0)}},
+		Case{counts: database.Counts{Simians: 2, Humans: 2}, expectedResult: Stats{CountMutantDNA: 2, CountHumanDNA: 2, Ratio: float64(2) / float64(2)}},
 	}
 
 	for _, currentCase := range cases {
 		simioDaoMock := new(SimioDaoMock)
-		simioDaoMock.On("GetData", mock.Anything).Return(currentCase.data)
-		simioService := NewSimioService(4, simioDaoMock)
+		simioDaoMock.On("Counts").Return(currentCase.counts)
+		simioService := NewSimioService(4, 1, simioDaoMock)
 
 		statsResult := simioService.GetSimiansProportion()
 
@@ -145,11 +169,24 @@ func TestGetSimiansProportion(t *testing.T) {
 	}
 }
 
+func TestRecountStats(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Recount").Return(database.Counts{Simians: 3, Humans: 1}, database.Counts{Simians: 2, Humans: 2})
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	previous, counted := simioService.RecountStats()
+
+	assert.Equal(Stats{CountMutantDNA: 3, CountHumanDNA: 1, Ratio: 3}, previous)
+	assert.Equal(Stats{CountMutantDNA: 2, CountHumanDNA: 2, Ratio: 1}, counted)
+}
+
 func TestMapToSimioEntity(t *testing.T) {
 	assert := assert.New(t)
 
 	simioDaoMock := new(SimioDaoMock)
-	simioService := NewSimioService(4, simioDaoMock).(*SimioServiceImpl)
+	simioService := NewSimioService(4, 1, simioDaoMock).(*SimioServiceImpl)
 
 	type Case struct {
 		dna            []string
@@ -161,7 +198,7 @@ func TestMapToSimioEntity(t *testing.T) {
 		Case{
 			dna: dnaHuman, isSimian: false, expectedResult: database.SimioEntity{
 				DNA:      simioService.getStringDNA(dnaHuman),
-				ID:       simioService.generateId(simioService.getStringDNA(dnaHuman)),
+				ID:       simioService.generateId(simioService.getStringDNA(dnaHuman), simioService.rules),
 				IsSimian: false,
 			},
 		},
@@ -169,7 +206,7 @@ func TestMapToSimioEntity(t *testing.T) {
 		Case{
 			dna: dnaSimianDiagonal, isSimian: true, expectedResult: database.SimioEntity{
 				DNA:      simioService.getStringDNA(dnaSimianDiagonal),
-				ID:       simioService.generateId(simioService.getStringDNA(dnaSimianDiagonal)),
+				ID:       simioService.generateId(simioService.getStringDNA(dnaSimianDiagonal), simioService.rules),
 				IsSimian: true,
 			},
 		},
@@ -177,11 +214,12 @@ func TestMapToSimioEntity(t *testing.T) {
 
 	for _, currentCase := range cases {
 
-		entityResult := simioService.mapToSimioEntity(currentCase.dna, currentCase.isSimian)
+		entityResult := simioService.mapToSimioEntity(currentCase.dna, currentCase.isSimian, simioService.rules)
 
 		assert.Equal(currentCase.expectedResult.DNA, entityResult.DNA)
 		assert.Equal(currentCase.expectedResult.ID, entityResult.ID)
 		assert.Equal(currentCase.expectedResult.IsSimian, entityResult.IsSimian)
+		assert.Equal("v2;size=4;min=1;overlap=disjoint", entityResult.Rules)
 	}
 
 }
@@ -190,7 +228,7 @@ func TestIsSimian(t *testing.T) {
 	assert := assert.New(t)
 
 	simioDaoMock := new(SimioDaoMock)
-	simioService := NewSimioService(4, simioDaoMock).(*SimioServiceImpl)
+	simioService := NewSimioService(4, 1, simioDaoMock).(*SimioServiceImpl)
 
 	type Case struct {
 		dna            []string
@@ -214,9 +252,254 @@ func TestIsSimian(t *testing.T) {
 	}
 
 	for _, currentCase := range cases {
-		resultIsSimian := simioService.isSimian(currentCase.dna)
+		resultIsSimian, _ := simioService.isSimian(context.Background(), currentCase.dna, simioService.rules)
 
 		assert.Equal(currentCase.expectedResult, resultIsSimian)
 	}
 
 }
+
+func TestExplainDNA(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna               []string
+		expectedErr       bool
+		expectedSimian    bool
+		expectedSequences []Sequence
+	}
+
+	cases := []Case{
+		Case{dna: dnaSimianHorizontal, expectedSimian: true, expectedSequences: []Sequence{
+			Sequence{StartRow: 3, StartCol: 0, EndRow: 3, EndCol: 3, Direction: Horizontal, Base: "T", Count: 1},
+		}},
+		Case{dna: dnaSimianVertical, expectedSimian: true, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 0, EndRow: 0, EndCol: 3, Direction: Horizontal, Base: "C", Count: 1},
+			Sequence{StartRow: 0, StartCol: 3, EndRow: 3, EndCol: 3, Direction: Vertical, Base: "C", Count: 1},
+		}},
+		Case{dna: dnaSimianDiagonal, expectedSimian: true, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 0, EndRow: 3, EndCol: 3, Direction: Diagonal, Base: "C", Count: 1},
+		}},
+		Case{dna: dnaSimianDiagonal2, expectedSimian: true, expectedSequences: []Sequence{
+			Sequence{StartRow: 3, StartCol: 0, EndRow: 0, EndCol: 3, Direction: AntiDiagonal, Base: "A", Count: 1},
+		}},
+		Case{dna: dnaRunOfFive, expectedSimian: true, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 0, EndRow: 0, EndCol: 4, Direction: Horizontal, Base: "A", Count: 1},
+		}},
+		Case{dna: dnaHuman, expectedSimian: false, expectedSequences: []Sequence{}},
+		Case{dna: dnaInvalidFirstChar, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioService(4, 1, simioDaoMock)
+
+		detection, err := simioService.ExplainDNA(context.Background(), currentCase.dna, DetectionParams{})
+
+		if currentCase.expectedErr {
+			assert.NotNil(err)
+			simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+			continue
+		}
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedSimian, detection.IsSimian)
+		assert.Equal(currentCase.expectedSequences, detection.Sequences)
+		simioDaoMock.AssertNumberOfCalls(t, "Save", 1)
+	}
+}
+
+func TestMinSequences(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna            []string
+		params         DetectionParams
+		expectedErr    bool
+		expectedResult bool
+	}
+
+	cases := []Case{
+		Case{dna: dnaRunOfFive, params: DetectionParams{}, expectedResult: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{MinSequences: 2}, expectedResult: false},
+		Case{dna: dnaRunOfFive, params: DetectionParams{MinSequences: 2, Overlap: OverlapOverlapping}, expectedResult: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{MinSequences: 3, Overlap: OverlapOverlapping}, expectedResult: false},
+		Case{dna: dnaSimianVertical, params: DetectionParams{MinSequences: 2}, expectedResult: true},
+		Case{dna: dnaSimianVertical, params: DetectionParams{MinSequences: 3}, expectedResult: false},
+		Case{dna: dnaHuman, params: DetectionParams{MinSequences: 1}, expectedResult: false},
+		Case{dna: dnaRunOfFive, params: DetectionParams{MinSequences: -1}, expectedErr: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{Overlap: "sometimes"}, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioService(4, 1, simioDaoMock)
+
+		res, err := simioService.ProcessDNA(context.Background(), currentCase.dna, currentCase.params)
+		detection, explainErr := simioService.ExplainDNA(context.Background(), currentCase.dna, currentCase.params)
+
+		if currentCase.expectedErr {
+			assert.NotNil(err)
+			assert.NotNil(explainErr)
+			simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+			continue
+		}
+
+		assert.Equal(currentCase.expectedResult, res)
+		assert.Equal(currentCase.expectedResult, detection.IsSimian)
+	}
+}
+
+func TestRulesCount(t *testing.T) {
+	assert := assert.New(t)
+
+	disjoint := Rules{SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint}
+	overlapping := Rules{SequenceSize: 4, MinSequences: 1, Overlap: OverlapOverlapping}
+
+	assert.Equal(0, disjoint.count(3))
+	assert.Equal(1, disjoint.count(4))
+	assert.Equal(1, disjoint.count(7))
+	assert.Equal(2, disjoint.count(8))
+
+	assert.Equal(0, overlapping.count(3))
+	assert.Equal(1, overlapping.count(4))
+	assert.Equal(2, overlapping.count(5))
+	assert.Equal(5, overlapping.count(8))
+}
+
+func TestDetectionParams(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna            []string
+		params         DetectionParams
+		expectedErr    bool
+		expectedResult bool
+	}
+
+	cases := []Case{
+		Case{dna: dnaRunOfFive, params: DetectionParams{SequenceSize: 5}, expectedResult: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{SequenceSize: 3, MinSequences: 2}, expectedResult: false},
+		Case{dna: dnaSimianHorizontal, params: DetectionParams{Directions: []Direction{Vertical, Diagonal}}, expectedResult: false},
+		Case{dna: dnaSimianHorizontal, params: DetectionParams{Directions: []Direction{Horizontal}}, expectedResult: true},
+		Case{dna: dnaSimianDiagonal2, params: DetectionParams{Directions: []Direction{AntiDiagonal}}, expectedResult: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{SequenceSize: 6}, expectedResult: false},
+		Case{dna: dnaRunOfFive, params: DetectionParams{SequenceSize: 1}, expectedErr: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{SequenceSize: 33}, expectedErr: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{MinSequences: 101}, expectedErr: true},
+		Case{dna: dnaRunOfFive, params: DetectionParams{Directions: []Direction{"sideways"}}, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioService(4, 1, simioDaoMock)
+
+		res, err := simioService.ProcessDNA(context.Background(), currentCase.dna, currentCase.params)
+
+		if currentCase.expectedErr {
+			assert.NotNil(err)
+			simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+			continue
+		}
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedResult, res)
+	}
+}
+
+func TestProcessDNACached(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{IsSimian: true}, true)
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	res, err := simioService.ProcessDNA(context.Background(), dnaHuman, DetectionParams{})
+
+	assert.Nil(err)
+	assert.True(res)
+	simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+}
+
+func TestEntityIdPerRules(t *testing.T) {
+	assert := assert.New(t)
+
+	simioService := NewSimioService(4, 1, new(SimioDaoMock)).(*SimioServiceImpl)
+
+	defaultRules := simioService.rules
+	largerRules, _ := defaultRules.with(DetectionParams{SequenceSize: 5}, defaultLimits)
+	horizontalRules, _ := defaultRules.with(DetectionParams{Directions: []Direction{Horizontal, Horizontal}}, defaultLimits)
+
+	defaultEntity := simioService.mapToSimioEntity(dnaHuman, false, defaultRules)
+	largerEntity := simioService.mapToSimioEntity(dnaHuman, false, largerRules)
+	horizontalEntity := simioService.mapToSimioEntity(dnaHuman, false, horizontalRules)
+
+	assert.NotEqual(defaultEntity.ID, largerEntity.ID)
+	assert.NotEqual(defaultEntity.ID, horizontalEntity.ID)
+	assert.Equal("v2;size=5;min=1;overlap=disjoint", largerEntity.Rules)
+	assert.Equal("v2;size=4;min=1;overlap=disjoint;dirs=horizontal", horizontalEntity.Rules)
+}
+
+func TestValidateDNA(t *testing.T) {
+	assert := assert.New(t)
+
+	simioService := NewSimioService(4, 1, new(SimioDaoMock)).(*SimioServiceImpl)
+
+	type Case struct {
+		dna         []string
+		expectedErr bool
+	}
+
+	cases := []Case{
+		Case{dna: dnaHuman, expectedErr: false},
+		Case{dna: dnaSimianHorizontal3x6, expectedErr: false},
+		Case{dna: dnaSimianVertical6x3, expectedErr: false},
+		Case{dna: dna1x4, expectedErr: false},
+		Case{dna: dnaEmpty, expectedErr: true},
+		Case{dna: dnaEmptyRow, expectedErr: true},
+		Case{dna: dnaDifCols, expectedErr: true},
+		Case{dna: dna4x3, expectedErr: true},
+		Case{dna: dnaInvalidLastChar, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		err := simioService.validateDNA(currentCase.dna, DNAAlphabet)
+
+		assert.Equal(currentCase.expectedErr, err != nil, "dna %v", currentCase.dna)
+	}
+}
+
+func TestProcessDNARectangular(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna            []string
+		expectedResult bool
+	}
+
+	cases := []Case{
+		Case{dna: dnaSimianHorizontal3x6, expectedResult: true},
+		Case{dna: dnaSimianVertical6x3, expectedResult: true},
+		Case{dna: dna1x4, expectedResult: true},
+		Case{dna: dnaHuman3x5, expectedResult: false},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioService(4, 1, simioDaoMock)
+
+		res, err := simioService.ProcessDNA(context.Background(), currentCase.dna, DetectionParams{})
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedResult, res, "dna %v", currentCase.dna)
+		simioDaoMock.AssertNumberOfCalls(t, "Save", 1)
+	}
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// RowReader gives the rows of a matrix one at a time. It returns io.EOF after
+// the last row.
+type RowReader interface {
+	ReadRow() (string, error)
+}
+
+// run is a sequence of identical bases ending on the last row read.
+type run struct {
+	base   byte
+	length int
+}
+
+// streamDetector finds sequences reading one row at a time. It only keeps the
+// runs ending on the previous row for each column, diagonal and anti-diagonal,
+// so its memory grows with the number of columns, not with the matrix.
+type streamDetector struct {
+	rules        Rules
+	found        func(Sequence)
+	rows         int
+	cols         int
+	vertical     []run
+	diagonal     []run
+	antiDiagonal []run
+	next         []run
+	continued    []bool
+}
+
+func newStreamDetector(rules Rules, found func(Sequence)) *streamDetector {
+	return &streamDetector{
+		rules: rules,
+		found: found,
+	}
+}
+
+func (sd *streamDetector) addRow(row string) error {
+	if sd.rows == 0 {
+		if len(row) == 0 {
+			return fmt.Errorf("Invalid DNA size. the matrix is empty")
+		}
+		sd.cols = len(row)
+		sd.vertical = make([]run, sd.cols)
+		sd.diagonal = make([]run, sd.cols)
+		sd.antiDiagonal = make([]run, sd.cols)
+		sd.next = make([]run, sd.cols)
+		sd.continued = make([]bool, sd.cols)
+	}
+
+	if len(row) != sd.cols {
+		return fmt.Errorf("Invalid DNA size. All rows must have the same length")
+	}
+
+	for col := 0; col < sd.cols; col++ {
+		if !sd.rules.Alphabet.isValid(row[col]) {
+			return fmt.Errorf("Matrix has invalid character ( %c )", row[col])
+		}
+	}
+
+	if sd.rules.scans(Horizontal) {
+		sd.scanHorizontal(row)
+	}
+	if sd.rules.scans(Vertical) {
+		sd.addVertical(row)
+	}
+	if sd.rules.scans(Diagonal) {
+		sd.diagonal = sd.addDiagonal(row, sd.diagonal, Diagonal, -1)
+	}
+	if sd.rules.scans(AntiDiagonal) {
+		sd.antiDiagonal = sd.addDiagonal(row, sd.antiDiagonal, AntiDiagonal, 1)
+	}
+
+	sd.rows++
+	return nil
+}
+
+// finish reports the runs still open on the last row.
+func (sd *streamDetector) finish() error {
+	if sd.rows == 0 {
+		return fmt.Errorf("Invalid DNA size. the matrix is empty")
+	}
+
+	last := sd.rows - 1
+	for col := 0; col < sd.cols; col++ {
+		sd.flush(sd.vertical[col], Vertical, last, col)
+		sd.flush(sd.diagonal[col], Diagonal, last, col)
+		sd.flush(sd.antiDiagonal[col], AntiDiagonal, last, col)
+	}
+	return nil
+}
+
+func (sd *streamDetector) scanHorizontal(row string) {
+	l := line{direction: Horizontal, colStep: 1, length: sd.cols}
+	scanLine([]string{row}, l, sd.rules, func(sequence Sequence) bool {
+		sequence.StartRow, sequence.EndRow = sd.rows, sd.rows
+		sd.found(sequence)
+		return false
+	})
+}
+
+func (sd *streamDetector) addVertical(row string) {
+	for col := 0; col < sd.cols; col++ {
+		next, continued := sd.continueRun(sd.vertical[col], row[col])
+		if !continued {
+			sd.flush(sd.vertical[col], Vertical, sd.rows-1, col)
+		}
+		sd.vertical[col] = next
+	}
+}
+
+// addDiagonal extends the runs of a diagonal family, where the cell (row, col)
+// follows (row-1, col+previousCol). It returns the runs ending on this row and
+// reuses the previous ones as the next buffer.
+func (sd *streamDetector) addDiagonal(row string, previous []run, direction Direction, previousCol int) []run {
+	current := sd.next
+	continued := sd.continued
+	for col := range continued {
+		continued[col] = false
+	}
+
+	for col := 0; col < sd.cols; col++ {
+		from := col + previousCol
+		if from < 0 || from >= sd.cols {
+			current[col], _ = sd.continueRun(run{}, row[col])
+			continue
+		}
+
+		var ok bool
+		current[col], ok = sd.continueRun(previous[from], row[col])
+		if ok {
+			continued[from] = true
+		}
+	}
+
+	for col := 0; col < sd.cols; col++ {
+		if !continued[col] {
+			sd.flush(previous[col], direction, sd.rows-1, col)
+		}
+	}
+
+	sd.next = previous
+	return current
+}
+
+func (sd *streamDetector) continueRun(previous run, base byte) (run, bool) {
+	if !sd.rules.Alphabet.isRunBase(base) {
+		return run{}, false
+	}
+	if previous.length > 0 && previous.base == base {
+		return run{base: base, length: previous.length + 1}, true
+	}
+	return run{base: base, length: 1}, false
+}
+
+// flush reports a run that ended on (lastRow, lastCol), the last cell read.
+func (sd *streamDetector) flush(r run, direction Direction, lastRow, lastCol int) {
+	if r.length < sd.rules.SequenceSize {
+		return
+	}
+
+	span := r.length - 1
+	sequence := Sequence{Direction: direction, Base: string(r.base), Count: sd.rules.count(r.length)}
+
+	switch direction {
+	case Vertical:
+		sequence.StartRow, sequence.StartCol = lastRow-span, lastCol
+		sequence.EndRow, sequence.EndCol = lastRow, lastCol
+	case Diagonal:
+		sequence.StartRow, sequence.StartCol = lastRow-span, lastCol-span
+		sequence.EndRow, sequence.EndCol = lastRow, lastCol
+	case AntiDiagonal:
+		sequence.StartRow, sequence.StartCol = lastRow, lastCol
+		sequence.EndRow, sequence.EndCol = lastRow-span, lastCol+span
+	}
+
+	sd.found(sequence)
+}
+
+// detectStream reads every row and returns the detection. Sequences are only
+// kept when explain is set, so a plain classification stays in O(columns).
+func detectStream(ctx context.Context, rows RowReader, rules Rules, explain bool) (Detection, error) {
+	detection := Detection{
+		Rules:     rules.String(),
+		Sequences: []Sequence{},
+	}
+
+	detector := newStreamDetector(rules, func(sequence Sequence) {
+		detection.Count += sequence.Count
+		if explain {
+			detection.Sequences = append(detection.Sequences, sequence)
+		}
+	})
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return Detection{}, err
+		}
+
+		row, err := rows.ReadRow()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Detection{}, err
+		}
+
+		if err := detector.addRow(row); err != nil {
+			return Detection{}, err
+		}
+	}
+
+	if err := detector.finish(); err != nil {
+		return Detection{}, err
+	}
+
+	sortSequences(detection.Sequences)
+	detection.IsSimian = detection.Count >= rules.MinSequences
+	return detection, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type sliceRowReader struct {
+	rows []string
+}
+
+func (sr *sliceRowReader) ReadRow() (string, error) {
+	if len(sr.rows) == 0 {
+		return "", io.EOF
+	}
+	row := sr.rows[0]
+	sr.rows = sr.rows[1:]
+	return row, nil
+}
+
+func TestDetectStreamMatchesScanner(t *testing.T) {
+	assert := assert.New(t)
+	random := rand.New(rand.NewSource(3))
+
+	alphabets := []*Alphabet{DNAAlphabet, IUPACAlphabet}
+	bases := []string{"AC", "AAACN"}
+
+	for i := 0; i < 400; i++ {
+		index := random.Intn(len(alphabets))
+		dna := randomDNA(random, 1+random.Intn(15), 1+random.Intn(15), bases[index])
+
+		directions := []Direction{}
+		for _, direction := range allDirections {
+			if random.Intn(4) != 0 {
+				directions = append(directions, direction)
+			}
+		}
+		if len(directions) == 0 {
+			directions = allDirections
+		}
+
+		rules := Rules{
+			SequenceSize: 2 + random.Intn(4),
+			MinSequences: 1,
+			Overlap:      OverlapOverlapping,
+			Directions:   directions,
+			Alphabet:     alphabets[index],
+		}
+
+		expected, _ := findSequences(context.Background(), lineScanner{dna, rules}, rules, 1)
+		actual, err := detectStream(context.Background(), &sliceRowReader{rows: dna}, rules, true)
+
+		assert.Nil(err)
+		assert.Equal(expected, actual, "rules %s dna %v", rules, dna)
+	}
+}
+
+func TestDetectStream(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections, Alphabet: DNAAlphabet}
+
+	type Case struct {
+		dna            []string
+		explain        bool
+		expectedErr    bool
+		expectedResult bool
+	}
+
+	cases := []Case{
+		Case{dna: dnaSimianHorizontal, expectedResult: true},
+		Case{dna: dnaSimianDiagonal2, explain: true, expectedResult: true},
+		Case{dna: dnaSimianVertical6x3, expectedResult: true},
+		Case{dna: dnaHuman, expectedResult: false},
+		Case{dna: dnaEmpty, expectedErr: true},
+		Case{dna: dnaEmptyRow, expectedErr: true},
+		Case{dna: dnaDifCols, expectedErr: true},
+		Case{dna: dnaInvalidLastChar, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		detection, err := detectStream(context.Background(), &sliceRowReader{rows: currentCase.dna}, rules, currentCase.explain)
+
+		if currentCase.expectedErr {
+			assert.NotNil(err)
+			continue
+		}
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedResult, detection.IsSimian)
+		assert.Equal(currentCase.explain && currentCase.expectedResult, len(detection.Sequences) > 0)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := detectStream(ctx, &sliceRowReader{rows: dnaHuman}, rules, false)
+	assert.Equal(context.Canceled, err)
+}
+
+// Streamed samples are classified but never stored, so they stay out of the
+// stats, unlike the same DNA posted to /simian.
+func TestProcessDNAStreamDoesNotStore(t *testing.T) {
+	assert := assert.New(t)
+
+	simioDaoMock := new(SimioDaoMock)
+	simioService := NewSimioService(4, 1, simioDaoMock)
+
+	detection, err := simioService.ProcessDNAStream(context.Background(), &sliceRowReader{rows: dnaSimianHorizontal}, DetectionParams{}, false)
+
+	assert.Nil(err)
+	assert.True(detection.IsSimian)
+	simioDaoMock.AssertNotCalled(t, "Save", mock.Anything)
+	simioDaoMock.AssertNotCalled(t, "SaveAll", mock.Anything)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConcurrentProcessDNA classifies matrices while others read the stats
+// and the records, on a real DAO. It is meant to be run with -race.
+func TestConcurrentProcessDNA(t *testing.T) {
+	assert := assert.New(t)
+
+	currentDir, _ := os.Getwd()
+	defer os.RemoveAll(currentDir + "/database/")
+
+	simioService := NewSimioService(4, 1, database.NewSimioDAO(currentDir+"/database/data/simios/"))
+
+	size := 100
+	if testing.Short() {
+		size = 10
+	}
+	bases := "ACGT"
+
+	var wg sync.WaitGroup
+	for i := 0; i < size; i++ {
+		dna := []string{"CCCG", "AAAT", "GGGA", fmt.Sprintf("T%c%c%c", bases[i%4], bases[i/4%4], bases[i/16%4])}
+
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := simioService.ProcessDNA(context.Background(), dna, DetectionParams{})
+			assert.Nil(err)
+		}()
+		go func() {
+			defer wg.Done()
+			simioService.GetSimiansProportion()
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := simioService.ListRecords(RecordQuery{Limit: 5})
+			assert.Nil(err)
+		}()
+	}
+	wg.Wait()
+
+	expected := size
+	if expected > 64 {
+		expected = 64
+	}
+	stats := simioService.GetSimiansProportion()
+	assert.Equal(expected, stats.CountMutantDNA+stats.CountHumanDNA)
+}
@@ -0,0 +1,102 @@
+package service
+
+// On a torus every line closes on itself. Rows and columns are cycles of cols
+// and rows cells; each diagonal family splits in gcd(rows, cols) cycles of
+// lcm(rows, cols) cells, starting on the first row.
+
+func torusLineCount(rows, cols int, direction Direction) int {
+	switch direction {
+	case Horizontal:
+		return rows
+	case Vertical:
+		return cols
+	case Diagonal, AntiDiagonal:
+		return gcd(rows, cols)
+	}
+	return 0
+}
+
+func torusLineAt(rows, cols int, direction Direction, index int) line {
+	l := line{direction: direction, rows: rows, cols: cols}
+
+	switch direction {
+	case Horizontal:
+		l.row, l.colStep, l.length = index, 1, cols
+	case Vertical:
+		l.col, l.rowStep, l.length = index, 1, rows
+	case Diagonal:
+		l.col, l.rowStep, l.colStep, l.length = index, 1, 1, lcm(rows, cols)
+	default:
+		l.col, l.rowStep, l.colStep, l.length = index, -1, 1, lcm(rows, cols)
+	}
+	return l
+}
+
+// walkTorusRange visits the toroidal lines from index from to to. Lines whose
+// cycle is shorter than minLength are skipped: a sequence never reuses a cell,
+// so a cycle shorter than the sequence size cannot hold one.
+func walkTorusRange(rows, cols int, direction Direction, minLength int, from, to int, visit func(line) bool) bool {
+	for index := from; index < to; index++ {
+		l := torusLineAt(rows, cols, direction, index)
+		if l.length >= minLength && visit(l) {
+			return true
+		}
+	}
+	return false
+}
+
+// alignCycle moves the start of a toroidal line to a cell where a run can
+// begin, so a run crossing the matrix edge is not split in two. When the whole
+// cycle is a single run it reports true instead, since such a run has no start.
+func alignCycle(dna []string, l line, rules Rules) (line, bool) {
+	baseAt := func(i int) byte {
+		row, col := l.cell(i)
+		return dna[row][col]
+	}
+
+	previous := baseAt(l.length - 1)
+	for i := 0; i < l.length; i++ {
+		current := baseAt(i)
+		if current != previous || !rules.Alphabet.isRunBase(current) {
+			l.row, l.col = l.cell(i)
+			return l, false
+		}
+		previous = current
+	}
+	return l, true
+}
+
+// wholeCycleSequence reports a cycle made of a single base. Its length is the
+// cycle length, however long the run would look when repeated.
+func wholeCycleSequence(dna []string, l line, rules Rules) Sequence {
+	startRow, startCol := l.cell(0)
+	endRow, endCol := l.cell(l.length - 1)
+	return Sequence{
+		StartRow:  startRow,
+		StartCol:  startCol,
+		EndRow:    endRow,
+		EndCol:    endCol,
+		Direction: l.direction,
+		Base:      string(dna[startRow][startCol]),
+		Count:     rules.count(l.length),
+	}
+}
+
+func wrap(value, size int) int {
+	value %= size
+	if value < 0 {
+		value += size
+	}
+	return value
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b int) int {
+	return a / gcd(a, b) * b
+}
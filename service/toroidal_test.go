@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// bruteForceTorusCount follows every cell around the torus on its own. A
+// cycle made of a single base is counted once, as a run of the cycle length.
+func bruteForceTorusCount(dna []string, rules Rules) int {
+	rows, cols := len(dna), len(dna[0])
+	count := 0
+
+	for _, direction := range rules.Directions {
+		step := directionSteps[direction]
+		next := func(row, col, n int) (int, int) {
+			return wrap(row+n*step[0], rows), wrap(col+n*step[1], cols)
+		}
+		uniform := make(map[[2]int]bool)
+
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				base := dna[row][col]
+				cycle := 1
+				for r, c := next(row, col, 1); r != row || c != col; r, c = next(r, c, 1) {
+					cycle++
+				}
+
+				length := 1
+				for length < cycle {
+					r, c := next(row, col, length)
+					if dna[r][c] != base {
+						break
+					}
+					length++
+				}
+
+				if length == cycle {
+					if !uniform[[2]int{row, col}] {
+						count += rules.count(cycle)
+						for i := 0; i < cycle; i++ {
+							r, c := next(row, col, i)
+							uniform[[2]int{r, c}] = true
+						}
+					}
+					continue
+				}
+
+				previousRow, previousCol := next(row, col, -1)
+				if dna[previousRow][previousCol] != base {
+					count += rules.count(length)
+				}
+			}
+		}
+	}
+	return count
+}
+
+func TestFindSequencesToroidal(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		dna               []string
+		directions        []Direction
+		sequenceSize      int
+		expectedSequences []Sequence
+	}
+
+	cases := []Case{
+		Case{dna: []string{"AACGTAA", "CGTCAGT"}, directions: []Direction{Horizontal}, sequenceSize: 4, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 5, EndRow: 0, EndCol: 1, Direction: Horizontal, Base: "A", Count: 1},
+		}},
+		Case{dna: []string{"AC", "AT", "CC", "TG", "GA", "AT"}, directions: []Direction{Vertical}, sequenceSize: 3, expectedSequences: []Sequence{
+			Sequence{StartRow: 5, StartCol: 0, EndRow: 1, EndCol: 0, Direction: Vertical, Base: "A", Count: 1},
+		}},
+		Case{dna: []string{"AAAA", "CGTC"}, directions: []Direction{Horizontal}, sequenceSize: 4, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 0, EndRow: 0, EndCol: 3, Direction: Horizontal, Base: "A", Count: 1},
+		}},
+		Case{dna: []string{"AAAA", "CGTC"}, directions: []Direction{Horizontal}, sequenceSize: 5, expectedSequences: []Sequence{}},
+		// A cycle shorter than the sequence size never holds one, however many
+		// times it wraps.
+		Case{dna: []string{"AAA", "CGT"}, directions: []Direction{Horizontal}, sequenceSize: 4, expectedSequences: []Sequence{}},
+		Case{dna: []string{"AAA", "AAA", "AAA"}, directions: allDirections, sequenceSize: 4, expectedSequences: []Sequence{}},
+		Case{dna: []string{"ACG", "GAC", "CGA"}, directions: []Direction{Diagonal}, sequenceSize: 3, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 0, EndRow: 2, EndCol: 2, Direction: Diagonal, Base: "A", Count: 1},
+			Sequence{StartRow: 0, StartCol: 1, EndRow: 2, EndCol: 0, Direction: Diagonal, Base: "C", Count: 1},
+			Sequence{StartRow: 0, StartCol: 2, EndRow: 2, EndCol: 1, Direction: Diagonal, Base: "G", Count: 1},
+		}},
+		Case{dna: []string{"ACGT", "GTAC"}, directions: []Direction{Diagonal}, sequenceSize: 4, expectedSequences: []Sequence{}},
+		Case{dna: []string{"CTA", "GAT", "ATG"}, directions: []Direction{AntiDiagonal}, sequenceSize: 3, expectedSequences: []Sequence{
+			Sequence{StartRow: 0, StartCol: 2, EndRow: 1, EndCol: 1, Direction: AntiDiagonal, Base: "A", Count: 1},
+		}},
+	}
+
+	for _, currentCase := range cases {
+		rules := Rules{Alphabet: DNAAlphabet, SequenceSize: currentCase.sequenceSize, MinSequences: 1, Overlap: OverlapDisjoint, Directions: currentCase.directions, Toroidal: true}
+
+		detection, err := findSequences(context.Background(), lineScanner{dna: currentCase.dna, rules: rules}, rules, 2)
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedSequences, detection.Sequences, "dna %v", currentCase.dna)
+	}
+}
+
+func TestToroidalMatchesBruteForce(t *testing.T) {
+	assert := assert.New(t)
+
+	random := rand.New(rand.NewSource(11))
+
+	for i := 0; i < 300; i++ {
+		rows, cols := 1+random.Intn(7), 1+random.Intn(7)
+		dna := randomDNA(random, rows, cols, "AT")
+
+		for _, overlap := range []Overlap{OverlapDisjoint, OverlapOverlapping} {
+			rules := Rules{Alphabet: DNAAlphabet, SequenceSize: 2 + random.Intn(4), MinSequences: 1, Overlap: overlap, Directions: allDirections, Toroidal: true}
+
+			detection, err := findSequences(context.Background(), lineScanner{dna: dna, rules: rules}, rules, 3)
+
+			assert.Nil(err)
+			assert.Equal(bruteForceTorusCount(dna, rules), detection.Count, "dna %v rules %s", dna, rules.String())
+		}
+	}
+}
+
+func TestProcessDNAToroidal(t *testing.T) {
+	assert := assert.New(t)
+
+	yes, no, one := true, false, 1
+	dna := []string{"AACGTAA", "CGTCAGT", "TCAGCTC"}
+
+	type Case struct {
+		engine           Engine
+		params           DetectionParams
+		expectedErr      bool
+		expectedResult   bool
+		expectedToroidal bool
+	}
+
+	cases := []Case{
+		Case{engine: EngineScanner, params: DetectionParams{}, expectedResult: false},
+		Case{engine: EngineScanner, params: DetectionParams{Toroidal: &no}, expectedResult: false},
+		Case{engine: EngineScanner, params: DetectionParams{Toroidal: &yes}, expectedResult: true, expectedToroidal: true},
+		Case{engine: EngineBitPacked, params: DetectionParams{Toroidal: &yes}, expectedResult: true, expectedToroidal: true},
+		Case{engine: EngineScanner, params: DetectionParams{Toroidal: &yes, MaxMismatches: &one}, expectedErr: true},
+	}
+
+	for _, currentCase := range cases {
+		simioDaoMock := new(SimioDaoMock)
+		simioDaoMock.On("Save", mock.Anything).Return(true, nil)
+		simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+		simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Engine: currentCase.engine}, simioDaoMock)
+
+		res, err := simioService.ProcessDNA(context.Background(), dna, currentCase.params)
+
+		if currentCase.expectedErr {
+			assert.NotNil(err)
+			continue
+		}
+
+		assert.Nil(err)
+		assert.Equal(currentCase.expectedResult, res)
+		saved := simioDaoMock.Calls[len(simioDaoMock.Calls)-1].Arguments.Get(0).(database.SimioEntity)
+		assert.Equal(currentCase.expectedToroidal, saved.Toroidal)
+	}
+}
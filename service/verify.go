@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"simio-api/config"
+	"simio-api/database"
+	"strings"
+)
+
+// Verify actions, telling what repairing did to a file.
+const (
+	ActionRewritten   = "rewritten"
+	ActionQuarantined = "quarantined"
+)
+
+// VerifyIssue is a file of the data directory that failed a check.
+type VerifyIssue struct {
+	Path     string
+	ID       string
+	Problems []string
+	// Action is what repairing did to the file. It is empty when the file was
+	// not repaired.
+	Action string
+	// RepairErr is why repairing the file failed.
+	RepairErr error
+}
+
+// VerifyReport is the result of checking every file of the data directory.
+type VerifyReport struct {
+	Checked int
+	Issues  []VerifyIssue
+}
+
+// Unresolved counts the issues left without a repair.
+func (vr VerifyReport) Unresolved() int {
+	unresolved := 0
+	for _, issue := range vr.Issues {
+		if issue.Action == "" {
+			unresolved++
+		}
+	}
+	return unresolved
+}
+
+// FileVerifier checks the entity files of the file storage offline: their
+// JSON, their ID and file name against the hash of their content, and their
+// classification against a new run of the rules they were classified by.
+type FileVerifier struct {
+	service *SimioServiceImpl
+	dir     string
+}
+
+// Verify checks every file. With repair, files whose classification or place
+// is wrong are rewritten, and files that cannot be trusted are quarantined.
+func (fv *FileVerifier) Verify(repair bool) (VerifyReport, error) {
+	var report VerifyReport
+
+	err := database.WalkEntityFiles(fv.dir, func(file database.EntityFile) {
+		report.Checked++
+
+		issue, fixable := fv.check(file)
+		if len(issue.Problems) == 0 {
+			return
+		}
+
+		if repair {
+			fv.repair(&issue, file, fixable)
+		}
+		report.Issues = append(report.Issues, issue)
+	})
+
+	if err != nil {
+		return report, fmt.Errorf("Error on walking %s. Details: %s", fv.dir, err)
+	}
+	return report, nil
+}
+
+// check returns the problems of a file, and the entity that fixes them when
+// the entity can be trusted.
+func (fv *FileVerifier) check(file database.EntityFile) (VerifyIssue, *database.SimioEntity) {
+	issue := VerifyIssue{Path: file.Path, ID: file.Entity.ID}
+
+	if file.Err != nil {
+		issue.Problems = append(issue.Problems, file.Err.Error())
+		return issue, nil
+	}
+
+	entity := file.Entity
+
+	hash := hashOf(entity.ID)
+	if !isHashValid(hash) {
+		issue.Problems = append(issue.Problems, fmt.Sprintf("Unknown hash algorithm ( %s )", hash))
+		return issue, nil
+	}
+	if expected := hash.id(entityContent(entity)); expected != entity.ID {
+		issue.Problems = append(issue.Problems, fmt.Sprintf("ID does not match its content, whose %s is %s", hash, expected))
+		return issue, nil
+	}
+
+	rules, err := fv.service.parseRules(entity.Rules)
+	if err != nil {
+		issue.Problems = append(issue.Problems, err.Error())
+		return issue, nil
+	}
+
+	dna := strings.Split(entity.DNA, "|")
+	if err := fv.service.validateDNA(dna, rules.Alphabet); err != nil {
+		issue.Problems = append(issue.Problems, err.Error())
+		return issue, nil
+	}
+
+	if !file.InPlace() {
+		issue.Problems = append(issue.Problems, "File name or shard directory does not match the ID")
+	}
+
+	isSimian, err := fv.service.isSimian(context.Background(), dna, rules)
+	if err != nil {
+		issue.Problems = append(issue.Problems, err.Error())
+		return issue, nil
+	}
+	if isSimian != entity.IsSimian {
+		issue.Problems = append(issue.Problems, fmt.Sprintf("Stored as is_simian %t, but classifies as %t", entity.IsSimian, isSimian))
+		entity.IsSimian = isSimian
+	}
+
+	return issue, &entity
+}
+
+func (fv *FileVerifier) repair(issue *VerifyIssue, file database.EntityFile, fixed *database.SimioEntity) {
+	if fixed != nil {
+		err := database.RewriteEntityFile(fv.dir, file.Path, *fixed)
+		if err == nil {
+			issue.Action = ActionRewritten
+			return
+		}
+		if err != database.ErrEntityStored {
+			issue.RepairErr = err
+			return
+		}
+		// Another file holds the entity already, so this copy goes away.
+		issue.Problems = append(issue.Problems, err.Error())
+	}
+
+	err := database.QuarantineFile(fv.dir, file.Path, fmt.Errorf("%s", strings.Join(issue.Problems, ". ")))
+	if err != nil {
+		issue.RepairErr = err
+		return
+	}
+	issue.Action = ActionQuarantined
+}
+
+// BuildFileVerifier builds a verifier for the data directory of the file
+// storage. It does not load the entities, so it sees the files as they are.
+func BuildFileVerifier() *FileVerifier {
+	return NewFileVerifier(database.DataDirectory(), Settings{
+		Engine:  Engine(config.String("SIMIO_ENGINE", string(EngineScanner))),
+		Workers: config.Int("SIMIO_WORKERS", runtime.NumCPU()),
+	})
+}
+
+func NewFileVerifier(dir string, settings Settings) *FileVerifier {
+	return &FileVerifier{
+		service: NewSimioServiceWithSettings(settings, nil).(*SimioServiceImpl),
+		dir:     dir,
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		rules       Rules
+		value       string
+		expectedErr string
+	}
+
+	simioService := NewSimioServiceWithSettings(Settings{}, nil).(*SimioServiceImpl)
+
+	defaults := Rules{SequenceSize: 4, MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections, Alphabet: DNAAlphabet}
+	custom := Rules{SequenceSize: 5, MinSequences: 2, Overlap: OverlapOverlapping, Directions: []Direction{Horizontal, Diagonal}, Alphabet: RNAAlphabet, MaxMismatches: 1}
+	toroidal := Rules{SequenceSize: 3, MinSequences: 1, Overlap: OverlapDisjoint, Directions: allDirections, Alphabet: NewAlphabet("custom:XYZ", "XYZ", ""), Toroidal: true}
+
+	cases := []Case{
+		Case{value: defaults.String(), rules: defaults},
+		Case{value: custom.String(), rules: custom},
+		Case{value: toroidal.String(), rules: toroidal},
+		Case{value: "", rules: legacyRules},
+		Case{value: "v3;size=4", expectedErr: "Unknown rules version ( v3 )"},
+		Case{value: "v2;size=four;min=1;overlap=disjoint", expectedErr: "strconv.Atoi: parsing \"four\": invalid syntax"},
+		Case{value: "v2;size=4;min=1;overlap=disjoint;color=red", expectedErr: "Unknown rules field ( color )"},
+		Case{value: "v2;size=4;min=1;overlap=disjoint;alphabet=klingon", expectedErr: "Unknown alphabet ( klingon )"},
+		Case{value: "v2;min=1;overlap=disjoint", expectedErr: "Invalid rules ( v2;min=1;overlap=disjoint )"},
+	}
+
+	for _, c := range cases {
+		rules, err := simioService.parseRules(c.value)
+
+		if c.expectedErr != "" {
+			assert.Equal(c.expectedErr, err.Error())
+			continue
+		}
+		assert.Nil(err)
+		assert.Equal(c.rules.String(), rules.String())
+		assert.Equal(c.rules.Directions, rules.Directions)
+		assert.Equal(c.rules.Alphabet.Name, rules.Alphabet.Name)
+	}
+}
+
+func writeEntityFile(t *testing.T, path string, entity interface{}) {
+	data, _ := json.Marshal(entity)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Error on writing %s. Details: %s", path, err)
+	}
+}
+
+func TestFileVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	root, _ := ioutil.TempDir("", "simio-verify")
+	defer os.RemoveAll(root)
+	dir := root + "/simios/"
+	os.MkdirAll(dir, 0755)
+
+	rules := "v2;size=4;min=1;overlap=disjoint"
+
+	legacy := database.SimioEntity{ID: HashSHA1.id("CGAT|GTCA"), DNA: "CGAT|GTCA"}
+	simian := database.SimioEntity{ID: HashSHA256.id("CCCC|GTCA#" + rules), DNA: "CCCC|GTCA", IsSimian: true, Rules: rules}
+	wrongClass := database.SimioEntity{ID: HashSHA1.id("AAAA|GTCA"), DNA: "AAAA|GTCA"}
+	misnamed := database.SimioEntity{ID: HashSHA1.id("TTTT|GTCA"), DNA: "TTTT|GTCA", IsSimian: true}
+	tampered := database.SimioEntity{ID: HashSHA1.id("GGGG|GTCA"), DNA: "GGGG|GTCC", IsSimian: true}
+
+	writeEntityFile(t, dir+legacy.ID, legacy)
+	writeEntityFile(t, dir+"sha256_"+simian.ID[len("sha256:"):], simian)
+	writeEntityFile(t, dir+wrongClass.ID, wrongClass)
+	writeEntityFile(t, dir+"misnamed", misnamed)
+	writeEntityFile(t, dir+"copy-of-legacy", legacy)
+	writeEntityFile(t, dir+tampered.ID, tampered)
+	writeEntityFile(t, dir+"unknown-field", map[string]interface{}{"ID": "1", "DNA": "CGAT", "Color": "red"})
+	ioutil.WriteFile(dir+"truncated", []byte(`{"ID": "1", "DN`), 0644)
+	ioutil.WriteFile(dir+"leftover.123.tmp", []byte(`{}`), 0644)
+
+	verifier := NewFileVerifier(dir, Settings{})
+
+	report, err := verifier.Verify(false)
+	assert.Nil(err)
+	assert.Equal(9, report.Checked)
+	assert.Equal(7, len(report.Issues))
+	assert.Equal(7, report.Unresolved())
+
+	actions := make(map[string]string)
+	report, err = verifier.Verify(true)
+	assert.Nil(err)
+	assert.Equal(0, report.Unresolved())
+	for _, issue := range report.Issues {
+		actions[filepath.Base(issue.Path)] = issue.Action
+	}
+	assert.Equal(map[string]string{
+		wrongClass.ID:      ActionRewritten,
+		"misnamed":         ActionRewritten,
+		"copy-of-legacy":   ActionQuarantined,
+		tampered.ID:        ActionQuarantined,
+		"unknown-field":    ActionQuarantined,
+		"truncated":        ActionQuarantined,
+		"leftover.123.tmp": ActionQuarantined,
+	}, actions)
+
+	report, err = verifier.Verify(false)
+	assert.Nil(err)
+	assert.Equal(4, report.Checked)
+	assert.Equal(0, len(report.Issues))
+
+	entities, counts, err := database.LoadAll(dir)
+	assert.Nil(err)
+	assert.Equal(database.Counts{Simians: 3, Humans: 1}, counts)
+	assert.True(entities[wrongClass.ID].IsSimian)
+	assert.Equal(misnamed.DNA, entities[misnamed.ID].DNA)
+
+	quarantined, _ := ioutil.ReadDir(root + "/quarantine/")
+	assert.Equal(5, len(quarantined))
+}
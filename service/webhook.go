@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"simio-api/config"
+	"simio-api/database"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Simio-Signature"
+	WebhookDeliveryHeader  = "X-Simio-Delivery"
+)
+
+// WebhookPayload is what a callback_url receives when its work finishes.
+type WebhookPayload struct {
+	Event   string        `json:"event"`
+	JobID   string        `json:"job_id,omitempty"`
+	Status  JobStatus     `json:"status,omitempty"`
+	Results []BatchResult `json:"results"`
+	SentAt  time.Time     `json:"sent_at"`
+}
+
+type Notifier interface {
+	// Notify delivers the payload in the background.
+	Notify(callbackURL string, payload WebhookPayload)
+}
+
+type WebhookSettings struct {
+	// Secret signs the payloads. Without it webhooks are disabled.
+	Secret      string
+	MaxAttempts int
+	// Backoff is the wait before the first retry. It doubles on each retry.
+	Backoff time.Duration
+	Timeout time.Duration
+}
+
+var defaultWebhookSettings = WebhookSettings{MaxAttempts: 5, Backoff: time.Second, Timeout: 10 * time.Second}
+
+// WebhookNotifier POSTs the payloads signed with HMAC-SHA256, retrying with
+// exponential backoff. Deliveries that fail every attempt are kept as dead
+// letters.
+type WebhookNotifier struct {
+	settings    WebhookSettings
+	client      *http.Client
+	deadLetters database.DeadLetterDAO
+	sleep       func(time.Duration)
+}
+
+func (wn *WebhookNotifier) Notify(callbackURL string, payload WebhookPayload) {
+	go wn.deliver(callbackURL, payload)
+}
+
+func (wn *WebhookNotifier) deliver(callbackURL string, payload WebhookPayload) error {
+	payload.SentAt = time.Now().UTC()
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	deliveryID := newRandomId()
+	backoff := wn.settings.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err = wn.post(callbackURL, deliveryID, body)
+
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("Webhook %s to %s failed on attempt %d. Details: %s", deliveryID, callbackURL, attempt, err)
+
+		if attempt == wn.settings.MaxAttempts {
+			wn.deadLetters.Save(database.DeadLetter{
+				ID:        deliveryID,
+				URL:       callbackURL,
+				Payload:   body,
+				Attempts:  attempt,
+				LastError: err.Error(),
+				FailedAt:  time.Now().UTC(),
+			})
+			return err
+		}
+
+		wn.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (wn *WebhookNotifier) post(callbackURL string, deliveryID string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(wn.settings.Secret, body))
+
+	resp, err := wn.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of the body, which receivers compare
+// with the X-Simio-Signature header after its "sha256=" prefix.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateCallbackURL accepts an empty URL, meaning no callback.
+func validateCallbackURL(notifier Notifier, callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	if notifier == nil {
+		return fmt.Errorf("Invalid callback_url. Webhooks are disabled on this server")
+	}
+
+	parsed, err := url.Parse(callbackURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("Invalid callback_url ( %s ). It has to be an absolute http or https URL", callbackURL)
+	}
+	return nil
+}
+
+// BuildWebhookNotifier returns nil, disabling webhooks, when
+// SIMIO_WEBHOOK_SECRET is not set.
+func BuildWebhookNotifier() Notifier {
+	settings := WebhookSettings{
+		Secret:      config.String("SIMIO_WEBHOOK_SECRET", ""),
+		MaxAttempts: config.Int("SIMIO_WEBHOOK_MAX_ATTEMPTS", defaultWebhookSettings.MaxAttempts),
+		Backoff:     config.Duration("SIMIO_WEBHOOK_BACKOFF", defaultWebhookSettings.Backoff),
+		Timeout:     config.Duration("SIMIO_WEBHOOK_TIMEOUT", defaultWebhookSettings.Timeout),
+	}
+
+	if settings.Secret == "" {
+		log.Printf("SIMIO_WEBHOOK_SECRET is not set. Webhooks are disabled")
+		return nil
+	}
+	return NewWebhookNotifier(settings, database.BuildDeadLetterDAO())
+}
+
+func NewWebhookNotifier(settings WebhookSettings, deadLetters database.DeadLetterDAO) *WebhookNotifier {
+	if settings.MaxAttempts < 1 {
+		settings.MaxAttempts = defaultWebhookSettings.MaxAttempts
+	}
+	if settings.Backoff <= 0 {
+		settings.Backoff = defaultWebhookSettings.Backoff
+	}
+	if settings.Timeout <= 0 {
+		settings.Timeout = defaultWebhookSettings.Timeout
+	}
+
+	return &WebhookNotifier{
+		settings:    settings,
+		client:      &http.Client{Timeout: settings.Timeout},
+		deadLetters: deadLetters,
+		sleep:       time.Sleep,
+	}
+}
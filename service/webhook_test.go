@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"simio-api/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type DeadLetterDaoMock struct {
+	mock.Mock
+	database.DeadLetterDAO
+}
+
+func (dm *DeadLetterDaoMock) Save(deadLetter database.DeadLetter) error {
+	args := dm.Called(deadLetter)
+	return args.Error(0)
+}
+
+// webhookReceiver fails the first failures deliveries and records the others.
+type webhookReceiver struct {
+	lock       sync.Mutex
+	failures   int
+	attempts   int
+	bodies     [][]byte
+	signatures []string
+	received   chan bool
+}
+
+func (wr *webhookReceiver) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+
+	wr.attempts++
+	if wr.attempts <= wr.failures {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	wr.bodies = append(wr.bodies, body)
+	wr.signatures = append(wr.signatures, req.Header.Get(WebhookSignatureHeader))
+	rw.WriteHeader(http.StatusNoContent)
+	if wr.received != nil {
+		wr.received <- true
+	}
+}
+
+func newTestNotifier(deadLetters database.DeadLetterDAO, sleeps *[]time.Duration) *WebhookNotifier {
+	notifier := NewWebhookNotifier(WebhookSettings{Secret: "secret", MaxAttempts: 3, Backoff: 10 * time.Millisecond}, deadLetters)
+	notifier.sleep = func(duration time.Duration) {
+		*sleeps = append(*sleeps, duration)
+	}
+	return notifier
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	assert := assert.New(t)
+
+	type Case struct {
+		failures         int
+		expectedAttempts int
+		expectedErr      bool
+		expectedSleeps   []time.Duration
+	}
+
+	cases := []Case{
+		Case{failures: 0, expectedAttempts: 1},
+		Case{failures: 2, expectedAttempts: 3, expectedSleeps: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}},
+		Case{failures: 3, expectedAttempts: 3, expectedErr: true, expectedSleeps: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}},
+	}
+
+	for _, currentCase := range cases {
+		receiver := &webhookReceiver{failures: currentCase.failures}
+		server := httptest.NewServer(receiver)
+
+		deadLetters := new(DeadLetterDaoMock)
+		deadLetters.On("Save", mock.Anything).Return(nil)
+		var sleeps []time.Duration
+		notifier := newTestNotifier(deadLetters, &sleeps)
+
+		payload := WebhookPayload{Event: "batch.finished", Results: []BatchResult{BatchResult{Index: 0, ID: "111", IsSimian: true}}}
+		err := notifier.deliver(server.URL, payload)
+
+		assert.Equal(currentCase.expectedErr, err != nil)
+		assert.Equal(currentCase.expectedAttempts, receiver.attempts)
+		assert.Equal(currentCase.expectedSleeps, sleeps)
+
+		if currentCase.expectedErr {
+			deadLetter := deadLetters.Calls[0].Arguments.Get(0).(database.DeadLetter)
+			assert.Equal(server.URL, deadLetter.URL)
+			assert.Equal(3, deadLetter.Attempts)
+		} else {
+			deadLetters.AssertNotCalled(t, "Save", mock.Anything)
+
+			var received WebhookPayload
+			assert.Nil(json.Unmarshal(receiver.bodies[0], &received))
+			assert.Equal(payload.Results, received.Results)
+			assert.Equal("sha256="+SignWebhook("secret", receiver.bodies[0]), receiver.signatures[0])
+		}
+
+		server.Close()
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", SignWebhook("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	assert := assert.New(t)
+
+	notifier := NewWebhookNotifier(WebhookSettings{Secret: "secret"}, new(DeadLetterDaoMock))
+
+	assert.Nil(validateCallbackURL(nil, ""))
+	assert.Nil(validateCallbackURL(notifier, "https://example.com/hook"))
+	assert.NotNil(validateCallbackURL(nil, "https://example.com/hook"))
+	assert.NotNil(validateCallbackURL(notifier, "ftp://example.com/hook"))
+	assert.NotNil(validateCallbackURL(notifier, "/hook"))
+}
+
+func TestJobWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := &webhookReceiver{received: make(chan bool, 1)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	var sleeps []time.Duration
+	notifier := newTestNotifier(new(DeadLetterDaoMock), &sleeps)
+	jobService := NewJobService(JobSettings{Notifier: notifier}, newBatchSimioService(), newJobDaoMock([]database.JobEntity{}))
+
+	job, err := jobService.Submit(JobRequest{Items: []BatchItem{BatchItem{DNA: dnaSimianHorizontal}}, CallbackURL: server.URL})
+	assert.Nil(err)
+
+	select {
+	case <-receiver.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	var received WebhookPayload
+	receiver.lock.Lock()
+	assert.Nil(json.Unmarshal(receiver.bodies[0], &received))
+	receiver.lock.Unlock()
+
+	assert.Equal("job.finished", received.Event)
+	assert.Equal(job.ID, received.JobID)
+	assert.Equal(JobDone, received.Status)
+	assert.True(received.Results[0].IsSimian)
+}
+
+func TestBatchWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := &webhookReceiver{received: make(chan bool, 1)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	var sleeps []time.Duration
+	simioDaoMock := new(SimioDaoMock)
+	simioDaoMock.On("Get", mock.Anything).Return(database.SimioEntity{}, false)
+	simioDaoMock.On("SaveAll", mock.Anything).Return(nil)
+	simioService := NewSimioServiceWithSettings(Settings{Rules: Rules{SequenceSize: 4}, Notifier: newTestNotifier(new(DeadLetterDaoMock), &sleeps)}, simioDaoMock)
+
+	_, err := simioService.ProcessBatch(context.Background(), []BatchItem{BatchItem{DNA: dnaHuman}}, "not a url")
+	assert.NotNil(err)
+
+	results, err := simioService.ProcessBatch(context.Background(), []BatchItem{BatchItem{DNA: dnaHuman}}, server.URL)
+	assert.Nil(err)
+
+	select {
+	case <-receiver.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	var received WebhookPayload
+	receiver.lock.Lock()
+	assert.Nil(json.Unmarshal(receiver.bodies[0], &received))
+	receiver.lock.Unlock()
+
+	assert.Equal("batch.finished", received.Event)
+	assert.Equal(results, received.Results)
+}